@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
@@ -13,7 +14,11 @@ import (
 	"syscall"
 	"time"
 
+	"example.com/p2p/pkg/addrbook"
 	"example.com/p2p/pkg/config"
+	"example.com/p2p/pkg/dht"
+	"example.com/p2p/pkg/discovery"
+	"example.com/p2p/pkg/identity"
 	"example.com/p2p/pkg/logger"
 	"example.com/p2p/pkg/message"
 	"example.com/p2p/pkg/peer"
@@ -21,6 +26,17 @@ import (
 
 const Version = "1.0.0"
 
+// statsInterval controls how often runtime statistics are logged.
+const statsInterval = time.Minute
+
+// bootstrapDelay is how long to wait for the initial connections before
+// joining the DHT.
+const bootstrapDelay = 5 * time.Second
+
+// deliveryTimeout is how long to wait for acknowledgements of a sent message
+// before reporting its delivery status.
+const deliveryTimeout = 10 * time.Second
+
 type addrList []string
 
 func (a *addrList) String() string     { return strings.Join(*a, ",") }
@@ -32,7 +48,14 @@ type App struct {
 	logger    *logger.Logger
 	peer      *peer.Peer
 	heartbeat *peer.HeartbeatManager
+	members   *peer.Membership
+	reconnect *peer.ReconnectManager
+	book      *addrbook.Book
+	exchange  *peer.PeerExchange
+	discovery *discovery.Service
 	listener  net.Listener
+	room      string // topic typed messages are published to; empty for everyone
+	firstSeq  int    // sequence number of the first message sent this run
 	ctx       context.Context
 	cancel    context.CancelFunc
 	wg        sync.WaitGroup
@@ -58,24 +81,56 @@ func (app *App) Start() error {
 	
 	// Create peer
 	app.peer = peer.NewWithConfig(app.config.ListenAddr, app.config)
+	app.peer.NodeVersion = Version
+	if app.config.IdentityFile != "" {
+		ident, err := identity.LoadOrGenerate(app.config.IdentityFile)
+		if err != nil {
+			return fmt.Errorf("load identity: %w", err)
+		}
+		app.peer.SetIdentity(ident)
+	}
 	peerLogger := app.logger.WithPeer(app.peer.ID)
+	app.peer.SetLogger(peerLogger)
 	
 	// Create heartbeat manager
 	app.heartbeat = peer.NewHeartbeatManager(app.config, app.peer.ID, app.onPeerDead)
+	app.heartbeat.Attach(app.peer)
+	
+	// Create peer exchange to discover peers beyond the configured ones
+	app.book = peer.NewAddressBook(app.config)
+	if app.config.AddressBookFile != "" {
+		if err := app.book.Load(app.config.AddressBookFile); err != nil {
+			app.logger.Warn("Failed to load address book", "file", app.config.AddressBookFile, "error", err)
+		}
+	}
+	app.book.AddMany(app.config.Peers, "")
+	app.exchange = peer.NewPeerExchange(app.config, app.peer, app.book, app.onPeerDiscovered)
+	
+	// Create reconnect manager to restore lost links to configured peers
+	app.reconnect = peer.NewReconnectManager(app.config, app.peer, app.heartbeat)
+	app.reconnect.SetAddressBook(app.book)
+	app.reconnect.SetLogger(peerLogger)
 	
 	// Start listening
-	ln, err := net.Listen("tcp", app.config.ListenAddr)
+	ln, err := app.peer.Listen(app.config.ListenAddr)
 	if err != nil {
 		return fmt.Errorf("listen on %s: %w", app.config.ListenAddr, err)
 	}
 	app.listener = ln
 	
-	actualAddr := ln.Addr().String()
+	actualAddr := app.peer.Addr
 	peerLogger.LogServerStarted(app.peer.ID, actualAddr)
+	
+	// Share a view of who is online with the rest of the mesh
+	app.members = peer.NewMembership(app.config, app.heartbeat, actualAddr, app.onMemberChanged)
+	app.members.Attach(app.peer)
 	fmt.Printf("🚀 P2P Chat v%s\n", Version)
 	fmt.Printf("📡 Peer ID: %s\n", app.peer.ID)
 	fmt.Printf("🔗 Listening on: %s\n", actualAddr)
-	fmt.Printf("💬 Type messages to chat, Ctrl+C to exit\n\n")
+	fmt.Printf("💬 Type messages to chat, /msg <peer> <text> to message one peer,\n")
+	fmt.Printf("   /join <room> and /leave [room] to switch rooms, /connect <peer> to dial\n")
+	fmt.Printf("   a peer by ID or address, /peers to list links, /members to list\n")
+	fmt.Printf("   everyone online, Ctrl+C to exit\n\n")
 	
 	// Start server goroutine
 	app.wg.Add(1)
@@ -87,6 +142,26 @@ func (app *App) Start() error {
 	// Start heartbeat monitoring
 	app.heartbeat.Start()
 	
+	// Start reconnecting to configured peers that drop
+	app.reconnect.Start()
+	
+	// Start peer exchange
+	app.exchange.Start()
+	
+	// Announce ourselves on the local network if enabled
+	if app.config.DiscoveryEnabled {
+		self := discovery.Announcement{ID: app.peer.ID, Addr: actualAddr}
+		svc, err := discovery.New(app.config, self, app.onPeerAnnounced)
+		if err == nil {
+			err = svc.Start()
+		}
+		if err != nil {
+			app.logger.Warn("LAN discovery disabled", "error", err)
+		} else {
+			app.discovery = svc
+		}
+	}
+	
 	// Start message processing
 	app.wg.Add(1)
 	go app.processMessages()
@@ -95,6 +170,14 @@ func (app *App) Start() error {
 	app.wg.Add(1)
 	go app.processUserInput()
 	
+	// Join the DHT and keep the routing table fresh
+	app.wg.Add(1)
+	go app.runDHT()
+	
+	// Start periodic statistics logging
+	app.wg.Add(1)
+	go app.runStatistics()
+	
 	return nil
 }
 
@@ -109,12 +192,38 @@ func (app *App) Stop() {
 	if app.heartbeat != nil {
 		app.heartbeat.Stop()
 	}
+	if app.members != nil {
+		app.members.Stop()
+	}
+	
+	// Stop reconnecting
+	if app.reconnect != nil {
+		app.reconnect.Stop()
+	}
+	
+	// Stop peer exchange
+	if app.exchange != nil {
+		app.exchange.Stop()
+	}
+	
+	// Stop LAN discovery
+	if app.discovery != nil {
+		app.discovery.Stop()
+	}
 	
 	// Close listener
 	if app.listener != nil {
 		app.listener.Close()
 	}
 	
+	// Close connections and the spill file
+	if app.peer != nil {
+		app.peer.Close()
+	}
+	
+	// Remember known peers for the next start
+	app.saveAddressBook()
+	
 	// Wait for all goroutines to finish
 	app.wg.Wait()
 	
@@ -163,50 +272,144 @@ func (app *App) handleIncomingConnection(conn net.Conn) {
 	remoteAddr := conn.RemoteAddr().String()
 	app.logger.Debug("Incoming connection", "remote_addr", remoteAddr)
 	
-	// Perform handshake
-	remoteID, err := peer.Handshake(conn, app.peer.ID)
+	// Perform handshake and register the peer, within the connection limit
+	conn, sess, err := app.peer.Accept(conn)
+	if errors.Is(err, peer.ErrConnectionLimit) {
+		app.logger.Warn("Connection limit reached, rejecting peer",
+			"remote_addr", remoteAddr,
+			"limit", app.config.MaxConnections)
+		return
+	}
+	if errors.Is(err, peer.ErrDuplicateConnection) {
+		app.logger.Debug("Keeping existing link, closing incoming duplicate", "remote_addr", remoteAddr, "reason", err)
+		return
+	}
 	if err != nil {
 		app.logger.LogConnectionError(remoteAddr, fmt.Errorf("handshake failed: %w", err))
-		conn.Close()
 		return
 	}
-	
-	// Check connection limits
-	if app.peer.Connections() >= app.config.MaxConnections {
-		app.logger.Warn("Connection limit reached, rejecting peer",
-			"peer_id", remoteID,
-			"limit", app.config.MaxConnections)
-		conn.Close()
-		return
+	remoteID := sess.Remote.ID
+	app.logger.Debug("Handshake complete",
+		"peer_id", remoteID,
+		"protocol_version", sess.Version,
+		"encrypted", sess.Encrypted,
+		"node_version", sess.Remote.NodeVersion,
+		"capabilities", sess.Capabilities)
+	
+	peerAddr := sess.Remote.ListenAddr
+	if peerAddr == "" {
+		peerAddr = remoteAddr
 	}
-	
-	// Register peer
-	app.peer.HandleConn(remoteID, conn)
-	app.heartbeat.AddPeer(remoteID, remoteAddr, conn)
-	app.logger.LogPeerConnected(remoteID, remoteAddr)
+	app.heartbeat.AddPeer(remoteID, peerAddr, conn)
+	app.logger.LogPeerConnected(remoteID, peerAddr)
 }
 
-// connectToInitialPeers connects to peers specified in configuration
+// connectToInitialPeers dials the peers specified in configuration one at a
+// time, best scored first, until the target degree is reached
 func (app *App) connectToInitialPeers() {
-	for _, peerAddr := range app.config.Peers {
-		go app.connectToPeer(peerAddr)
-	}
+	go func() {
+		for _, peerAddr := range app.book.Rank(app.config.Peers) {
+			if app.ctx.Err() != nil {
+				return
+			}
+			if target := app.config.TargetDegree; target > 0 && app.peer.Connections() >= target {
+				app.logger.Debug("Target degree reached, skipping remaining configured peers", "target", target)
+				return
+			}
+			app.connectToPeer(peerAddr)
+		}
+	}()
 }
 
-// connectToPeer establishes connection to a specific peer
+// connectToPeer establishes connection to a specific peer, given by address
+// or by ID
 func (app *App) connectToPeer(addr string) {
 	app.logger.Debug("Attempting to connect to peer", "address", addr)
 	
+	byID := dht.IsID(addr)
+	start := time.Now()
 	remoteID, err := app.peer.Connect(addr)
+	if errors.Is(err, peer.ErrCircuitOpen) {
+		app.logger.Debug("Skipping peer with open circuit", "address", addr)
+		return
+	}
+	if errors.Is(err, peer.ErrConnectionLimit) {
+		app.logger.Debug("Skipping peer, no outbound slot", "address", addr)
+		return
+	}
 	if err != nil {
+		if !byID {
+			app.book.MarkFailure(addr)
+		}
 		app.logger.LogConnectionError(addr, err)
 		return
 	}
+	if byID {
+		// The address was looked up in the DHT; record the one dialed.
+		addr = app.peerAddr(remoteID)
+	}
+	if addr != "" {
+		app.book.MarkSuccess(addr, time.Since(start))
+	}
 	
 	app.heartbeat.AddPeer(remoteID, addr, nil) // conn is managed by peer
 	app.logger.LogPeerConnected(remoteID, addr)
 }
 
+// peerAddr returns the address a connected peer can be dialed at, as
+// recorded in the DHT or, failing that, advertised in its hello
+func (app *App) peerAddr(id string) string {
+	if c, ok := app.peer.RoutingTable().Find(id); ok {
+		return c.Addr
+	}
+	if sess, ok := app.peer.Session(id); ok {
+		return sess.Remote.ListenAddr
+	}
+	return ""
+}
+
+// onPeerDiscovered is called when the peer exchange connects to a peer it
+// learned about through gossip
+func (app *App) onPeerDiscovered(remoteID, addr string) {
+	app.heartbeat.AddPeer(remoteID, addr, nil) // conn is managed by peer
+	app.logger.LogPeerConnected(remoteID, addr)
+}
+
+// onPeerAnnounced is called when another node announces itself on the local
+// network. Only the node with the lower ID dials, so that two nodes hearing
+// each other do not connect twice.
+func (app *App) onPeerAnnounced(ann discovery.Announcement) {
+	if !dht.IsID(ann.ID) {
+		return
+	}
+	if _, ok := app.peer.Session(ann.ID); ok || app.peer.ID > ann.ID {
+		return
+	}
+	app.logger.Debug("Discovered peer on local network", "peer_id", ann.ID, "address", ann.Addr)
+	go app.connectToAnnounced(ann)
+}
+
+// connectToAnnounced dials a peer heard on the local network. Announcements
+// are not authenticated, so the connection is kept, and the address
+// remembered, only if the peer there proves the announced ID.
+func (app *App) connectToAnnounced(ann discovery.Announcement) {
+	start := time.Now()
+	err := app.peer.ConnectTo(ann.ID, ann.Addr)
+	if errors.Is(err, peer.ErrCircuitOpen) || errors.Is(err, peer.ErrConnectionLimit) {
+		app.logger.Debug("Skipping announced peer", "address", ann.Addr, "reason", err)
+		return
+	}
+	if err != nil {
+		app.logger.LogConnectionError(ann.Addr, err)
+		return
+	}
+	app.book.Add(ann.Addr, ann.ID)
+	app.book.MarkSuccess(ann.Addr, time.Since(start))
+	
+	app.heartbeat.AddPeer(ann.ID, ann.Addr, nil) // conn is managed by peer
+	app.logger.LogPeerConnected(ann.ID, ann.Addr)
+}
+
 // processMessages handles incoming messages from other peers
 func (app *App) processMessages() {
 	defer app.wg.Done()
@@ -226,12 +429,18 @@ func (app *App) handleMessage(msg *message.Message) {
 	app.heartbeat.UpdateLastSeen(msg.SenderID)
 	
 	switch {
-	case msg.IsHeartbeat():
-		app.heartbeat.ProcessHeartbeat(msg)
-		app.logger.LogHeartbeatReceived(msg.SenderID, msg.SequenceNo)
+	case msg.IsChatMessage() && msg.Topic != "":
+		app.logger.LogMessageReceived(string(msg.Type), msg.SenderID, msg.SequenceNo)
+		fmt.Printf("💬 #%s [%s]: %s\n", msg.Topic, shortID(msg.SenderID), msg.Payload)
+		app.peer.Acknowledge(msg, message.AckRead)
 	case msg.IsChatMessage():
 		app.logger.LogMessageReceived(string(msg.Type), msg.SenderID, msg.SequenceNo)
-		fmt.Printf("💬 [%s]: %s\n", msg.SenderID[:8], msg.Payload)
+		fmt.Printf("💬 [%s]: %s\n", shortID(msg.SenderID), msg.Payload)
+		app.peer.Acknowledge(msg, message.AckRead)
+	case msg.IsDirect():
+		app.logger.LogMessageReceived(string(msg.Type), msg.SenderID, msg.SequenceNo)
+		fmt.Printf("📩 [%s → you]: %s\n", shortID(msg.SenderID), msg.Payload)
+		app.peer.Acknowledge(msg, message.AckRead)
 	default:
 		app.logger.Debug("Received unknown message type",
 			"type", msg.Type,
@@ -244,7 +453,11 @@ func (app *App) processUserInput() {
 	defer app.wg.Done()
 	
 	scanner := bufio.NewScanner(os.Stdin)
-	sequenceNo := 1
+	// Sequence numbers start from the clock rather than 1, so that peers
+	// still remembering the messages of a previous run with the same
+	// identity do not drop the new ones as duplicates.
+	sequenceNo := int(time.Now().UnixMilli())
+	app.firstSeq = sequenceNo
 	
 	for {
 		select {
@@ -279,11 +492,27 @@ func (app *App) processUserInput() {
 					continue
 				}
 				
-				// Create and broadcast chat message
-				msg := message.NewChatMessage(app.peer.ID, sequenceNo, text)
+				if strings.HasPrefix(text, "/") {
+					app.handleCommand(text, &sequenceNo)
+					continue
+				}
+				
+				// Create and broadcast chat message, or publish it to the
+				// current room
+				msg := message.NewTopicMessage(app.peer.ID, app.room, sequenceNo, text)
 				sequenceNo++
 				
-				if err := app.peer.Broadcast(msg); err != nil {
+				var tracker *peer.DeliveryTracker
+				var err error
+				if app.room != "" {
+					tracker, err = app.peer.PublishTracked(app.room, msg, deliveryTimeout)
+				} else {
+					tracker, err = app.peer.BroadcastTracked(msg, deliveryTimeout)
+				}
+				if err == nil {
+					go app.reportDelivery(tracker, app.room)
+				}
+				if err != nil {
 					app.logger.Error("Failed to broadcast message", "error", err)
 					fmt.Printf("❌ Failed to send message: %v\n", err)
 				} else {
@@ -297,11 +526,279 @@ func (app *App) processUserInput() {
 	}
 }
 
+// handleCommand executes a slash command typed by the user
+func (app *App) handleCommand(text string, sequenceNo *int) {
+	fields := strings.Fields(text)
+	switch fields[0] {
+	case "/msg":
+		parts := strings.SplitN(text, " ", 3)
+		if len(parts) < 3 || strings.TrimSpace(parts[2]) == "" {
+			fmt.Println("Usage: /msg <peer> <text>")
+			return
+		}
+		recipient, err := app.resolvePeer(parts[1])
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		msg := message.NewDirectMessage(app.peer.ID, recipient, *sequenceNo, parts[2])
+		*sequenceNo++
+		tracker, err := app.peer.SendToTracked(recipient, msg, deliveryTimeout)
+		if err != nil {
+			app.logger.Error("Failed to send direct message", "recipient", recipient, "error", err)
+			fmt.Printf("❌ Failed to send message: %v\n", err)
+			return
+		}
+		go app.reportDelivery(tracker, "")
+		app.logger.Debug("Direct message sent", "recipient", recipient, "sequence_no", msg.SequenceNo)
+	case "/join":
+		if len(fields) != 2 {
+			fmt.Println("Usage: /join <room>")
+			return
+		}
+		app.peer.Subscribe(fields[1])
+		app.room = fields[1]
+		app.logger.Info("Joined room", "topic", app.room)
+		fmt.Printf("🚪 Joined #%s; messages now go to this room\n", app.room)
+	case "/leave":
+		room := app.room
+		if len(fields) > 1 {
+			room = fields[1]
+		}
+		if room == "" {
+			fmt.Println("Usage: /leave [room]")
+			return
+		}
+		app.peer.Unsubscribe(room)
+		if room == app.room {
+			app.room = ""
+		}
+		app.logger.Info("Left room", "topic", room)
+		fmt.Printf("🚪 Left #%s\n", room)
+		if app.room == "" {
+			fmt.Println("💬 Messages now go to everyone")
+		}
+	case "/peers":
+		app.printPeers()
+	case "/members":
+		app.printMembers()
+	case "/connect":
+		if len(fields) != 2 {
+			fmt.Println("Usage: /connect <peer-id|address>")
+			return
+		}
+		fmt.Printf("🔎 Connecting to %s\n", fields[1])
+		go app.connectToPeer(fields[1])
+	default:
+		fmt.Printf("Unknown command %s\n", fields[0])
+	}
+}
+
+// reportDelivery prints how far a sent message got once its acknowledgements
+// are in or the delivery timeout has passed. Messages to a room are
+// acknowledged by subscribers that are not known in advance, so only they
+// are counted
+func (app *App) reportDelivery(tracker *peer.DeliveryTracker, room string) {
+	select {
+	case <-app.ctx.Done():
+		return
+	case <-tracker.Done():
+	}
+	report := tracker.Report()
+	// Messages are numbered from 1 for the user.
+	n := tracker.SequenceNo - app.firstSeq + 1
+	if room != "" {
+		if len(report.Delivered) == 0 {
+			fmt.Printf("⌛ #%d in #%s not acknowledged by anyone\n", n, room)
+			return
+		}
+		fmt.Printf("✓ #%d in #%s delivered to %d, read by %d\n", n, room,
+			len(report.Delivered), len(report.Read))
+		return
+	}
+	expected := len(report.Expected)
+	if expected == 0 {
+		return
+	}
+	mark := "✓"
+	if len(report.Missing) > 0 {
+		mark = "⌛"
+	}
+	fmt.Printf("%s #%d delivered %d/%d, read %d/%d", mark, n,
+		len(report.Delivered), expected, len(report.Read), expected)
+	if len(report.Missing) > 0 {
+		missing := make([]string, len(report.Missing))
+		for i, id := range report.Missing {
+			missing[i] = shortID(id)
+		}
+		fmt.Printf(" (no reply from %s)", strings.Join(missing, ", "))
+	}
+	fmt.Println()
+}
+
+// printPeers lists the monitored peers with the round trip time of each link
+func (app *App) printPeers() {
+	infos := app.heartbeat.GetPeerInfos()
+	if len(infos) == 0 {
+		fmt.Println("No connected peers")
+		return
+	}
+	for _, info := range infos {
+		rtt := "rtt unknown"
+		if info.LastRTT > 0 {
+			rtt = fmt.Sprintf("rtt %v ±%v (last %v)",
+				info.SRTT.Round(time.Microsecond), info.RTTVar.Round(time.Microsecond), info.LastRTT.Round(time.Microsecond))
+		}
+		fmt.Printf("  %s  %-22s %s  phi %.1f\n", shortID(info.ID), info.Addr, rtt, info.Phi)
+	}
+}
+
+// printMembers lists every member of the mesh known to the membership layer
+func (app *App) printMembers() {
+	for _, m := range app.members.Members() {
+		self := ""
+		if m.ID == app.peer.ID {
+			self = " (you)"
+		}
+		fmt.Printf("  %s  %-22s %-7s incarnation %d%s\n", shortID(m.ID), m.Addr, m.State, m.Incarnation, self)
+	}
+}
+
+// resolvePeer expands a peer ID prefix to the full ID of a known peer
+func (app *App) resolvePeer(prefix string) (string, error) {
+	var matches []string
+	for _, id := range app.peer.KnownPeers() {
+		if strings.HasPrefix(id, prefix) {
+			matches = append(matches, id)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		// Unknown peers may still be reachable by flooding.
+		if len(prefix) == len(app.peer.ID) {
+			return prefix, nil
+		}
+		return "", fmt.Errorf("no known peer matches %q", prefix)
+	default:
+		return "", fmt.Errorf("peer prefix %q is ambiguous", prefix)
+	}
+}
+
+// runStatistics periodically logs peer and message statistics
+func (app *App) runStatistics() {
+	defer app.wg.Done()
+	
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case <-ticker.C:
+			app.logStatistics()
+			app.saveAddressBook()
+		}
+	}
+}
+
+// saveAddressBook writes the address book to disk if a file is configured
+func (app *App) saveAddressBook() {
+	if app.book == nil || app.config.AddressBookFile == "" {
+		return
+	}
+	if err := app.book.Save(app.config.AddressBookFile); err != nil {
+		app.logger.Warn("Failed to save address book", "file", app.config.AddressBookFile, "error", err)
+	}
+}
+
+// runDHT bootstraps the routing table once the initial connections are up
+// and then refreshes idle buckets periodically
+func (app *App) runDHT() {
+	defer app.wg.Done()
+	
+	select {
+	case <-app.ctx.Done():
+		return
+	case <-time.After(bootstrapDelay):
+	}
+	app.peer.Bootstrap(app.ctx)
+	
+	interval := time.Duration(app.config.DHTRefreshInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case <-ticker.C:
+			app.peer.RefreshBuckets(app.ctx, interval)
+		}
+	}
+}
+
+// logStatistics logs a snapshot of the current statistics
+func (app *App) logStatistics() {
+	sent, received, monitored := app.heartbeat.GetPeerStats()
+	app.logger.LogStatistics(map[string]interface{}{
+		"connections":         app.peer.Connections(),
+		"monitored_peers":     monitored,
+		"heartbeats_sent":     sent,
+		"heartbeats_received": received,
+		"rejected_messages":   app.peer.RejectedMessages(),
+		"dropped_messages":    app.peer.DroppedMessages(),
+		"address_book":        app.book.Len(),
+		"routing_table":       app.peer.RoutingTable().Len(),
+		"peer_rtt":            app.peerRTTs(),
+	})
+}
+
+// peerRTTs summarises the round trip time of each measured link, keyed by
+// short peer ID
+func (app *App) peerRTTs() map[string]string {
+	rtts := make(map[string]string)
+	for _, info := range app.heartbeat.GetPeerInfos() {
+		if info.LastRTT > 0 {
+			rtts[shortID(info.ID)] = fmt.Sprintf("srtt=%v rttvar=%v last=%v", info.SRTT, info.RTTVar, info.LastRTT)
+		}
+	}
+	return rtts
+}
+
+// onMemberChanged is called when the membership layer learns that a member
+// of the mesh changed state
+func (app *App) onMemberChanged(m peer.Member) {
+	app.logger.Info("Membership changed",
+		"peer_id", m.ID,
+		"state", m.State.String(),
+		"incarnation", m.Incarnation)
+	if m.State == peer.MemberDead {
+		fmt.Printf("💀 Peer %s left the mesh\n", shortID(m.ID))
+	}
+}
+
+// shortID abbreviates a peer ID for display. Member IDs arrive by gossip, so
+// they are not guaranteed to be full length.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
 // onPeerDead is called when a peer is detected as dead
 func (app *App) onPeerDead(peerID string) {
 	app.peer.RemoveConn(peerID)
 	app.logger.LogPeerTimedOut(peerID, "heartbeat timeout")
-	fmt.Printf("⚠️  Peer %s disconnected (timeout)\n", peerID[:8])
+	fmt.Printf("⚠️  Peer %s disconnected (timeout)\n", shortID(peerID))
+	
+	// Try to win back a configured peer without waiting for the next check
+	if app.reconnect != nil {
+		app.reconnect.CheckNow()
+	}
 }
 
 func main() {
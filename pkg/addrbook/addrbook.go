@@ -0,0 +1,361 @@
+package addrbook
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// MaxAddrLength bounds the length of a single address accepted into the book.
+const MaxAddrLength = 256
+
+// MaxFailures is the number of consecutive failed dials after which a
+// gossiped address is dropped. Configured addresses are kept regardless.
+const MaxFailures = 5
+
+// Bounds on an entry's score. A successful dial raises the score by one; a
+// failed dial lowers it by the number of consecutive failures so far.
+const (
+	MaxScore = 10
+	MinScore = -20
+)
+
+// Entry is an address known to the book, along with what is known about
+// dialing it.
+type Entry struct {
+	Addr        string        `json:"addr"`
+	Source      string        `json:"source,omitempty"` // peer the address was learned from; empty if configured
+	Added       time.Time     `json:"added"`
+	LastSuccess time.Time     `json:"last_success,omitempty"`
+	LastFailure time.Time     `json:"last_failure,omitempty"`
+	Failures    int           `json:"failures,omitempty"` // consecutive failed dials
+	Latency     time.Duration `json:"latency,omitempty"`  // smoothed time to connect
+	Score       int           `json:"score"`
+}
+
+// better reports whether e should be dialed before o: higher score first,
+// then lower latency, then the more recent success.
+func (e *Entry) better(o *Entry) bool {
+	if e.Score != o.Score {
+		return e.Score > o.Score
+	}
+	if e.Latency != o.Latency && e.Latency != 0 && o.Latency != 0 {
+		return e.Latency < o.Latency
+	}
+	if !e.LastSuccess.Equal(o.LastSuccess) {
+		return e.LastSuccess.After(o.LastSuccess)
+	}
+	return e.Addr < o.Addr
+}
+
+// Book holds peer addresses learned from configuration and gossip. It is
+// bounded in total and per source: a single source can hold at most
+// perSource entries, and when the book is full a new address displaces an
+// entry from the source holding the most, so a peer sending junk mostly
+// evicts its own addresses. Each entry is scored by the outcome of past
+// dials so that callers can try the most reliable addresses first, and the
+// book can be saved to disk to keep that history across restarts.
+type Book struct {
+	mu        sync.Mutex
+	capacity  int
+	perSource int
+	entries   map[string]*Entry
+	bySource  map[string]int
+}
+
+// New creates a Book holding at most capacity addresses, of which at most
+// perSource may come from any one source.
+func New(capacity, perSource int) *Book {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	if perSource <= 0 || perSource > capacity {
+		perSource = capacity
+	}
+	return &Book{
+		capacity:  capacity,
+		perSource: perSource,
+		entries:   make(map[string]*Entry),
+		bySource:  make(map[string]int),
+	}
+}
+
+// Add records addr as learned from source. It reports whether the address
+// was added; known addresses, malformed addresses and addresses over the
+// source's quota are ignored. Configured addresses, with an empty source,
+// are exempt from the per-source quota.
+func (b *Book) Add(addr, source string) bool {
+	if !Valid(addr) {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if e, ok := b.entries[addr]; ok {
+		if source == "" && e.Source != "" {
+			// A configured address is never subject to eviction or
+			// quotas, even if it was gossiped first.
+			b.setSourceLocked(e, "")
+		}
+		return false
+	}
+	if source != "" && b.bySource[source] >= b.perSource {
+		return false
+	}
+	if len(b.entries) >= b.capacity && !b.evictLocked() {
+		return false
+	}
+	b.entries[addr] = &Entry{Addr: addr, Source: source, Added: time.Now()}
+	b.bySource[source]++
+	return true
+}
+
+// AddMany adds each address and returns how many were new.
+func (b *Book) AddMany(addrs []string, source string) int {
+	n := 0
+	for _, addr := range addrs {
+		if b.Add(addr, source) {
+			n++
+		}
+	}
+	return n
+}
+
+// evictLocked removes a random gossiped entry from the source with the most
+// entries. Configured entries are never evicted. b.mu must be held.
+func (b *Book) evictLocked() bool {
+	var worst string
+	for src, n := range b.bySource {
+		if src != "" && (worst == "" || n > b.bySource[worst]) {
+			worst = src
+		}
+	}
+	if worst == "" {
+		return false
+	}
+	victims := make([]string, 0, b.bySource[worst])
+	for addr, e := range b.entries {
+		if e.Source == worst {
+			victims = append(victims, addr)
+		}
+	}
+	b.removeLocked(victims[rand.Intn(len(victims))])
+	return true
+}
+
+func (b *Book) setSourceLocked(e *Entry, source string) {
+	if b.bySource[e.Source]--; b.bySource[e.Source] <= 0 {
+		delete(b.bySource, e.Source)
+	}
+	e.Source = source
+	b.bySource[source]++
+}
+
+// MarkSuccess records a successful dial of addr that took latency.
+func (b *Book) MarkSuccess(addr string, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.entries[addr]
+	if !ok {
+		return
+	}
+	e.LastSuccess = time.Now()
+	e.Failures = 0
+	if e.Latency == 0 {
+		e.Latency = latency
+	} else {
+		e.Latency = (3*e.Latency + latency) / 4
+	}
+	if e.Score < MaxScore {
+		e.Score++
+	}
+}
+
+// MarkFailure records a failed dial of addr. A gossiped address that has
+// failed MaxFailures times in a row is removed.
+func (b *Book) MarkFailure(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.entries[addr]
+	if !ok {
+		return
+	}
+	e.LastFailure = time.Now()
+	e.Failures++
+	if e.Score -= e.Failures; e.Score < MinScore {
+		e.Score = MinScore
+	}
+	if e.Source != "" && e.Failures >= MaxFailures {
+		b.removeLocked(addr)
+	}
+}
+
+// Remove deletes addr from the book.
+func (b *Book) Remove(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.removeLocked(addr)
+}
+
+func (b *Book) removeLocked(addr string) {
+	e, ok := b.entries[addr]
+	if !ok {
+		return
+	}
+	delete(b.entries, addr)
+	if b.bySource[e.Source]--; b.bySource[e.Source] <= 0 {
+		delete(b.bySource, e.Source)
+	}
+}
+
+// Contains reports whether addr is in the book.
+func (b *Book) Contains(addr string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.entries[addr]
+	return ok
+}
+
+// Len returns the number of addresses in the book.
+func (b *Book) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.entries)
+}
+
+// Addresses returns all addresses in the book, sorted.
+func (b *Book) Addresses() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	addrs := make([]string, 0, len(b.entries))
+	for addr := range b.entries {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// Get returns a copy of the entry for addr.
+func (b *Book) Get(addr string) (Entry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.entries[addr]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// Entries returns copies of all entries, best first.
+func (b *Book) Entries() []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entries := make([]*Entry, 0, len(b.entries))
+	for _, e := range b.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].better(entries[j]) })
+	out := make([]Entry, len(entries))
+	for i, e := range entries {
+		out[i] = *e
+	}
+	return out
+}
+
+// Rank returns addrs ordered best first. Addresses not in the book come
+// after known ones, in their original order.
+func (b *Book) Rank(addrs []string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ranked := append([]string(nil), addrs...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		ei, iok := b.entries[ranked[i]]
+		ej, jok := b.entries[ranked[j]]
+		if iok != jok {
+			return iok
+		}
+		return iok && ei.better(ej)
+	})
+	return ranked
+}
+
+// Sample returns up to n addresses chosen at random.
+func (b *Book) Sample(n int) []string {
+	addrs := b.Addresses()
+	rand.Shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+	if n < len(addrs) {
+		addrs = addrs[:n]
+	}
+	return addrs
+}
+
+// Valid reports whether addr is acceptable as an address: non-empty, at most
+// MaxAddrLength bytes and free of whitespace and control characters.
+func Valid(addr string) bool {
+	if addr == "" || len(addr) > MaxAddrLength {
+		return false
+	}
+	for _, r := range addr {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Save writes the book to path as JSON. The file is replaced atomically.
+func (b *Book) Save(path string) error {
+	data, err := json.MarshalIndent(b.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load merges the entries saved at path into the book, keeping their
+// history. A missing file is not an error. Entries already in the book,
+// malformed addresses and entries beyond the book's limits are skipped.
+func (b *Book) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !b.Add(e.Addr, e.Source) {
+			continue
+		}
+		b.mu.Lock()
+		if cur, ok := b.entries[e.Addr]; ok {
+			e.Source = cur.Source
+			*cur = e
+		}
+		b.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package addrbook
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddAndRemove(t *testing.T) {
+	b := New(10, 5)
+	if !b.Add("localhost:8080", "") {
+		t.Fatal("expected new address to be added")
+	}
+	if b.Add("localhost:8080", "peer1") {
+		t.Fatal("expected duplicate address to be ignored")
+	}
+	if !b.Contains("localhost:8080") || b.Len() != 1 {
+		t.Fatalf("expected one address, got %v", b.Addresses())
+	}
+	b.Remove("localhost:8080")
+	if b.Contains("localhost:8080") || b.Len() != 0 {
+		t.Fatalf("expected empty book, got %v", b.Addresses())
+	}
+}
+
+func TestRejectsMalformedAddresses(t *testing.T) {
+	b := New(10, 5)
+	for _, addr := range []string{"", "has space:80", "tab\t:80", "nul\x00:80", strings.Repeat("a", MaxAddrLength+1)} {
+		if b.Add(addr, "peer1") {
+			t.Errorf("expected %q to be rejected", addr)
+		}
+	}
+	if b.Len() != 0 {
+		t.Fatalf("expected empty book, got %v", b.Addresses())
+	}
+}
+
+func TestPerSourceQuota(t *testing.T) {
+	b := New(100, 3)
+	addrs := make([]string, 10)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("10.0.0.%d:8080", i)
+	}
+	if n := b.AddMany(addrs, "flooder"); n != 3 {
+		t.Fatalf("expected 3 addresses accepted from one source, got %d", n)
+	}
+	if !b.Add("10.0.1.1:8080", "honest") {
+		t.Fatal("expected other sources to still be accepted")
+	}
+	if n := b.AddMany(addrs, ""); n != 7 {
+		t.Fatalf("expected configured addresses to bypass the quota, got %d", n)
+	}
+}
+
+func TestFullBookEvictsFromLargestSource(t *testing.T) {
+	b := New(4, 3)
+	b.Add("seed:8080", "")
+	b.Add("honest:8080", "honest")
+	b.AddMany([]string{"junk1:80", "junk2:80"}, "flooder")
+
+	if !b.Add("another:8080", "other") {
+		t.Fatal("expected new source to displace an entry when full")
+	}
+	if b.Len() != 4 {
+		t.Fatalf("expected book to stay at capacity, got %d", b.Len())
+	}
+	for _, addr := range []string{"seed:8080", "honest:8080", "another:8080"} {
+		if !b.Contains(addr) {
+			t.Errorf("expected %s to survive eviction", addr)
+		}
+	}
+}
+
+func TestFullOfConfiguredAddresses(t *testing.T) {
+	b := New(2, 2)
+	b.AddMany([]string{"a:1", "b:1"}, "")
+	if b.Add("c:1", "peer") {
+		t.Fatal("expected configured addresses never to be evicted")
+	}
+}
+
+func TestSample(t *testing.T) {
+	b := New(10, 10)
+	b.AddMany([]string{"a:1", "b:1", "c:1"}, "")
+	if got := b.Sample(2); len(got) != 2 {
+		t.Fatalf("expected 2 addresses, got %v", got)
+	}
+	if got := b.Sample(10); len(got) != 3 {
+		t.Fatalf("expected all 3 addresses, got %v", got)
+	}
+}
+
+func TestScoring(t *testing.T) {
+	b := New(10, 10)
+	b.AddMany([]string{"good:1", "slow:1", "bad:1", "new:1"}, "")
+	b.MarkSuccess("good:1", 10*time.Millisecond)
+	b.MarkSuccess("slow:1", 500*time.Millisecond)
+	b.MarkFailure("bad:1")
+
+	e, ok := b.Get("bad:1")
+	if !ok || e.Failures != 1 || e.Score >= 0 || e.LastFailure.IsZero() {
+		t.Fatalf("expected failure to be recorded, got %+v", e)
+	}
+	got := b.Rank([]string{"unknown:1", "bad:1", "new:1", "slow:1", "good:1"})
+	want := []string{"good:1", "slow:1", "new:1", "bad:1", "unknown:1"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected ranking %v, got %v", want, got)
+	}
+
+	b.MarkSuccess("bad:1", time.Millisecond)
+	if e, _ := b.Get("bad:1"); e.Failures != 0 || e.LastSuccess.IsZero() {
+		t.Fatalf("expected success to reset consecutive failures, got %+v", e)
+	}
+}
+
+func TestRepeatedFailuresDropGossipedAddresses(t *testing.T) {
+	b := New(10, 10)
+	b.Add("seed:1", "")
+	b.Add("gossiped:1", "peer1")
+	for i := 0; i < MaxFailures; i++ {
+		b.MarkFailure("gossiped:1")
+	}
+	for i := 0; i < 2*MaxFailures; i++ {
+		b.MarkFailure("seed:1")
+	}
+	if b.Contains("gossiped:1") {
+		t.Fatal("expected gossiped address to be dropped after repeated failures")
+	}
+	e, ok := b.Get("seed:1")
+	if !ok {
+		t.Fatal("expected configured address to be kept")
+	}
+	if e.Score != MinScore {
+		t.Fatalf("expected score to bottom out at %d, got %d", MinScore, e.Score)
+	}
+}
+
+func TestConfiguredAddressOverridesGossip(t *testing.T) {
+	b := New(2, 2)
+	b.Add("a:1", "peer1")
+	b.Add("a:1", "")
+	b.Add("b:1", "")
+	if b.Add("c:1", "peer2") {
+		t.Fatal("expected configured addresses never to be evicted")
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	b := New(10, 10)
+	b.Add("seed:1", "")
+	b.Add("gossiped:1", "peer1")
+	b.MarkSuccess("gossiped:1", 20*time.Millisecond)
+	b.MarkFailure("seed:1")
+	if err := b.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := New(10, 10)
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := loaded.Addresses(); len(got) != 2 {
+		t.Fatalf("expected 2 addresses, got %v", got)
+	}
+	e, _ := loaded.Get("gossiped:1")
+	if e.Source != "peer1" || e.Latency != 20*time.Millisecond || e.Score != 1 {
+		t.Fatalf("expected history to survive a restart, got %+v", e)
+	}
+	if e, _ := loaded.Get("seed:1"); e.Failures != 1 {
+		t.Fatalf("expected failures to survive a restart, got %+v", e)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	b := New(10, 10)
+	if err := b.Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Fatalf("expected missing file to be ignored, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -10,21 +11,70 @@ import (
 	"time"
 )
 
+// Backoff policies accepted by reconnect_policy
+const (
+	BackoffExponential  = "exponential"
+	BackoffDecorrelated = "decorrelated"
+	BackoffConstant     = "constant"
+)
+
+// What to do with an incoming message when the delivery buffer is full,
+// accepted by overflow_policy
+const (
+	OverflowBlock      = "block"
+	OverflowDropOldest = "drop-oldest"
+	OverflowDropNewest = "drop-newest"
+	OverflowSpill      = "spill"
+)
+
 // Config represents the application configuration
 type Config struct {
 	// Network settings
 	ListenAddr string   `json:"listen_addr" yaml:"listen_addr"`
 	Peers      []string `json:"peers" yaml:"peers"`
 	
+	// Identity settings
+	IdentityFile string `json:"identity_file" yaml:"identity_file"` // empty for an ephemeral identity
+	
 	// Connection settings
 	MaxConnections    int              `json:"max_connections" yaml:"max_connections"`
+	MaxOutbound       int              `json:"max_outbound" yaml:"max_outbound"` // connections this node dials itself; the rest are for inbound, 0 for a third of max_connections
 	ConnectTimeout    JSONDuration     `json:"connect_timeout" yaml:"connect_timeout"`
 	HeartbeatInterval JSONDuration     `json:"heartbeat_interval" yaml:"heartbeat_interval"`
-	HeartbeatTimeout  JSONDuration     `json:"heartbeat_timeout" yaml:"heartbeat_timeout"`
+	HeartbeatTimeout  JSONDuration     `json:"heartbeat_timeout" yaml:"heartbeat_timeout"` // pause tolerated on top of the usual heartbeat gap
+	PhiThreshold      float64          `json:"phi_threshold" yaml:"phi_threshold"`         // failure detector suspicion level at which a link is probed indirectly
+	PhiWindowSize     int              `json:"phi_window_size" yaml:"phi_window_size"`     // heartbeat gaps remembered per peer
+	IndirectProbes    int              `json:"indirect_probes" yaml:"indirect_probes"`     // neighbours asked to ping an unresponsive peer
+	SuspicionTimeout  JSONDuration     `json:"suspicion_timeout" yaml:"suspicion_timeout"` // time a suspected peer has to refute before it is dead
+	
+	// Reconnection settings
+	ReconnectBaseDelay JSONDuration `json:"reconnect_base_delay" yaml:"reconnect_base_delay"` // wait before the first retry
+	ReconnectMaxDelay  JSONDuration `json:"reconnect_max_delay" yaml:"reconnect_max_delay"`   // cap on the wait between retries
+	ReconnectInterval  JSONDuration `json:"reconnect_interval" yaml:"reconnect_interval"`     // how often to look for disconnected peers
+	ReconnectPolicy    string       `json:"reconnect_policy" yaml:"reconnect_policy"`         // exponential, decorrelated or constant
+	BreakerThreshold   int          `json:"breaker_threshold" yaml:"breaker_threshold"`       // failed dials before an address is left alone; 0 disables
 	
 	// Message settings
-	MessageBufferSize int `json:"message_buffer_size" yaml:"message_buffer_size"`
-	DedupCacheSize    int `json:"dedup_cache_size" yaml:"dedup_cache_size"`
+	MessageBufferSize int    `json:"message_buffer_size" yaml:"message_buffer_size"`
+	DedupCacheSize    int    `json:"dedup_cache_size" yaml:"dedup_cache_size"`
+	MaxFrameSize      int    `json:"max_frame_size" yaml:"max_frame_size"`
+	MessageTTL        int    `json:"message_ttl" yaml:"message_ttl"`         // hops a message may travel
+	OverflowPolicy    string `json:"overflow_policy" yaml:"overflow_policy"` // block, drop-oldest, drop-newest or spill
+	SpillFile         string `json:"spill_file" yaml:"spill_file"`           // where spilled messages queue; empty for a temporary file
+	
+	// Discovery settings
+	PeerExchangeInterval JSONDuration `json:"peer_exchange_interval" yaml:"peer_exchange_interval"`
+	TargetDegree         int          `json:"target_degree" yaml:"target_degree"` // 0 disables dialing discovered peers
+	AddressBookSize      int          `json:"address_book_size" yaml:"address_book_size"`
+	AddressBookFile      string       `json:"address_book_file" yaml:"address_book_file"` // empty keeps the book in memory only
+	DiscoveryEnabled     bool         `json:"discovery_enabled" yaml:"discovery_enabled"` // LAN multicast announcements
+	DiscoveryAddr        string       `json:"discovery_addr" yaml:"discovery_addr"`       // multicast group:port
+	DiscoveryInterval    JSONDuration `json:"discovery_interval" yaml:"discovery_interval"`
+	DHTRefreshInterval   JSONDuration `json:"dht_refresh_interval" yaml:"dht_refresh_interval"` // how often idle routing table buckets are refreshed
+	
+	// Security settings
+	RequireSignedMessages bool `json:"require_signed_messages" yaml:"require_signed_messages"`
+	RequireEncryption     bool `json:"require_encryption" yaml:"require_encryption"`
 	
 	// Logging settings
 	LogLevel  string `json:"log_level" yaml:"log_level"`
@@ -54,16 +104,35 @@ func (d *JSONDuration) UnmarshalJSON(data []byte) error {
 // Default returns a configuration with sensible defaults
 func Default() *Config {
 	return &Config{
-		ListenAddr:        "localhost:0",
-		Peers:             []string{},
-		MaxConnections:    50,
-		ConnectTimeout:    JSONDuration(10 * time.Second),
-		HeartbeatInterval: JSONDuration(30 * time.Second),
-		HeartbeatTimeout:  JSONDuration(5 * time.Second),
-		MessageBufferSize: 16,
-		DedupCacheSize:    100,
-		LogLevel:          "info",
-		LogFormat:         "text",
+		ListenAddr:           "localhost:0",
+		Peers:                []string{},
+		MaxConnections:       50,
+		MaxOutbound:          0,
+		ConnectTimeout:       JSONDuration(10 * time.Second),
+		HeartbeatInterval:    JSONDuration(30 * time.Second),
+		HeartbeatTimeout:     JSONDuration(5 * time.Second),
+		PhiThreshold:         8,
+		PhiWindowSize:        100,
+		IndirectProbes:       3,
+		SuspicionTimeout:     JSONDuration(30 * time.Second),
+		ReconnectBaseDelay:   JSONDuration(time.Second),
+		ReconnectMaxDelay:    JSONDuration(5 * time.Minute),
+		ReconnectInterval:    JSONDuration(5 * time.Second),
+		ReconnectPolicy:      BackoffExponential,
+		BreakerThreshold:     5,
+		MessageBufferSize:    16,
+		DedupCacheSize:       100,
+		MaxFrameSize:         1 << 20,
+		MessageTTL:           16,
+		OverflowPolicy:       OverflowDropNewest,
+		PeerExchangeInterval: JSONDuration(30 * time.Second),
+		TargetDegree:         8,
+		AddressBookSize:      1000,
+		DiscoveryAddr:        "239.255.42.99:9999",
+		DiscoveryInterval:    JSONDuration(10 * time.Second),
+		DHTRefreshInterval:   JSONDuration(15 * time.Minute),
+		LogLevel:             "info",
+		LogFormat:            "text",
 	}
 }
 
@@ -110,12 +179,22 @@ func LoadFromEnv() *Config {
 		}
 	}
 	
+	if identityFile := os.Getenv("P2P_IDENTITY_FILE"); identityFile != "" {
+		config.IdentityFile = identityFile
+	}
+	
 	if maxConn := os.Getenv("P2P_MAX_CONNECTIONS"); maxConn != "" {
 		if val, err := strconv.Atoi(maxConn); err == nil {
 			config.MaxConnections = val
 		}
 	}
 	
+	if maxOut := os.Getenv("P2P_MAX_OUTBOUND"); maxOut != "" {
+		if val, err := strconv.Atoi(maxOut); err == nil {
+			config.MaxOutbound = val
+		}
+	}
+	
 	if timeout := os.Getenv("P2P_CONNECT_TIMEOUT"); timeout != "" {
 		if val, err := time.ParseDuration(timeout); err == nil {
 			config.ConnectTimeout = JSONDuration(val)
@@ -134,6 +213,58 @@ func LoadFromEnv() *Config {
 		}
 	}
 	
+	if threshold := os.Getenv("P2P_PHI_THRESHOLD"); threshold != "" {
+		if val, err := strconv.ParseFloat(threshold, 64); err == nil {
+			config.PhiThreshold = val
+		}
+	}
+	
+	if window := os.Getenv("P2P_PHI_WINDOW_SIZE"); window != "" {
+		if val, err := strconv.Atoi(window); err == nil {
+			config.PhiWindowSize = val
+		}
+	}
+	
+	if probes := os.Getenv("P2P_INDIRECT_PROBES"); probes != "" {
+		if val, err := strconv.Atoi(probes); err == nil {
+			config.IndirectProbes = val
+		}
+	}
+	
+	if timeout := os.Getenv("P2P_SUSPICION_TIMEOUT"); timeout != "" {
+		if val, err := time.ParseDuration(timeout); err == nil {
+			config.SuspicionTimeout = JSONDuration(val)
+		}
+	}
+	
+	if delay := os.Getenv("P2P_RECONNECT_BASE_DELAY"); delay != "" {
+		if val, err := time.ParseDuration(delay); err == nil {
+			config.ReconnectBaseDelay = JSONDuration(val)
+		}
+	}
+	
+	if delay := os.Getenv("P2P_RECONNECT_MAX_DELAY"); delay != "" {
+		if val, err := time.ParseDuration(delay); err == nil {
+			config.ReconnectMaxDelay = JSONDuration(val)
+		}
+	}
+	
+	if interval := os.Getenv("P2P_RECONNECT_INTERVAL"); interval != "" {
+		if val, err := time.ParseDuration(interval); err == nil {
+			config.ReconnectInterval = JSONDuration(val)
+		}
+	}
+	
+	if policy := os.Getenv("P2P_RECONNECT_POLICY"); policy != "" {
+		config.ReconnectPolicy = policy
+	}
+	
+	if threshold := os.Getenv("P2P_BREAKER_THRESHOLD"); threshold != "" {
+		if val, err := strconv.Atoi(threshold); err == nil {
+			config.BreakerThreshold = val
+		}
+	}
+	
 	if bufSize := os.Getenv("P2P_MESSAGE_BUFFER_SIZE"); bufSize != "" {
 		if val, err := strconv.Atoi(bufSize); err == nil {
 			config.MessageBufferSize = val
@@ -146,6 +277,82 @@ func LoadFromEnv() *Config {
 		}
 	}
 	
+	if overflow := os.Getenv("P2P_OVERFLOW_POLICY"); overflow != "" {
+		config.OverflowPolicy = overflow
+	}
+	
+	if spill := os.Getenv("P2P_SPILL_FILE"); spill != "" {
+		config.SpillFile = spill
+	}
+	
+	if frameSize := os.Getenv("P2P_MAX_FRAME_SIZE"); frameSize != "" {
+		if val, err := strconv.Atoi(frameSize); err == nil {
+			config.MaxFrameSize = val
+		}
+	}
+	
+	if ttl := os.Getenv("P2P_MESSAGE_TTL"); ttl != "" {
+		if val, err := strconv.Atoi(ttl); err == nil {
+			config.MessageTTL = val
+		}
+	}
+	
+	if interval := os.Getenv("P2P_PEER_EXCHANGE_INTERVAL"); interval != "" {
+		if val, err := time.ParseDuration(interval); err == nil {
+			config.PeerExchangeInterval = JSONDuration(val)
+		}
+	}
+	
+	if degree := os.Getenv("P2P_TARGET_DEGREE"); degree != "" {
+		if val, err := strconv.Atoi(degree); err == nil {
+			config.TargetDegree = val
+		}
+	}
+	
+	if bookSize := os.Getenv("P2P_ADDRESS_BOOK_SIZE"); bookSize != "" {
+		if val, err := strconv.Atoi(bookSize); err == nil {
+			config.AddressBookSize = val
+		}
+	}
+	
+	if bookFile := os.Getenv("P2P_ADDRESS_BOOK_FILE"); bookFile != "" {
+		config.AddressBookFile = bookFile
+	}
+	
+	if discovery := os.Getenv("P2P_DISCOVERY_ENABLED"); discovery != "" {
+		if val, err := strconv.ParseBool(discovery); err == nil {
+			config.DiscoveryEnabled = val
+		}
+	}
+	
+	if discoveryAddr := os.Getenv("P2P_DISCOVERY_ADDR"); discoveryAddr != "" {
+		config.DiscoveryAddr = discoveryAddr
+	}
+	
+	if interval := os.Getenv("P2P_DISCOVERY_INTERVAL"); interval != "" {
+		if val, err := time.ParseDuration(interval); err == nil {
+			config.DiscoveryInterval = JSONDuration(val)
+		}
+	}
+	
+	if interval := os.Getenv("P2P_DHT_REFRESH_INTERVAL"); interval != "" {
+		if val, err := time.ParseDuration(interval); err == nil {
+			config.DHTRefreshInterval = JSONDuration(val)
+		}
+	}
+	
+	if requireSigned := os.Getenv("P2P_REQUIRE_SIGNED_MESSAGES"); requireSigned != "" {
+		if val, err := strconv.ParseBool(requireSigned); err == nil {
+			config.RequireSignedMessages = val
+		}
+	}
+	
+	if requireEncryption := os.Getenv("P2P_REQUIRE_ENCRYPTION"); requireEncryption != "" {
+		if val, err := strconv.ParseBool(requireEncryption); err == nil {
+			config.RequireEncryption = val
+		}
+	}
+	
 	if level := os.Getenv("P2P_LOG_LEVEL"); level != "" {
 		config.LogLevel = level
 	}
@@ -196,6 +403,10 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("max_connections must be at least 1")
 	}
 	
+	if c.MaxOutbound < 0 || c.MaxOutbound >= c.MaxConnections {
+		return fmt.Errorf("max_outbound must be between 0 and max_connections - 1, leaving room for inbound connections")
+	}
+	
 	if time.Duration(c.ConnectTimeout) <= 0 {
 		return fmt.Errorf("connect_timeout must be positive")
 	}
@@ -208,6 +419,45 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("heartbeat_timeout must be positive")
 	}
 	
+	if c.PhiThreshold <= 0 {
+		return fmt.Errorf("phi_threshold must be positive")
+	}
+	
+	if c.PhiWindowSize < 2 {
+		return fmt.Errorf("phi_window_size must be at least 2")
+	}
+	
+	if c.IndirectProbes < 0 {
+		return fmt.Errorf("indirect_probes must not be negative")
+	}
+	
+	if time.Duration(c.SuspicionTimeout) <= 0 {
+		return fmt.Errorf("suspicion_timeout must be positive")
+	}
+	
+	if time.Duration(c.ReconnectBaseDelay) <= 0 {
+		return fmt.Errorf("reconnect_base_delay must be positive")
+	}
+	
+	if c.ReconnectMaxDelay < c.ReconnectBaseDelay {
+		return fmt.Errorf("reconnect_max_delay must be at least reconnect_base_delay")
+	}
+	
+	if time.Duration(c.ReconnectInterval) <= 0 {
+		return fmt.Errorf("reconnect_interval must be positive")
+	}
+	
+	validPolicies := map[string]bool{
+		BackoffExponential: true, BackoffDecorrelated: true, BackoffConstant: true,
+	}
+	if !validPolicies[c.ReconnectPolicy] {
+		return fmt.Errorf("invalid reconnect_policy: %s (must be exponential, decorrelated, or constant)", c.ReconnectPolicy)
+	}
+	
+	if c.BreakerThreshold < 0 {
+		return fmt.Errorf("breaker_threshold must not be negative")
+	}
+	
 	if c.MessageBufferSize < 1 {
 		return fmt.Errorf("message_buffer_size must be at least 1")
 	}
@@ -216,6 +466,47 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("dedup_cache_size must be at least 1")
 	}
 	
+	validOverflow := map[string]bool{
+		OverflowBlock: true, OverflowDropOldest: true, OverflowDropNewest: true, OverflowSpill: true,
+	}
+	if !validOverflow[c.OverflowPolicy] {
+		return fmt.Errorf("invalid overflow_policy: %s (must be block, drop-oldest, drop-newest, or spill)", c.OverflowPolicy)
+	}
+	
+	if c.MaxFrameSize < 1 {
+		return fmt.Errorf("max_frame_size must be at least 1")
+	}
+	
+	if c.MessageTTL < 1 {
+		return fmt.Errorf("message_ttl must be at least 1")
+	}
+	
+	if time.Duration(c.PeerExchangeInterval) <= 0 {
+		return fmt.Errorf("peer_exchange_interval must be positive")
+	}
+	
+	if c.TargetDegree < 0 {
+		return fmt.Errorf("target_degree cannot be negative")
+	}
+	
+	if c.AddressBookSize < 1 {
+		return fmt.Errorf("address_book_size must be at least 1")
+	}
+	
+	if c.DiscoveryEnabled {
+		addr, err := net.ResolveUDPAddr("udp", c.DiscoveryAddr)
+		if err != nil || !addr.IP.IsMulticast() {
+			return fmt.Errorf("discovery_addr must be a multicast group:port")
+		}
+		if time.Duration(c.DiscoveryInterval) < time.Second {
+			return fmt.Errorf("discovery_interval must be at least 1s")
+		}
+	}
+	
+	if time.Duration(c.DHTRefreshInterval) <= 0 {
+		return fmt.Errorf("dht_refresh_interval must be positive")
+	}
+	
 	validLogLevels := map[string]bool{
 		"debug": true, "info": true, "warn": true, "error": true,
 	}
@@ -233,6 +524,16 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// OutboundLimit returns how many connections the node may dial itself:
+// MaxOutbound if set, otherwise a third of MaxConnections. Zero, for very
+// small limits, lets both directions share every slot.
+func (c *Config) OutboundLimit() int {
+	if c.MaxOutbound > 0 {
+		return c.MaxOutbound
+	}
+	return c.MaxConnections / 3
+}
+
 // SaveToFile saves the configuration to a JSON file
 func (c *Config) SaveToFile(path string) error {
 	data, err := json.MarshalIndent(c, "", "  ")
@@ -255,9 +556,15 @@ func mergeConfigs(base, env *Config) {
 	if len(env.Peers) > 0 {
 		base.Peers = env.Peers
 	}
+	if env.IdentityFile != Default().IdentityFile {
+		base.IdentityFile = env.IdentityFile
+	}
 	if env.MaxConnections != Default().MaxConnections {
 		base.MaxConnections = env.MaxConnections
 	}
+	if env.MaxOutbound != Default().MaxOutbound {
+		base.MaxOutbound = env.MaxOutbound
+	}
 	if env.ConnectTimeout != Default().ConnectTimeout {
 		base.ConnectTimeout = env.ConnectTimeout
 	}
@@ -267,12 +574,81 @@ func mergeConfigs(base, env *Config) {
 	if env.HeartbeatTimeout != Default().HeartbeatTimeout {
 		base.HeartbeatTimeout = env.HeartbeatTimeout
 	}
+	if env.PhiThreshold != Default().PhiThreshold {
+		base.PhiThreshold = env.PhiThreshold
+	}
+	if env.PhiWindowSize != Default().PhiWindowSize {
+		base.PhiWindowSize = env.PhiWindowSize
+	}
+	if env.IndirectProbes != Default().IndirectProbes {
+		base.IndirectProbes = env.IndirectProbes
+	}
+	if env.SuspicionTimeout != Default().SuspicionTimeout {
+		base.SuspicionTimeout = env.SuspicionTimeout
+	}
+	if env.ReconnectBaseDelay != Default().ReconnectBaseDelay {
+		base.ReconnectBaseDelay = env.ReconnectBaseDelay
+	}
+	if env.ReconnectMaxDelay != Default().ReconnectMaxDelay {
+		base.ReconnectMaxDelay = env.ReconnectMaxDelay
+	}
+	if env.ReconnectInterval != Default().ReconnectInterval {
+		base.ReconnectInterval = env.ReconnectInterval
+	}
+	if env.ReconnectPolicy != Default().ReconnectPolicy {
+		base.ReconnectPolicy = env.ReconnectPolicy
+	}
+	if env.BreakerThreshold != Default().BreakerThreshold {
+		base.BreakerThreshold = env.BreakerThreshold
+	}
 	if env.MessageBufferSize != Default().MessageBufferSize {
 		base.MessageBufferSize = env.MessageBufferSize
 	}
 	if env.DedupCacheSize != Default().DedupCacheSize {
 		base.DedupCacheSize = env.DedupCacheSize
 	}
+	if env.OverflowPolicy != Default().OverflowPolicy {
+		base.OverflowPolicy = env.OverflowPolicy
+	}
+	if env.SpillFile != Default().SpillFile {
+		base.SpillFile = env.SpillFile
+	}
+	if env.MaxFrameSize != Default().MaxFrameSize {
+		base.MaxFrameSize = env.MaxFrameSize
+	}
+	if env.MessageTTL != Default().MessageTTL {
+		base.MessageTTL = env.MessageTTL
+	}
+	if env.PeerExchangeInterval != Default().PeerExchangeInterval {
+		base.PeerExchangeInterval = env.PeerExchangeInterval
+	}
+	if env.TargetDegree != Default().TargetDegree {
+		base.TargetDegree = env.TargetDegree
+	}
+	if env.AddressBookSize != Default().AddressBookSize {
+		base.AddressBookSize = env.AddressBookSize
+	}
+	if env.AddressBookFile != Default().AddressBookFile {
+		base.AddressBookFile = env.AddressBookFile
+	}
+	if env.DiscoveryEnabled != Default().DiscoveryEnabled {
+		base.DiscoveryEnabled = env.DiscoveryEnabled
+	}
+	if env.DiscoveryAddr != Default().DiscoveryAddr {
+		base.DiscoveryAddr = env.DiscoveryAddr
+	}
+	if env.DiscoveryInterval != Default().DiscoveryInterval {
+		base.DiscoveryInterval = env.DiscoveryInterval
+	}
+	if env.DHTRefreshInterval != Default().DHTRefreshInterval {
+		base.DHTRefreshInterval = env.DHTRefreshInterval
+	}
+	if env.RequireSignedMessages != Default().RequireSignedMessages {
+		base.RequireSignedMessages = env.RequireSignedMessages
+	}
+	if env.RequireEncryption != Default().RequireEncryption {
+		base.RequireEncryption = env.RequireEncryption
+	}
 	if env.LogLevel != Default().LogLevel {
 		base.LogLevel = env.LogLevel
 	}
@@ -326,10 +702,16 @@ func parseYAML(data []byte, config *Config) error {
 					}
 				}
 			}
+		case "identity_file":
+			config.IdentityFile = value
 		case "max_connections":
 			if val, err := strconv.Atoi(value); err == nil {
 				config.MaxConnections = val
 			}
+		case "max_outbound":
+			if val, err := strconv.Atoi(value); err == nil {
+				config.MaxOutbound = val
+			}
 		case "connect_timeout":
 			if val, err := time.ParseDuration(value); err == nil {
 				config.ConnectTimeout = JSONDuration(val)
@@ -342,6 +724,40 @@ func parseYAML(data []byte, config *Config) error {
 			if val, err := time.ParseDuration(value); err == nil {
 				config.HeartbeatTimeout = JSONDuration(val)
 			}
+		case "phi_threshold":
+			if val, err := strconv.ParseFloat(value, 64); err == nil {
+				config.PhiThreshold = val
+			}
+		case "phi_window_size":
+			if val, err := strconv.Atoi(value); err == nil {
+				config.PhiWindowSize = val
+			}
+		case "indirect_probes":
+			if val, err := strconv.Atoi(value); err == nil {
+				config.IndirectProbes = val
+			}
+		case "suspicion_timeout":
+			if val, err := time.ParseDuration(value); err == nil {
+				config.SuspicionTimeout = JSONDuration(val)
+			}
+		case "reconnect_base_delay":
+			if val, err := time.ParseDuration(value); err == nil {
+				config.ReconnectBaseDelay = JSONDuration(val)
+			}
+		case "reconnect_max_delay":
+			if val, err := time.ParseDuration(value); err == nil {
+				config.ReconnectMaxDelay = JSONDuration(val)
+			}
+		case "reconnect_interval":
+			if val, err := time.ParseDuration(value); err == nil {
+				config.ReconnectInterval = JSONDuration(val)
+			}
+		case "reconnect_policy":
+			config.ReconnectPolicy = value
+		case "breaker_threshold":
+			if val, err := strconv.Atoi(value); err == nil {
+				config.BreakerThreshold = val
+			}
 		case "message_buffer_size":
 			if val, err := strconv.Atoi(value); err == nil {
 				config.MessageBufferSize = val
@@ -350,6 +766,54 @@ func parseYAML(data []byte, config *Config) error {
 			if val, err := strconv.Atoi(value); err == nil {
 				config.DedupCacheSize = val
 			}
+		case "overflow_policy":
+			config.OverflowPolicy = value
+		case "spill_file":
+			config.SpillFile = value
+		case "max_frame_size":
+			if val, err := strconv.Atoi(value); err == nil {
+				config.MaxFrameSize = val
+			}
+		case "message_ttl":
+			if val, err := strconv.Atoi(value); err == nil {
+				config.MessageTTL = val
+			}
+		case "peer_exchange_interval":
+			if val, err := time.ParseDuration(value); err == nil {
+				config.PeerExchangeInterval = JSONDuration(val)
+			}
+		case "target_degree":
+			if val, err := strconv.Atoi(value); err == nil {
+				config.TargetDegree = val
+			}
+		case "address_book_size":
+			if val, err := strconv.Atoi(value); err == nil {
+				config.AddressBookSize = val
+			}
+		case "address_book_file":
+			config.AddressBookFile = value
+		case "discovery_enabled":
+			if val, err := strconv.ParseBool(value); err == nil {
+				config.DiscoveryEnabled = val
+			}
+		case "discovery_addr":
+			config.DiscoveryAddr = value
+		case "discovery_interval":
+			if val, err := time.ParseDuration(value); err == nil {
+				config.DiscoveryInterval = JSONDuration(val)
+			}
+		case "dht_refresh_interval":
+			if val, err := time.ParseDuration(value); err == nil {
+				config.DHTRefreshInterval = JSONDuration(val)
+			}
+		case "require_signed_messages":
+			if val, err := strconv.ParseBool(value); err == nil {
+				config.RequireSignedMessages = val
+			}
+		case "require_encryption":
+			if val, err := strconv.ParseBool(value); err == nil {
+				config.RequireEncryption = val
+			}
 		case "log_level":
 			config.LogLevel = value
 		case "log_format":
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -117,6 +118,27 @@ log_format: "json"`
 	}
 }
 
+func TestLoadFromFileYAMLSchemePeers(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	yamlConfig := `listen_addr: "ws://0.0.0.0:8080/p2p"
+peers: ["tcp://localhost:9091", "ws://relay.example.com:80/p2p", "unix:///tmp/p2p.sock"]`
+	if err := os.WriteFile(configFile, []byte(yamlConfig), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	config, err := LoadFromFile(configFile)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if config.ListenAddr != "ws://0.0.0.0:8080/p2p" {
+		t.Errorf("expected ws listen_addr, got %s", config.ListenAddr)
+	}
+	expectedPeers := []string{"tcp://localhost:9091", "ws://relay.example.com:80/p2p", "unix:///tmp/p2p.sock"}
+	if !reflect.DeepEqual(config.Peers, expectedPeers) {
+		t.Errorf("expected peers %v, got %v", expectedPeers, config.Peers)
+	}
+}
+
 func TestLoadFromFileInvalidFormat(t *testing.T) {
 	tempDir := t.TempDir()
 	configFile := filepath.Join(tempDir, "config.txt")
@@ -270,103 +292,184 @@ func TestLoad(t *testing.T) {
 }
 
 func TestValidate(t *testing.T) {
+	// Each case changes one field of a valid config; wantErr names the
+	// field the error must mention, or is empty if the config is valid.
 	tests := []struct {
 		name    string
 		config  *Config
-		wantErr bool
+		wantErr string
 	}{
 		{
 			name:    "valid config",
 			config:  Default(),
-			wantErr: false,
+			wantErr: "",
 		},
 		{
 			name: "empty listen addr",
-			config: &Config{
-				ListenAddr:        "",
-				MaxConnections:    1,
-				ConnectTimeout:    JSONDuration(time.Second),
-				HeartbeatInterval: JSONDuration(time.Second),
-				HeartbeatTimeout:  JSONDuration(time.Second),
-				MessageBufferSize: 1,
-				DedupCacheSize:    1,
-				LogLevel:          "info",
-				LogFormat:         "text",
-			},
-			wantErr: true,
+			config: func() *Config {
+				c := Default()
+				c.ListenAddr = ""
+				return c
+			}(),
+			wantErr: "listen_addr",
 		},
 		{
 			name: "zero max connections",
-			config: &Config{
-				ListenAddr:        "localhost:0",
-				MaxConnections:    0,
-				ConnectTimeout:    JSONDuration(time.Second),
-				HeartbeatInterval: JSONDuration(time.Second),
-				HeartbeatTimeout:  JSONDuration(time.Second),
-				MessageBufferSize: 1,
-				DedupCacheSize:    1,
-				LogLevel:          "info",
-				LogFormat:         "text",
-			},
-			wantErr: true,
+			config: func() *Config {
+				c := Default()
+				c.MaxConnections = 0
+				return c
+			}(),
+			wantErr: "max_connections",
 		},
 		{
 			name: "zero connect timeout",
-			config: &Config{
-				ListenAddr:        "localhost:0",
-				MaxConnections:    1,
-				ConnectTimeout:    JSONDuration(0),
-				HeartbeatInterval: JSONDuration(time.Second),
-				HeartbeatTimeout:  JSONDuration(time.Second),
-				MessageBufferSize: 1,
-				DedupCacheSize:    1,
-				LogLevel:          "info",
-				LogFormat:         "text",
-			},
-			wantErr: true,
+			config: func() *Config {
+				c := Default()
+				c.ConnectTimeout = 0
+				return c
+			}(),
+			wantErr: "connect_timeout",
+		},
+		{
+			name: "zero max frame size",
+			config: func() *Config {
+				c := Default()
+				c.MaxFrameSize = 0
+				return c
+			}(),
+			wantErr: "max_frame_size",
+		},
+		{
+			name: "zero message ttl",
+			config: func() *Config {
+				c := Default()
+				c.MessageTTL = 0
+				return c
+			}(),
+			wantErr: "message_ttl",
+		},
+		{
+			name: "zero phi threshold",
+			config: func() *Config {
+				c := Default()
+				c.PhiThreshold = 0
+				return c
+			}(),
+			wantErr: "phi_threshold",
+		},
+		{
+			name: "phi window too small",
+			config: func() *Config {
+				c := Default()
+				c.PhiWindowSize = 1
+				return c
+			}(),
+			wantErr: "phi_window_size",
+		},
+		{
+			name: "reconnect max delay below base delay",
+			config: func() *Config {
+				c := Default()
+				c.ReconnectBaseDelay = JSONDuration(time.Minute)
+				c.ReconnectMaxDelay = JSONDuration(time.Second)
+				return c
+			}(),
+			wantErr: "reconnect_max_delay",
+		},
+		{
+			name: "invalid reconnect policy",
+			config: func() *Config {
+				c := Default()
+				c.ReconnectPolicy = "linear"
+				return c
+			}(),
+			wantErr: "reconnect_policy",
+		},
+		{
+			name: "invalid overflow policy",
+			config: func() *Config {
+				c := Default()
+				c.OverflowPolicy = "drop-all"
+				return c
+			}(),
+			wantErr: "overflow_policy",
+		},
+		{
+			name: "max outbound above max connections",
+			config: func() *Config {
+				c := Default()
+				c.MaxOutbound = c.MaxConnections + 1
+				return c
+			}(),
+			wantErr: "max_outbound",
+		},
+		{
+			name: "max outbound leaves no inbound slots",
+			config: func() *Config {
+				c := Default()
+				c.MaxOutbound = c.MaxConnections
+				return c
+			}(),
+			wantErr: "max_outbound",
+		},
+		{
+			name: "small max connections with default max outbound",
+			config: func() *Config {
+				c := Default()
+				c.MaxConnections = 10
+				return c
+			}(),
+			wantErr: "",
 		},
 		{
 			name: "invalid log level",
-			config: &Config{
-				ListenAddr:        "localhost:0",
-				MaxConnections:    1,
-				ConnectTimeout:    JSONDuration(time.Second),
-				HeartbeatInterval: JSONDuration(time.Second),
-				HeartbeatTimeout:  JSONDuration(time.Second),
-				MessageBufferSize: 1,
-				DedupCacheSize:    1,
-				LogLevel:          "invalid",
-				LogFormat:         "text",
-			},
-			wantErr: true,
+			config: func() *Config {
+				c := Default()
+				c.LogLevel = "invalid"
+				return c
+			}(),
+			wantErr: "log_level",
 		},
 		{
 			name: "invalid log format",
-			config: &Config{
-				ListenAddr:        "localhost:0",
-				MaxConnections:    1,
-				ConnectTimeout:    JSONDuration(time.Second),
-				HeartbeatInterval: JSONDuration(time.Second),
-				HeartbeatTimeout:  JSONDuration(time.Second),
-				MessageBufferSize: 1,
-				DedupCacheSize:    1,
-				LogLevel:          "info",
-				LogFormat:         "invalid",
-			},
-			wantErr: true,
+			config: func() *Config {
+				c := Default()
+				c.LogFormat = "invalid"
+				return c
+			}(),
+			wantErr: "log_format",
 		},
 	}
 	
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			err := tt.config.Validate()
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want an error about %s", err, tt.wantErr)
 			}
 		})
 	}
 }
 
+func TestOutboundLimit(t *testing.T) {
+	c := Default()
+	c.MaxConnections = 10
+	if got := c.OutboundLimit(); got != 3 {
+		t.Errorf("expected a third of max_connections, got %d", got)
+	}
+	c.MaxOutbound = 8
+	if got := c.OutboundLimit(); got != 8 {
+		t.Errorf("expected max_outbound 8, got %d", got)
+	}
+}
+
 func TestSaveToFile(t *testing.T) {
 	tempDir := t.TempDir()
 	configFile := filepath.Join(tempDir, "save_test.json")
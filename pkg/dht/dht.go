@@ -0,0 +1,317 @@
+package dht
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+// IDLength is the length of a peer ID in bytes.
+const IDLength = 16
+
+// K is the number of contacts kept per bucket and returned by a lookup.
+const K = 20
+
+// Alpha is the number of queries a lookup keeps in flight.
+const Alpha = 3
+
+// ID is a peer ID as a 128-bit number.
+type ID [IDLength]byte
+
+// ParseID decodes a hex peer ID.
+func ParseID(s string) (ID, error) {
+	var id ID
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return id, fmt.Errorf("invalid peer ID %q: %w", s, err)
+	}
+	if len(b) != IDLength {
+		return id, fmt.Errorf("invalid peer ID %q: want %d bytes, got %d", s, IDLength, len(b))
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// IsID reports whether s is a well-formed hex peer ID.
+func IsID(s string) bool {
+	_, err := ParseID(s)
+	return err == nil
+}
+
+// String returns the hex encoding of the ID.
+func (id ID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Distance returns the XOR distance between two IDs.
+func Distance(a, b ID) ID {
+	var d ID
+	for i := range d {
+		d[i] = a[i] ^ b[i]
+	}
+	return d
+}
+
+// Closer reports whether a is closer to target than b.
+func Closer(target, a, b ID) bool {
+	da, db := Distance(target, a), Distance(target, b)
+	return bytes.Compare(da[:], db[:]) < 0
+}
+
+// commonPrefixLen returns the number of leading bits a and b share.
+func commonPrefixLen(a, b ID) int {
+	d := Distance(a, b)
+	for i, x := range d {
+		if x != 0 {
+			return i*8 + bits.LeadingZeros8(x)
+		}
+	}
+	return IDLength * 8
+}
+
+// Contact is a peer that can be dialed.
+type Contact struct {
+	ID       string    `json:"id"`
+	Addr     string    `json:"addr"`
+	LastSeen time.Time `json:"-"`
+}
+
+type bucket struct {
+	contacts     []Contact // least recently seen first
+	replacements []Contact // most recently seen last
+	refreshed    time.Time
+}
+
+// RoutingTable holds contacts in k-buckets indexed by the length of the
+// prefix they share with the local ID. A full bucket keeps its long-lived
+// contacts and remembers newcomers as replacements, which take over when a
+// contact is removed.
+type RoutingTable struct {
+	mu      sync.Mutex
+	self    ID
+	k       int
+	buckets [IDLength * 8]*bucket
+}
+
+// NewRoutingTable creates a routing table for the peer with ID self, holding
+// up to k contacts per bucket.
+func NewRoutingTable(self string, k int) (*RoutingTable, error) {
+	id, err := ParseID(self)
+	if err != nil {
+		return nil, err
+	}
+	if k <= 0 {
+		k = K
+	}
+	rt := &RoutingTable{self: id, k: k}
+	now := time.Now()
+	for i := range rt.buckets {
+		rt.buckets[i] = &bucket{refreshed: now}
+	}
+	return rt, nil
+}
+
+// Self returns the local ID.
+func (rt *RoutingTable) Self() ID {
+	return rt.self
+}
+
+// bucketFor returns the bucket for id, or nil for the local ID.
+func (rt *RoutingTable) bucketFor(id ID) *bucket {
+	i := commonPrefixLen(rt.self, id)
+	if i >= len(rt.buckets) {
+		return nil
+	}
+	return rt.buckets[i]
+}
+
+// Update records that c was seen. It reports whether c is in the table
+// afterwards; a newcomer to a full bucket is kept only as a replacement.
+func (rt *RoutingTable) Update(c Contact) bool {
+	id, err := ParseID(c.ID)
+	if err != nil || c.Addr == "" {
+		return false
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	b := rt.bucketFor(id)
+	if b == nil {
+		return false
+	}
+	if c.LastSeen.IsZero() {
+		c.LastSeen = time.Now()
+	}
+	b.refreshed = c.LastSeen
+	if i := indexOf(b.contacts, c.ID); i >= 0 {
+		b.contacts = append(append(b.contacts[:i:i], b.contacts[i+1:]...), c)
+		return true
+	}
+	if len(b.contacts) < rt.k {
+		b.contacts = append(b.contacts, c)
+		return true
+	}
+	if i := indexOf(b.replacements, c.ID); i >= 0 {
+		b.replacements = append(b.replacements[:i:i], b.replacements[i+1:]...)
+	}
+	b.replacements = append(b.replacements, c)
+	if len(b.replacements) > rt.k {
+		b.replacements = b.replacements[1:]
+	}
+	return false
+}
+
+// Remove drops the contact with the given ID, promoting the most recently
+// seen replacement in its place.
+func (rt *RoutingTable) Remove(peerID string) {
+	id, err := ParseID(peerID)
+	if err != nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	b := rt.bucketFor(id)
+	if b == nil {
+		return
+	}
+	if i := indexOf(b.replacements, peerID); i >= 0 {
+		b.replacements = append(b.replacements[:i:i], b.replacements[i+1:]...)
+	}
+	i := indexOf(b.contacts, peerID)
+	if i < 0 {
+		return
+	}
+	b.contacts = append(b.contacts[:i:i], b.contacts[i+1:]...)
+	if n := len(b.replacements); n > 0 {
+		b.contacts = append(b.contacts, b.replacements[n-1])
+		b.replacements = b.replacements[:n-1]
+	}
+}
+
+// Find returns the contact with the given ID.
+func (rt *RoutingTable) Find(peerID string) (Contact, bool) {
+	id, err := ParseID(peerID)
+	if err != nil {
+		return Contact{}, false
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	b := rt.bucketFor(id)
+	if b == nil {
+		return Contact{}, false
+	}
+	if i := indexOf(b.contacts, peerID); i >= 0 {
+		return b.contacts[i], true
+	}
+	return Contact{}, false
+}
+
+// Closest returns up to n contacts ordered by distance to target.
+func (rt *RoutingTable) Closest(target ID, n int) []Contact {
+	rt.mu.Lock()
+	var all []Contact
+	for _, b := range rt.buckets {
+		all = append(all, b.contacts...)
+	}
+	rt.mu.Unlock()
+	sortByDistance(target, all)
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// Len returns the number of contacts in the table.
+func (rt *RoutingTable) Len() int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	n := 0
+	for _, b := range rt.buckets {
+		n += len(b.contacts)
+	}
+	return n
+}
+
+// StaleTargets returns a random ID in the range of each bucket that has not
+// been updated or refreshed for maxAge, up to the deepest bucket holding
+// contacts. Looking these IDs up refreshes the buckets.
+func (rt *RoutingTable) StaleTargets(maxAge time.Duration) []ID {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	deepest := -1
+	for i, b := range rt.buckets {
+		if len(b.contacts) > 0 {
+			deepest = i
+		}
+	}
+	var targets []ID
+	now := time.Now()
+	for i := 0; i <= deepest; i++ {
+		if now.Sub(rt.buckets[i].refreshed) >= maxAge {
+			targets = append(targets, rt.randomIDInBucket(i))
+		}
+	}
+	return targets
+}
+
+// MarkRefreshed records that the bucket covering target was just looked up.
+func (rt *RoutingTable) MarkRefreshed(target ID) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if b := rt.bucketFor(target); b != nil {
+		b.refreshed = time.Now()
+	}
+}
+
+// randomIDInBucket returns a random ID sharing exactly i leading bits with
+// the local ID.
+func (rt *RoutingTable) randomIDInBucket(i int) ID {
+	var id ID
+	rand.Read(id[:])
+	for bit := 0; bit <= i; bit++ {
+		byteIdx, mask := bit/8, byte(0x80>>(bit%8))
+		want := rt.self[byteIdx] & mask
+		if bit == i {
+			want ^= mask
+		}
+		id[byteIdx] = id[byteIdx]&^mask | want
+	}
+	return id
+}
+
+func indexOf(contacts []Contact, id string) int {
+	for i, c := range contacts {
+		if c.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortByDistance orders contacts by distance to target. Contacts with
+// malformed IDs sort last.
+func sortByDistance(target ID, contacts []Contact) {
+	type keyed struct {
+		c    Contact
+		dist ID
+		ok   bool
+	}
+	keys := make([]keyed, len(contacts))
+	for i, c := range contacts {
+		id, err := ParseID(c.ID)
+		keys[i] = keyed{c: c, dist: Distance(target, id), ok: err == nil}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].ok != keys[j].ok {
+			return keys[i].ok
+		}
+		return bytes.Compare(keys[i].dist[:], keys[j].dist[:]) < 0
+	})
+	for i := range keys {
+		contacts[i] = keys[i].c
+	}
+}
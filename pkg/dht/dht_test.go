@@ -0,0 +1,126 @@
+package dht
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// idWithPrefix returns an ID equal to 00…0 except for the given first byte
+// and last byte, so tests can place contacts in chosen buckets.
+func idWithPrefix(first, last byte) string {
+	var id ID
+	id[0] = first
+	id[IDLength-1] = last
+	return id.String()
+}
+
+func TestParseID(t *testing.T) {
+	id, err := ParseID("00112233445566778899aabbccddeeff")
+	if err != nil {
+		t.Fatalf("ParseID failed: %v", err)
+	}
+	if id.String() != "00112233445566778899aabbccddeeff" {
+		t.Fatalf("expected round trip, got %s", id)
+	}
+	for _, bad := range []string{"", "xyz", "0011", "localhost:8080", "00112233445566778899aabbccddeeff00"} {
+		if IsID(bad) {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	target, _ := ParseID(idWithPrefix(0, 0))
+	near, _ := ParseID(idWithPrefix(0, 1))
+	far, _ := ParseID(idWithPrefix(0x80, 0))
+	if !Closer(target, near, far) || Closer(target, far, near) {
+		t.Fatal("expected an ID differing in the last bit to be closer than one differing in the first")
+	}
+	if d := Distance(near, near); d != (ID{}) {
+		t.Fatalf("expected zero distance to self, got %s", d)
+	}
+	if n := commonPrefixLen(target, far); n != 0 {
+		t.Fatalf("expected no common prefix, got %d", n)
+	}
+	if n := commonPrefixLen(target, near); n != IDLength*8-1 {
+		t.Fatalf("expected %d common bits, got %d", IDLength*8-1, n)
+	}
+}
+
+func TestRoutingTableBuckets(t *testing.T) {
+	rt, err := NewRoutingTable(idWithPrefix(0, 0), 2)
+	if err != nil {
+		t.Fatalf("NewRoutingTable failed: %v", err)
+	}
+	if rt.Update(Contact{ID: idWithPrefix(0, 0), Addr: "self:1"}) {
+		t.Fatal("expected own ID to be ignored")
+	}
+	if rt.Update(Contact{ID: idWithPrefix(0x80, 1)}) {
+		t.Fatal("expected contact without an address to be ignored")
+	}
+
+	// All of these share no prefix bit with self and land in bucket 0.
+	a, b, c := idWithPrefix(0x80, 1), idWithPrefix(0x80, 2), idWithPrefix(0x80, 3)
+	rt.Update(Contact{ID: a, Addr: "a:1"})
+	rt.Update(Contact{ID: b, Addr: "b:1"})
+	if rt.Update(Contact{ID: c, Addr: "c:1"}) {
+		t.Fatal("expected newcomer to a full bucket to wait as a replacement")
+	}
+	if _, ok := rt.Find(c); ok || rt.Len() != 2 {
+		t.Fatalf("expected full bucket to keep its contacts, got %d", rt.Len())
+	}
+
+	rt.Remove(a)
+	if _, ok := rt.Find(c); !ok {
+		t.Fatal("expected replacement to be promoted")
+	}
+	if _, ok := rt.Find(a); ok {
+		t.Fatal("expected removed contact to be gone")
+	}
+
+	// A contact in another bucket is unaffected by the full one.
+	if !rt.Update(Contact{ID: idWithPrefix(0x01, 1), Addr: "d:1"}) {
+		t.Fatal("expected contact in an empty bucket to be added")
+	}
+}
+
+func TestClosest(t *testing.T) {
+	rt, _ := NewRoutingTable(idWithPrefix(0, 0), K)
+	for i := 1; i <= 10; i++ {
+		rt.Update(Contact{ID: idWithPrefix(byte(i), 0), Addr: fmt.Sprintf("n%d:1", i)})
+	}
+	target, _ := ParseID(idWithPrefix(4, 0))
+	got := rt.Closest(target, 3)
+	want := []string{idWithPrefix(4, 0), idWithPrefix(5, 0), idWithPrefix(6, 0)}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 contacts, got %v", got)
+	}
+	for i := range want {
+		if got[i].ID != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestStaleTargets(t *testing.T) {
+	rt, _ := NewRoutingTable(idWithPrefix(0, 0), K)
+	if got := rt.StaleTargets(0); len(got) != 0 {
+		t.Fatalf("expected no targets for an empty table, got %d", len(got))
+	}
+	rt.Update(Contact{ID: idWithPrefix(0x10, 0), Addr: "a:1"}) // bucket 3
+
+	targets := rt.StaleTargets(0)
+	if len(targets) != 4 {
+		t.Fatalf("expected a target for each of buckets 0-3, got %d", len(targets))
+	}
+	for i, target := range targets {
+		if n := commonPrefixLen(rt.Self(), target); n != i {
+			t.Errorf("expected target %d to share %d bits with self, got %d", i, i, n)
+		}
+	}
+
+	if got := rt.StaleTargets(time.Hour); len(got) != 0 {
+		t.Fatalf("expected freshly created buckets not to be stale, got %d", len(got))
+	}
+}
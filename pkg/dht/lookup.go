@@ -0,0 +1,100 @@
+package dht
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotQueried is wrapped by the error a QueryFunc returns when it did not
+// reach the contact for reasons of its own, for example because it has no
+// free connection slots.
+var ErrNotQueried = errors.New("contact not queried")
+
+// QueryFunc asks contact c for the contacts it knows closest to target.
+type QueryFunc func(ctx context.Context, c Contact, target ID) ([]Contact, error)
+
+// Lookup iteratively searches for the K contacts closest to target. It starts
+// from the closest contacts in rt and repeatedly queries the Alpha closest it
+// has not asked yet, until the K closest it knows of have all answered or
+// ctx is done. Contacts that answer are added to rt; contacts that fail are
+// removed from it, unless the query was not sent (see ErrNotQueried) or the
+// lookup itself was cancelled. The result is ordered by distance to target and holds
+// only contacts that answered.
+func Lookup(ctx context.Context, rt *RoutingTable, target ID, query QueryFunc) []Contact {
+	self := rt.Self().String()
+	shortlist := rt.Closest(target, K)
+	seen := make(map[string]bool, len(shortlist))
+	for _, c := range shortlist {
+		seen[c.ID] = true
+	}
+	queried := make(map[string]bool)
+	answered := make(map[string]bool)
+
+	type result struct {
+		contact  Contact
+		contacts []Contact
+		err      error
+	}
+
+	for ctx.Err() == nil {
+		var batch []Contact
+		pending := 0
+		for _, c := range shortlist {
+			if pending == K {
+				break
+			}
+			pending++
+			if !queried[c.ID] && len(batch) < Alpha {
+				batch = append(batch, c)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		results := make(chan result, len(batch))
+		for _, c := range batch {
+			queried[c.ID] = true
+			go func(c Contact) {
+				contacts, err := query(ctx, c, target)
+				results <- result{c, contacts, err}
+			}(c)
+		}
+		for range batch {
+			r := <-results
+			if r.err != nil {
+				if !errors.Is(r.err, ErrNotQueried) && ctx.Err() == nil {
+					rt.Remove(r.contact.ID)
+				}
+				shortlist = without(shortlist, r.contact.ID)
+				continue
+			}
+			answered[r.contact.ID] = true
+			rt.Update(r.contact)
+			for _, c := range r.contacts {
+				if c.ID == self || seen[c.ID] || !IsID(c.ID) || c.Addr == "" {
+					continue
+				}
+				seen[c.ID] = true
+				shortlist = append(shortlist, c)
+			}
+		}
+		sortByDistance(target, shortlist)
+	}
+
+	rt.MarkRefreshed(target)
+	closest := make([]Contact, 0, K)
+	for _, c := range shortlist {
+		if answered[c.ID] && len(closest) < K {
+			closest = append(closest, c)
+		}
+	}
+	return closest
+}
+
+func without(contacts []Contact, id string) []Contact {
+	if i := indexOf(contacts, id); i >= 0 {
+		return append(contacts[:i:i], contacts[i+1:]...)
+	}
+	return contacts
+}
@@ -0,0 +1,125 @@
+package dht
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// simNetwork is a set of routing tables that answer each other's queries
+// directly.
+type simNetwork struct {
+	tables  map[string]*RoutingTable
+	down    map[string]bool
+	refused map[string]bool
+}
+
+func newSimNetwork(t *testing.T, n int) (*simNetwork, []string) {
+	t.Helper()
+	net := &simNetwork{tables: make(map[string]*RoutingTable), down: make(map[string]bool), refused: make(map[string]bool)}
+	ids := make([]string, n)
+	for i := range ids {
+		var id ID
+		rand.Read(id[:])
+		ids[i] = id.String()
+		net.tables[ids[i]], _ = NewRoutingTable(ids[i], K)
+	}
+	// Each node knows a handful of others, like a sparse mesh.
+	for i, id := range ids {
+		for _, j := range []int{i + 1, i + 7, i + 31} {
+			other := ids[j%n]
+			net.tables[id].Update(Contact{ID: other, Addr: other})
+			net.tables[other].Update(Contact{ID: id, Addr: id})
+		}
+	}
+	// Join the way Kademlia nodes do, by looking themselves up.
+	for _, id := range ids {
+		rt := net.tables[id]
+		Lookup(context.Background(), rt, rt.Self(), net.queryFrom(id))
+	}
+	return net, ids
+}
+
+// queryFrom returns a query function for the node from. Queried nodes learn
+// about the querier, as they would from an incoming connection.
+func (n *simNetwork) queryFrom(from string) QueryFunc {
+	return func(ctx context.Context, c Contact, target ID) ([]Contact, error) {
+		if n.down[c.ID] {
+			return nil, errors.New("unreachable")
+		}
+		if n.refused[c.ID] {
+			return nil, fmt.Errorf("%w: no free slots", ErrNotQueried)
+		}
+		n.tables[c.ID].Update(Contact{ID: from, Addr: from})
+		return n.tables[c.ID].Closest(target, K), nil
+	}
+}
+
+func TestLookupFindsTarget(t *testing.T) {
+	net, ids := newSimNetwork(t, 300)
+	from, want := ids[0], ids[150]
+	target, _ := ParseID(want)
+
+	got := Lookup(context.Background(), net.tables[from], target, net.queryFrom(from))
+	if len(got) == 0 || got[0].ID != want {
+		t.Fatalf("expected lookup to find %s first, got %v", want, got)
+	}
+	if _, ok := net.tables[from].Find(want); !ok {
+		t.Fatal("expected the target to be added to the routing table")
+	}
+	for i := 1; i < len(got); i++ {
+		a, _ := ParseID(got[i-1].ID)
+		b, _ := ParseID(got[i].ID)
+		if Closer(target, b, a) {
+			t.Fatal("expected results ordered by distance")
+		}
+	}
+}
+
+func TestLookupRemovesUnreachable(t *testing.T) {
+	net, ids := newSimNetwork(t, 50)
+	from := ids[0]
+	dead := ids[1]
+	net.down[dead] = true
+	target, _ := ParseID(dead)
+
+	got := Lookup(context.Background(), net.tables[from], target, net.queryFrom(from))
+	for _, c := range got {
+		if c.ID == dead {
+			t.Fatal("expected unreachable contact to be left out of the result")
+		}
+	}
+	if _, ok := net.tables[from].Find(dead); ok {
+		t.Fatal("expected unreachable contact to be removed from the routing table")
+	}
+}
+
+func TestLookupKeepsContactsNotQueried(t *testing.T) {
+	net, ids := newSimNetwork(t, 50)
+	from := ids[0]
+	skipped := net.tables[from].Closest(net.tables[from].Self(), 1)[0].ID
+	net.refused[skipped] = true
+	target, _ := ParseID(skipped)
+
+	got := Lookup(context.Background(), net.tables[from], target, net.queryFrom(from))
+	for _, c := range got {
+		if c.ID == skipped {
+			t.Fatal("expected the contact not queried to be left out of the result")
+		}
+	}
+	if _, ok := net.tables[from].Find(skipped); !ok {
+		t.Fatal("expected the contact not queried to stay in the routing table")
+	}
+}
+
+func TestLookupStopsWhenCancelled(t *testing.T) {
+	net, ids := newSimNetwork(t, 50)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	target, _ := ParseID(ids[25])
+	if got := Lookup(ctx, net.tables[ids[0]], target, net.queryFrom(ids[0])); len(got) != 0 {
+		t.Fatalf("expected no results from a cancelled lookup, got %d", len(got))
+	}
+}
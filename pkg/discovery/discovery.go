@@ -0,0 +1,212 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"example.com/p2p/pkg/config"
+	"example.com/p2p/pkg/transport"
+)
+
+// MinInterval is the shortest time allowed between two announcements.
+const MinInterval = time.Second
+
+// maxPacketSize bounds announcement datagrams; anything longer is dropped.
+const maxPacketSize = 1024
+
+// maxSources bounds the number of senders tracked for rate limiting.
+const maxSources = 1024
+
+// Limits on accepted announcements across all senders: a burst of burst
+// announcements, refilled at rate per second.
+const (
+	burst = 32
+	rate  = 10
+)
+
+// Announcement is the datagram a node multicasts to make itself known.
+type Announcement struct {
+	ID   string `json:"id"`
+	Addr string `json:"addr"`
+}
+
+// Service multicasts this node's announcement on the local network and
+// reports announcements from other nodes. Incoming announcements are rate
+// limited per sender and in total, so a noisy or malicious host cannot make
+// the node dial in a tight loop.
+type Service struct {
+	group    *net.UDPAddr
+	interval time.Duration
+	self     Announcement
+	onPeer   func(Announcement)
+
+	mu      sync.Mutex
+	last    map[string]time.Time // sender address -> last accepted announcement
+	tokens  float64
+	refill  time.Time
+	now     func() time.Time
+	conn    *net.UDPConn
+	send    *net.UDPConn
+	stopCh  chan struct{}
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// New creates a discovery service announcing self on the multicast group
+// configured in cfg. onPeer is called for each accepted announcement from
+// another node, with an unspecified listen host filled in from the sender.
+func New(cfg *config.Config, self Announcement, onPeer func(Announcement)) (*Service, error) {
+	group, err := net.ResolveUDPAddr("udp4", cfg.DiscoveryAddr)
+	if err != nil {
+		return nil, fmt.Errorf("discovery address %s: %w", cfg.DiscoveryAddr, err)
+	}
+	if !group.IP.IsMulticast() {
+		return nil, fmt.Errorf("discovery address %s is not a multicast group", cfg.DiscoveryAddr)
+	}
+	interval := time.Duration(cfg.DiscoveryInterval)
+	if interval < MinInterval {
+		interval = MinInterval
+	}
+	return &Service{
+		group:    group,
+		interval: interval,
+		self:     self,
+		onPeer:   onPeer,
+		last:     make(map[string]time.Time),
+		tokens:   burst,
+		now:      time.Now,
+		stopCh:   make(chan struct{}),
+	}, nil
+}
+
+// Start joins the multicast group and begins announcing.
+func (s *Service) Start() error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, s.group)
+	if err != nil {
+		return fmt.Errorf("join %s: %w", s.group, err)
+	}
+	send, err := net.DialUDP("udp4", nil, s.group)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("dial %s: %w", s.group, err)
+	}
+	s.conn, s.send = conn, send
+	s.refill = s.now()
+
+	s.wg.Add(2)
+	go s.announceLoop()
+	go s.listenLoop()
+	return nil
+}
+
+// Stop leaves the multicast group and stops announcing.
+func (s *Service) Stop() {
+	s.mu.Lock()
+	if s.stopped || s.conn == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	close(s.stopCh)
+	s.conn.Close()
+	s.send.Close()
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Service) announceLoop() {
+	defer s.wg.Done()
+
+	data, err := json.Marshal(s.self)
+	if err != nil {
+		return
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.send.Write(data)
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) listenLoop() {
+	defer s.wg.Done()
+
+	buf := make([]byte, maxPacketSize+1)
+	for {
+		n, src, err := s.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		if n > maxPacketSize {
+			continue
+		}
+		if ann, ok := s.handle(buf[:n], src); ok {
+			s.onPeer(ann)
+		}
+	}
+}
+
+// handle decodes and rate limits an announcement received from src.
+func (s *Service) handle(data []byte, src *net.UDPAddr) (Announcement, bool) {
+	var ann Announcement
+	if err := json.Unmarshal(data, &ann); err != nil || ann.ID == "" || ann.Addr == "" {
+		return Announcement{}, false
+	}
+	if ann.ID == s.self.ID {
+		return Announcement{}, false
+	}
+	if !s.allow(src.String()) {
+		return Announcement{}, false
+	}
+	ann.Addr = transport.ResolveHost(ann.Addr, src)
+	return ann, true
+}
+
+// allow reports whether an announcement from the given sender may be
+// processed. Each sender gets one announcement per half interval, and all
+// senders together share a token bucket.
+func (s *Service) allow(sender string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+
+	if last, ok := s.last[sender]; ok && now.Sub(last) < s.interval/2 {
+		return false
+	}
+
+	s.tokens += now.Sub(s.refill).Seconds() * rate
+	if s.tokens > burst {
+		s.tokens = burst
+	}
+	s.refill = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+
+	if len(s.last) >= maxSources {
+		for k, t := range s.last {
+			if now.Sub(t) >= s.interval/2 {
+				delete(s.last, k)
+			}
+		}
+		if len(s.last) >= maxSources {
+			return false
+		}
+	}
+	s.last[sender] = now
+	return true
+}
@@ -0,0 +1,132 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/config"
+)
+
+func newTestService(t *testing.T, id string) *Service {
+	t.Helper()
+	cfg := config.Default()
+	s, err := New(cfg, Announcement{ID: id, Addr: "0.0.0.0:8080"}, func(Announcement) {})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return s
+}
+
+func TestNewRejectsUnicastAddress(t *testing.T) {
+	cfg := config.Default()
+	cfg.DiscoveryAddr = "127.0.0.1:9999"
+	if _, err := New(cfg, Announcement{ID: "a"}, func(Announcement) {}); err == nil {
+		t.Fatal("expected unicast discovery address to be rejected")
+	}
+}
+
+func TestHandleResolvesHostAndIgnoresSelf(t *testing.T) {
+	s := newTestService(t, "self")
+	src := &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: 40000}
+
+	ann, ok := s.handle([]byte(`{"id":"other","addr":"0.0.0.0:9000"}`), src)
+	if !ok {
+		t.Fatal("expected announcement to be accepted")
+	}
+	if ann.ID != "other" || ann.Addr != "192.168.1.20:9000" {
+		t.Fatalf("unexpected announcement %+v", ann)
+	}
+
+	if _, ok := s.handle([]byte(`{"id":"self","addr":"10.0.0.1:8080"}`), src); ok {
+		t.Fatal("expected own announcement to be ignored")
+	}
+	for _, data := range []string{`not json`, `{"id":"x"}`, `{"addr":"1.2.3.4:5"}`} {
+		if _, ok := s.handle([]byte(data), src); ok {
+			t.Errorf("expected %q to be rejected", data)
+		}
+	}
+}
+
+func TestHandleRateLimitsPerSender(t *testing.T) {
+	s := newTestService(t, "self")
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+	s.refill = now
+	src := &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: 40000}
+	data := []byte(`{"id":"other","addr":"192.168.1.20:9000"}`)
+
+	if _, ok := s.handle(data, src); !ok {
+		t.Fatal("expected first announcement to be accepted")
+	}
+	if _, ok := s.handle(data, src); ok {
+		t.Fatal("expected repeated announcement to be rate limited")
+	}
+	now = now.Add(s.interval)
+	if _, ok := s.handle(data, src); !ok {
+		t.Fatal("expected announcement after an interval to be accepted")
+	}
+}
+
+func TestHandleRateLimitsInTotal(t *testing.T) {
+	s := newTestService(t, "self")
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+	s.refill = now
+
+	accepted := 0
+	for i := 0; i < 2*burst; i++ {
+		src := &net.UDPAddr{IP: net.IPv4(10, 0, byte(i/256), byte(i%256)), Port: 40000}
+		data := []byte(fmt.Sprintf(`{"id":"peer%d","addr":"0.0.0.0:9000"}`, i))
+		if _, ok := s.handle(data, src); ok {
+			accepted++
+		}
+	}
+	if accepted != burst {
+		t.Fatalf("expected %d announcements accepted in a burst, got %d", burst, accepted)
+	}
+
+	now = now.Add(time.Second)
+	src := &net.UDPAddr{IP: net.ParseIP("10.1.0.1"), Port: 40000}
+	if _, ok := s.handle([]byte(`{"id":"late","addr":"0.0.0.0:9000"}`), src); !ok {
+		t.Fatal("expected tokens to refill over time")
+	}
+}
+
+func TestMulticastAnnouncements(t *testing.T) {
+	cfg := config.Default()
+	cfg.DiscoveryAddr = fmt.Sprintf("239.255.42.99:%d", 20000+time.Now().Nanosecond()%20000)
+
+	found := make(chan Announcement, 10)
+	a, err := New(cfg, Announcement{ID: "node-a", Addr: "0.0.0.0:9001"}, func(Announcement) {})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	b, err := New(cfg, Announcement{ID: "node-b", Addr: "0.0.0.0:9002"}, func(ann Announcement) {
+		found <- ann
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := b.Start(); err != nil {
+		t.Skipf("multicast unavailable: %v", err)
+	}
+	defer b.Stop()
+	if err := a.Start(); err != nil {
+		t.Skipf("multicast unavailable: %v", err)
+	}
+	defer a.Stop()
+
+	select {
+	case ann := <-found:
+		if ann.ID != "node-a" {
+			t.Fatalf("expected announcement from node-a, got %+v", ann)
+		}
+		if host, port, _ := net.SplitHostPort(ann.Addr); port != "9001" || net.ParseIP(host).IsUnspecified() {
+			t.Fatalf("expected resolved address for node-a, got %s", ann.Addr)
+		}
+	case <-time.After(3 * time.Second):
+		t.Skip("no multicast announcement received; multicast may not be routed here")
+	}
+}
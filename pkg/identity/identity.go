@@ -0,0 +1,134 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// pemType is the PEM block type used for stored private keys.
+const pemType = "PRIVATE KEY"
+
+// Identity is a node's long-term Ed25519 keypair. The peer ID is derived from
+// the public key, so possession of the private key proves ownership of the ID.
+type Identity struct {
+	privateKey ed25519.PrivateKey
+}
+
+// Generate creates a new random identity.
+func Generate() (*Identity, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	return &Identity{privateKey: priv}, nil
+}
+
+// FromPrivateKey wraps an existing Ed25519 private key.
+func FromPrivateKey(priv ed25519.PrivateKey) (*Identity, error) {
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid private key length %d", len(priv))
+	}
+	return &Identity{privateKey: priv}, nil
+}
+
+// Load reads a PEM-encoded PKCS#8 Ed25519 private key from path.
+func Load(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read identity file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemType {
+		return nil, fmt.Errorf("identity file %s: no %s block found", path, pemType)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse identity key: %w", err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("identity file %s: not an Ed25519 key", path)
+	}
+	return &Identity{privateKey: priv}, nil
+}
+
+// LoadOrGenerate loads the identity stored at path, creating and saving a new
+// one if the file does not exist yet.
+func LoadOrGenerate(path string) (*Identity, error) {
+	id, err := Load(path)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	id, err = Generate()
+	if err != nil {
+		return nil, err
+	}
+	if err := id.Save(path); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// Save writes the private key to path with owner-only permissions.
+func (i *Identity) Save(path string) error {
+	der, err := x509.MarshalPKCS8PrivateKey(i.privateKey)
+	if err != nil {
+		return fmt.Errorf("marshal identity key: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("create identity directory: %w", err)
+		}
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("write identity file: %w", err)
+	}
+	return nil
+}
+
+// ID returns the peer ID derived from the public key.
+func (i *Identity) ID() string {
+	return IDFromPublicKey(i.PublicKey())
+}
+
+// PublicKey returns the identity's public key.
+func (i *Identity) PublicKey() ed25519.PublicKey {
+	return i.privateKey.Public().(ed25519.PublicKey)
+}
+
+// PrivateKey returns the identity's private key.
+func (i *Identity) PrivateKey() ed25519.PrivateKey {
+	return i.privateKey
+}
+
+// Sign signs data with the identity's private key.
+func (i *Identity) Sign(data []byte) []byte {
+	return ed25519.Sign(i.privateKey, data)
+}
+
+// IDFromPublicKey derives a peer ID from an Ed25519 public key. The ID is the
+// hex encoding of the first 16 bytes of the key's SHA-256 hash.
+func IDFromPublicKey(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:16])
+}
+
+// Verify reports whether sig is a valid signature of data by pub.
+func Verify(pub ed25519.PublicKey, data, sig []byte) bool {
+	if len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(pub, data, sig)
+}
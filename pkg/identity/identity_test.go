@@ -0,0 +1,105 @@
+package identity
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateID(t *testing.T) {
+	id, err := Generate()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(id.ID()) != 32 {
+		t.Fatalf("expected 32 character ID, got %d", len(id.ID()))
+	}
+	if id.ID() != IDFromPublicKey(id.PublicKey()) {
+		t.Fatal("ID does not match public key")
+	}
+
+	other, err := Generate()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if id.ID() == other.ID() {
+		t.Fatal("expected distinct identities to have distinct IDs")
+	}
+}
+
+func TestLoadOrGeneratePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "identity.pem")
+
+	first, err := LoadOrGenerate(path)
+	if err != nil {
+		t.Fatalf("first load: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat identity file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	second, err := LoadOrGenerate(path)
+	if err != nil {
+		t.Fatalf("second load: %v", err)
+	}
+	if first.ID() != second.ID() {
+		t.Fatalf("expected stable ID across loads, got %s and %s", first.ID(), second.ID())
+	}
+}
+
+func TestLoadInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.pem")
+	if err := os.WriteFile(path, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for invalid identity file")
+	}
+	if _, err := LoadOrGenerate(path); err == nil {
+		t.Fatal("expected LoadOrGenerate to refuse overwriting an invalid file")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	id, err := Generate()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	data := []byte("hello")
+	sig := id.Sign(data)
+
+	if !Verify(id.PublicKey(), data, sig) {
+		t.Fatal("expected signature to verify")
+	}
+	if Verify(id.PublicKey(), []byte("tampered"), sig) {
+		t.Fatal("expected tampered data to fail verification")
+	}
+	if Verify(nil, data, sig) {
+		t.Fatal("expected missing key to fail verification")
+	}
+}
+
+func TestTLSCertificate(t *testing.T) {
+	id, err := Generate()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	cert, err := id.TLSCertificate()
+	if err != nil {
+		t.Fatalf("certificate: %v", err)
+	}
+	got, err := IDFromCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("id from certificate: %v", err)
+	}
+	if got != id.ID() {
+		t.Fatalf("expected certificate ID %s, got %s", id.ID(), got)
+	}
+	if _, err := IDFromCertificate([]byte("garbage")); err == nil {
+		t.Fatal("expected error for invalid certificate")
+	}
+}
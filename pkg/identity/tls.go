@@ -0,0 +1,55 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// certValidity is the lifetime of generated certificates. Certificates are
+// pinned to the key rather than validated against a CA, so the lifetime only
+// needs to outlast the process.
+const certValidity = 365 * 24 * time.Hour
+
+// TLSCertificate returns a self-signed certificate for the identity's key.
+// Remote peers pin the certificate by deriving the peer ID from its public
+// key rather than verifying it against a CA.
+func (i *Identity) TLSCertificate() (tls.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate serial: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: i.ID()},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, i.PublicKey(), i.privateKey)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: i.privateKey}, nil
+}
+
+// IDFromCertificate derives the peer ID from a DER-encoded certificate
+// presented during a TLS handshake.
+func IDFromCertificate(der []byte) (string, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", fmt.Errorf("parse certificate: %w", err)
+	}
+	pub, ok := cert.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("certificate key is not Ed25519")
+	}
+	return IDFromPublicKey(pub), nil
+}
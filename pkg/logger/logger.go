@@ -158,6 +158,18 @@ func (l *Logger) LogMessageBroadcast(msgType string, seqNo, peerCount int) {
 	)
 }
 
+// LogMessageDropped logs when an incoming message is dropped because the
+// delivery buffer is full
+func (l *Logger) LogMessageDropped(msgType, senderID string, seqNo int, policy string) {
+	l.Warn("Message dropped",
+		"msg_type", msgType,
+		"sender_id", senderID,
+		"seq_no", seqNo,
+		"policy", policy,
+		"event", "message_dropped",
+	)
+}
+
 // LogHeartbeatSent logs when a heartbeat is sent
 func (l *Logger) LogHeartbeatSent(peerID string, seqNo int) {
 	l.Debug("Heartbeat sent",
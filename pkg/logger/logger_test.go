@@ -196,6 +196,7 @@ func TestSpecificLogMethods(t *testing.T) {
 	logger.LogMessageSent("chat", "peer456", 1)
 	logger.LogMessageReceived("chat", "peer456", 1)
 	logger.LogMessageBroadcast("chat", 1, 5)
+	logger.LogMessageDropped("chat", "peer456", 1, "drop-newest")
 	logger.LogHeartbeatSent("peer123", 1)
 	logger.LogHeartbeatReceived("peer123", 1)
 	logger.LogPeerTimedOut("peer123", "2023-01-01T00:00:00Z")
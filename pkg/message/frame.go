@@ -0,0 +1,129 @@
+package message
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxFrameSize is the largest frame accepted when no explicit limit is
+// configured.
+const DefaultMaxFrameSize = 1 << 20 // 1 MiB
+
+// frameHeaderSize is the size of the big-endian length prefix.
+const frameHeaderSize = 4
+
+var (
+	// ErrFrameTooLarge is returned when a frame exceeds the configured maximum.
+	ErrFrameTooLarge = errors.New("frame too large")
+
+	// ErrInvalidMessage is returned by Decoder.Decode when a complete frame
+	// was read but its contents could not be parsed.
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+// WriteFrame writes data to w prefixed with its length. The header and body
+// are written with a single Write call so that concurrent writers on a
+// net.Conn never interleave partial frames.
+func WriteFrame(w io.Writer, data []byte) error {
+	buf := make([]byte, frameHeaderSize+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[frameHeaderSize:], data)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadFrame reads a single length-prefixed frame from r. Frames larger than
+// maxSize are rejected with ErrFrameTooLarge; a maxSize of zero or less uses
+// DefaultMaxFrameSize.
+func ReadFrame(r io.Reader, maxSize int) ([]byte, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if uint64(n) > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: %d bytes (max %d)", ErrFrameTooLarge, n, maxSize)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Encoder writes length-prefixed messages to an output stream.
+type Encoder struct {
+	w            io.Writer
+	maxFrameSize int
+}
+
+// NewEncoder returns an Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, maxFrameSize: DefaultMaxFrameSize}
+}
+
+// SetMaxFrameSize limits the size of encoded messages. Values of zero or less
+// restore DefaultMaxFrameSize.
+func (e *Encoder) SetMaxFrameSize(n int) {
+	if n <= 0 {
+		n = DefaultMaxFrameSize
+	}
+	e.maxFrameSize = n
+}
+
+// Encode marshals msg and writes it as a single frame.
+func (e *Encoder) Encode(msg *Message) error {
+	data, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+	if len(data) > e.maxFrameSize {
+		return fmt.Errorf("%w: %d bytes (max %d)", ErrFrameTooLarge, len(data), e.maxFrameSize)
+	}
+	return WriteFrame(e.w, data)
+}
+
+// Decoder reads length-prefixed messages from an input stream.
+type Decoder struct {
+	r            *bufio.Reader
+	maxFrameSize int
+}
+
+// NewDecoder returns a Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), maxFrameSize: DefaultMaxFrameSize}
+}
+
+// SetMaxFrameSize limits the size of frames the decoder will accept. Values of
+// zero or less restore DefaultMaxFrameSize.
+func (d *Decoder) SetMaxFrameSize(n int) {
+	if n <= 0 {
+		n = DefaultMaxFrameSize
+	}
+	d.maxFrameSize = n
+}
+
+// Decode reads the next frame and unmarshals it. A frame that is not valid
+// JSON yields an error wrapping ErrInvalidMessage; the stream remains usable
+// and the caller may continue decoding. Any other error leaves the stream in
+// an unknown state.
+func (d *Decoder) Decode() (*Message, error) {
+	data, err := ReadFrame(d.r, d.maxFrameSize)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,128 @@
+package message
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	original := NewChatMessage("peer1", 7, "hello")
+
+	if err := NewEncoder(&buf).Encode(original); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	decoded, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.SenderID != original.SenderID || decoded.SequenceNo != original.SequenceNo || decoded.Payload != original.Payload {
+		t.Fatalf("decoded message does not match original: %+v", decoded)
+	}
+}
+
+func TestDecodeLargeMessage(t *testing.T) {
+	var buf bytes.Buffer
+	payload := strings.Repeat("x", 64*1024)
+
+	if err := NewEncoder(&buf).Encode(NewChatMessage("peer1", 1, payload)); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	decoded, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.Payload != payload {
+		t.Fatalf("expected %d byte payload, got %d", len(payload), len(decoded.Payload))
+	}
+}
+
+func TestDecodeCoalescedMessages(t *testing.T) {
+	// Several frames arriving in a single read must all be decoded.
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for i := 1; i <= 3; i++ {
+		if err := enc.Encode(NewChatMessage("peer1", i, "burst")); err != nil {
+			t.Fatalf("encode %d: %v", i, err)
+		}
+	}
+
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	for i := 1; i <= 3; i++ {
+		msg, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("decode %d: %v", i, err)
+		}
+		if msg.SequenceNo != i {
+			t.Fatalf("expected sequence %d, got %d", i, msg.SequenceNo)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Fatalf("expected io.EOF after last frame, got %v", err)
+	}
+}
+
+func TestDecodeFrameTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(NewChatMessage("peer1", 1, strings.Repeat("x", 1024))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	dec := NewDecoder(&buf)
+	dec.SetMaxFrameSize(128)
+	if _, err := dec.Decode(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+}
+
+func TestEncodeFrameTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetMaxFrameSize(128)
+
+	if err := enc.Encode(NewChatMessage("peer1", 1, strings.Repeat("x", 1024))); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing written, got %d bytes", buf.Len())
+	}
+}
+
+func TestDecodeInvalidMessageContinues(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, []byte("{invalid json")); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+	if err := NewEncoder(&buf).Encode(NewChatMessage("peer1", 2, "ok")); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	dec := NewDecoder(&buf)
+	if _, err := dec.Decode(); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrInvalidMessage, got %v", err)
+	}
+	msg, err := dec.Decode()
+	if err != nil {
+		t.Fatalf("decode after invalid frame: %v", err)
+	}
+	if msg.Payload != "ok" {
+		t.Fatalf("expected payload ok, got %s", msg.Payload)
+	}
+}
+
+func TestReadFrameTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, []byte("hello world")); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+	truncated := buf.Bytes()[:buf.Len()-3]
+
+	if _, err := ReadFrame(bytes.NewReader(truncated), 0); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package message
 
 import (
 	"encoding/json"
+	"strconv"
 	"time"
 )
 
@@ -12,8 +13,42 @@ const (
 	TypeChat      MessageType = "chat"
 	TypeHeartbeat MessageType = "heartbeat"
 	TypePeerList  MessageType = "peer_list"
+	TypeDirect    MessageType = "direct"
+	// TypeSubscriptions advertises topic interest to a neighbour. It is
+	// link-local and never forwarded.
+	TypeSubscriptions MessageType = "subscriptions"
+	// TypeFindNode asks a neighbour for the peers it knows closest to a
+	// peer ID, and TypeNodes answers it. Both are link-local.
+	TypeFindNode MessageType = "find_node"
+	TypeNodes    MessageType = "nodes"
+	// TypePing and TypePong measure the round trip time of a link. A pong
+	// echoes the nonce of the ping it answers. Both are link-local.
+	TypePing MessageType = "ping"
+	TypePong MessageType = "pong"
+	// TypePingReq asks a neighbour to ping another peer on the sender's
+	// behalf, and TypePingReqAck reports that the peer answered.
+	// TypeMembership carries membership changes. All three are link-local.
+	TypePingReq    MessageType = "ping_req"
+	TypePingReqAck MessageType = "ping_req_ack"
+	TypeMembership MessageType = "membership"
+	// TypeAck acknowledges a message that asked for it. It travels back to
+	// the original sender like a direct message.
+	TypeAck MessageType = "ack"
 )
 
+// AckStatus says how far an acknowledged message got.
+type AckStatus string
+
+const (
+	// AckDelivered means the message reached the recipient's application.
+	AckDelivered AckStatus = "delivered"
+	// AckRead means the recipient's user was shown the message.
+	AckRead AckStatus = "read"
+)
+
+// DefaultTTL is the hop limit applied to messages when none is configured.
+const DefaultTTL = 16
+
 // Message represents a message exchanged between peers.
 type Message struct {
 	SenderID   string      `json:"sender_id"`
@@ -21,6 +56,24 @@ type Message struct {
 	Type       MessageType `json:"type"`
 	Payload    string      `json:"payload"`
 	Timestamp  time.Time   `json:"timestamp"`
+	// Recipient is the ID of the only peer that should deliver the message.
+	// It is empty for messages addressed to everyone.
+	Recipient string `json:"recipient,omitempty"`
+	// Topic restricts delivery to peers subscribed to it. It is empty for
+	// messages addressed to everyone.
+	Topic string `json:"topic,omitempty"`
+	// TTL is the number of hops the message may still travel. Relays
+	// decrement it, so it is not covered by the signature. Zero means the
+	// sender did not set one and the receiver's default applies.
+	TTL int `json:"ttl,omitempty"`
+	// AckRequested asks every peer that delivers the message to send an
+	// acknowledgement back to the sender.
+	AckRequested bool `json:"ack_requested,omitempty"`
+	
+	// PublicKey and Signature are set by Sign. They are optional; unsigned
+	// messages leave them empty.
+	PublicKey []byte `json:"public_key,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
 }
 
 // Marshal encodes the message as JSON bytes.
@@ -59,6 +112,40 @@ func NewHeartbeatMessage(senderID string, sequenceNo int) *Message {
 	}
 }
 
+// NewHeartbeatReply creates the answer to the heartbeat with the given
+// sequence number
+func NewHeartbeatReply(senderID string, sequenceNo int) *Message {
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypeHeartbeat,
+		Payload:    "pong",
+		Timestamp:  time.Now(),
+	}
+}
+
+// NewPingMessage creates a ping carrying nonce
+func NewPingMessage(senderID string, sequenceNo int, nonce uint64) *Message {
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypePing,
+		Payload:    strconv.FormatUint(nonce, 10),
+		Timestamp:  time.Now(),
+	}
+}
+
+// NewPongMessage creates the answer to the ping carrying nonce
+func NewPongMessage(senderID string, sequenceNo int, nonce uint64) *Message {
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypePong,
+		Payload:    strconv.FormatUint(nonce, 10),
+		Timestamp:  time.Now(),
+	}
+}
+
 // NewPeerListMessage creates a new peer list message
 func NewPeerListMessage(senderID string, sequenceNo int, peers []string) *Message {
 	peerData, _ := json.Marshal(peers)
@@ -71,16 +158,236 @@ func NewPeerListMessage(senderID string, sequenceNo int, peers []string) *Messag
 	}
 }
 
+// NewDirectMessage creates a chat message addressed to a single peer
+func NewDirectMessage(senderID, recipient string, sequenceNo int, text string) *Message {
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypeDirect,
+		Payload:    text,
+		Timestamp:  time.Now(),
+		Recipient:  recipient,
+	}
+}
+
+// NewTopicMessage creates a chat message published to a topic
+func NewTopicMessage(senderID, topic string, sequenceNo int, text string) *Message {
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypeChat,
+		Payload:    text,
+		Timestamp:  time.Now(),
+		Topic:      topic,
+	}
+}
+
+// NewSubscriptionsMessage creates a subscription advertisement. Each topic
+// maps to the number of hops to the nearest interested peer, with 0 meaning
+// the sender itself is subscribed.
+func NewSubscriptionsMessage(senderID string, sequenceNo int, topics map[string]int) *Message {
+	topicData, _ := json.Marshal(topics)
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypeSubscriptions,
+		Payload:    string(topicData),
+		Timestamp:  time.Now(),
+	}
+}
+
+// NodeInfo identifies a peer and the address it can be dialed at.
+type NodeInfo struct {
+	ID   string `json:"id"`
+	Addr string `json:"addr"`
+}
+
+// NewFindNodeMessage creates a request for the peers closest to target. The
+// reply carries the same sequence number.
+func NewFindNodeMessage(senderID string, sequenceNo int, target string) *Message {
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypeFindNode,
+		Payload:    target,
+		Timestamp:  time.Now(),
+	}
+}
+
+// NewNodesMessage creates a reply to the find-node request with the given
+// sequence number.
+func NewNodesMessage(senderID string, sequenceNo int, nodes []NodeInfo) *Message {
+	nodeData, _ := json.Marshal(nodes)
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypeNodes,
+		Payload:    string(nodeData),
+		Timestamp:  time.Now(),
+	}
+}
+
+// Probe identifies an indirect ping: the peer to ping and the requester's
+// nonce, which the acknowledgement echoes.
+type Probe struct {
+	Target string `json:"target"`
+	Nonce  uint64 `json:"nonce"`
+}
+
+// NewPingReqMessage asks a neighbour to ping target
+func NewPingReqMessage(senderID string, sequenceNo int, target string, nonce uint64) *Message {
+	probeData, _ := json.Marshal(Probe{Target: target, Nonce: nonce})
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypePingReq,
+		Payload:    string(probeData),
+		Timestamp:  time.Now(),
+	}
+}
+
+// NewPingReqAckMessage reports that target answered the ping requested
+// with nonce
+func NewPingReqAckMessage(senderID string, sequenceNo int, target string, nonce uint64) *Message {
+	probeData, _ := json.Marshal(Probe{Target: target, Nonce: nonce})
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypePingReqAck,
+		Payload:    string(probeData),
+		Timestamp:  time.Now(),
+	}
+}
+
+// MemberInfo is what a peer knows about one member of the mesh. State is
+// "alive", "suspect" or "dead"; Incarnation orders claims about the same
+// member and is raised only by the member itself.
+type MemberInfo struct {
+	ID          string `json:"id"`
+	Addr        string `json:"addr,omitempty"`
+	State       string `json:"state"`
+	Incarnation uint64 `json:"incarnation"`
+}
+
+// NewMembershipMessage creates a membership update
+func NewMembershipMessage(senderID string, sequenceNo int, members []MemberInfo) *Message {
+	memberData, _ := json.Marshal(members)
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypeMembership,
+		Payload:    string(memberData),
+		Timestamp:  time.Now(),
+	}
+}
+
+// Ack acknowledges the message with SequenceNo sent by the recipient of the
+// acknowledgement.
+type Ack struct {
+	SequenceNo int       `json:"sequence_no"`
+	Status     AckStatus `json:"status"`
+}
+
+// NewAckMessage creates an acknowledgement of acked, addressed to its sender
+func NewAckMessage(senderID string, sequenceNo int, acked *Message, status AckStatus) *Message {
+	ackData, _ := json.Marshal(Ack{SequenceNo: acked.SequenceNo, Status: status})
+	return &Message{
+		SenderID:   senderID,
+		SequenceNo: sequenceNo,
+		Type:       TypeAck,
+		Payload:    string(ackData),
+		Timestamp:  time.Now(),
+		Recipient:  acked.SenderID,
+	}
+}
+
 // IsHeartbeat returns true if the message is a heartbeat
 func (m *Message) IsHeartbeat() bool {
 	return m.Type == TypeHeartbeat
 }
 
+// IsHeartbeatReply returns true if the message answers a heartbeat
+func (m *Message) IsHeartbeatReply() bool {
+	return m.Type == TypeHeartbeat && m.Payload == "pong"
+}
+
 // IsChatMessage returns true if the message is a chat message
 func (m *Message) IsChatMessage() bool {
 	return m.Type == TypeChat
 }
 
+// IsDirect returns true if the message is addressed to a single peer
+func (m *Message) IsDirect() bool {
+	return m.Recipient != ""
+}
+
+// GetSubscriptions extracts the topic distances from a subscriptions message
+func (m *Message) GetSubscriptions() (map[string]int, error) {
+	if m.Type != TypeSubscriptions {
+		return nil, nil
+	}
+	
+	var topics map[string]int
+	if err := json.Unmarshal([]byte(m.Payload), &topics); err != nil {
+		return nil, err
+	}
+	return topics, nil
+}
+
+// GetNonce extracts the nonce from a ping or pong message
+func (m *Message) GetNonce() (uint64, error) {
+	if m.Type != TypePing && m.Type != TypePong {
+		return 0, ErrInvalidMessage
+	}
+	return strconv.ParseUint(m.Payload, 10, 64)
+}
+
+// GetNodes extracts the peers from a nodes message
+func (m *Message) GetNodes() ([]NodeInfo, error) {
+	if m.Type != TypeNodes {
+		return nil, nil
+	}
+	
+	var nodes []NodeInfo
+	if err := json.Unmarshal([]byte(m.Payload), &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// GetProbe extracts the probe from a ping request or its acknowledgement
+func (m *Message) GetProbe() (Probe, error) {
+	var probe Probe
+	if m.Type != TypePingReq && m.Type != TypePingReqAck {
+		return probe, ErrInvalidMessage
+	}
+	err := json.Unmarshal([]byte(m.Payload), &probe)
+	return probe, err
+}
+
+// GetMembers extracts the members from a membership message
+func (m *Message) GetMembers() ([]MemberInfo, error) {
+	if m.Type != TypeMembership {
+		return nil, nil
+	}
+	
+	var members []MemberInfo
+	if err := json.Unmarshal([]byte(m.Payload), &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// GetAck extracts the acknowledgement from an ack message
+func (m *Message) GetAck() (Ack, error) {
+	var ack Ack
+	if m.Type != TypeAck {
+		return ack, ErrInvalidMessage
+	}
+	err := json.Unmarshal([]byte(m.Payload), &ack)
+	return ack, err
+}
+
 // GetPeerList extracts peer list from a peer list message
 func (m *Message) GetPeerList() ([]string, error) {
 	if m.Type != TypePeerList {
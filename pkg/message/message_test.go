@@ -61,6 +61,153 @@ func TestNewChatMessage(t *testing.T) {
 	}
 }
 
+func TestNewDirectMessage(t *testing.T) {
+	msg := NewDirectMessage("peer1", "peer2", 7, "psst")
+
+	if msg.Type != TypeDirect {
+		t.Errorf("expected type %s, got %s", TypeDirect, msg.Type)
+	}
+	if msg.Recipient != "peer2" {
+		t.Errorf("expected recipient 'peer2', got %s", msg.Recipient)
+	}
+	if !msg.IsDirect() {
+		t.Error("expected IsDirect to return true")
+	}
+	if NewChatMessage("peer1", 1, "hi").IsDirect() {
+		t.Error("expected chat message not to be direct")
+	}
+
+	data, err := msg.Marshal()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if decoded.Recipient != "peer2" {
+		t.Errorf("expected recipient to survive round trip, got %q", decoded.Recipient)
+	}
+}
+
+func TestNewTopicMessage(t *testing.T) {
+	msg := NewTopicMessage("peer1", "rust", 3, "hello room")
+	if msg.Type != TypeChat || msg.Topic != "rust" {
+		t.Errorf("expected chat message on topic rust, got %s on %q", msg.Type, msg.Topic)
+	}
+}
+
+func TestSubscriptionsMessage(t *testing.T) {
+	topics := map[string]int{"rust": 0, "go": 2}
+	msg := NewSubscriptionsMessage("peer1", 1, topics)
+	if msg.Type != TypeSubscriptions {
+		t.Errorf("expected type %s, got %s", TypeSubscriptions, msg.Type)
+	}
+
+	got, err := msg.GetSubscriptions()
+	if err != nil {
+		t.Fatalf("extract subscriptions: %v", err)
+	}
+	if len(got) != 2 || got["rust"] != 0 || got["go"] != 2 {
+		t.Errorf("expected %v, got %v", topics, got)
+	}
+
+	if got, err := NewChatMessage("peer1", 1, "hi").GetSubscriptions(); got != nil || err != nil {
+		t.Errorf("expected nil for non-subscriptions message, got %v, %v", got, err)
+	}
+}
+
+func TestFindNodeMessages(t *testing.T) {
+	req := NewFindNodeMessage("peer1", 7, "00112233445566778899aabbccddeeff")
+	if req.Type != TypeFindNode || req.Payload != "00112233445566778899aabbccddeeff" {
+		t.Errorf("unexpected find-node message %+v", req)
+	}
+
+	nodes := []NodeInfo{{ID: "peer2", Addr: "localhost:8081"}, {ID: "peer3", Addr: "localhost:8082"}}
+	resp := NewNodesMessage("peer2", req.SequenceNo, nodes)
+	if resp.Type != TypeNodes || resp.SequenceNo != 7 {
+		t.Errorf("unexpected nodes message %+v", resp)
+	}
+	got, err := resp.GetNodes()
+	if err != nil {
+		t.Fatalf("extract nodes: %v", err)
+	}
+	if len(got) != 2 || got[1] != nodes[1] {
+		t.Errorf("expected %v, got %v", nodes, got)
+	}
+
+	if got, err := req.GetNodes(); got != nil || err != nil {
+		t.Errorf("expected nil for non-nodes message, got %v, %v", got, err)
+	}
+}
+
+func TestPingPongMessages(t *testing.T) {
+	ping := NewPingMessage("peer1", 1, 1<<63+5)
+	pong := NewPongMessage("peer2", 1, 1<<63+5)
+	if ping.Type != TypePing || pong.Type != TypePong {
+		t.Fatalf("unexpected types %s, %s", ping.Type, pong.Type)
+	}
+	for _, msg := range []*Message{ping, pong} {
+		nonce, err := msg.GetNonce()
+		if err != nil || nonce != 1<<63+5 {
+			t.Errorf("expected nonce %d from %s, got %d, %v", uint64(1<<63+5), msg.Type, nonce, err)
+		}
+	}
+	if _, err := NewChatMessage("peer1", 1, "42").GetNonce(); err == nil {
+		t.Error("expected error extracting a nonce from a chat message")
+	}
+}
+
+func TestPingReqMessages(t *testing.T) {
+	req := NewPingReqMessage("peer1", 3, "peer3", 42)
+	ack := NewPingReqAckMessage("peer2", 3, "peer3", 42)
+	if req.Type != TypePingReq || ack.Type != TypePingReqAck {
+		t.Fatalf("unexpected types %s, %s", req.Type, ack.Type)
+	}
+	for _, msg := range []*Message{req, ack} {
+		probe, err := msg.GetProbe()
+		if err != nil || probe != (Probe{Target: "peer3", Nonce: 42}) {
+			t.Errorf("unexpected probe from %s: %+v, %v", msg.Type, probe, err)
+		}
+	}
+	if _, err := NewPingMessage("peer1", 1, 42).GetProbe(); err == nil {
+		t.Error("expected error extracting a probe from a ping")
+	}
+}
+
+func TestAckMessage(t *testing.T) {
+	acked := NewChatMessage("peer1", 7, "hello")
+	msg := NewAckMessage("peer2", 1, acked, AckRead)
+	if msg.Type != TypeAck || msg.Recipient != "peer1" {
+		t.Fatalf("expected an ack addressed to peer1, got %s to %q", msg.Type, msg.Recipient)
+	}
+	ack, err := msg.GetAck()
+	if err != nil || ack != (Ack{SequenceNo: 7, Status: AckRead}) {
+		t.Errorf("unexpected ack: %+v, %v", ack, err)
+	}
+	if _, err := acked.GetAck(); err == nil {
+		t.Error("expected error extracting an ack from a chat message")
+	}
+}
+
+func TestMembershipMessage(t *testing.T) {
+	members := []MemberInfo{
+		{ID: "peer2", Addr: "localhost:8081", State: "alive", Incarnation: 1},
+		{ID: "peer3", State: "dead", Incarnation: 4},
+	}
+	msg := NewMembershipMessage("peer1", 2, members)
+	got, err := msg.GetMembers()
+	if err != nil {
+		t.Fatalf("extract members: %v", err)
+	}
+	if len(got) != 2 || got[0] != members[0] || got[1] != members[1] {
+		t.Errorf("expected %v, got %v", members, got)
+	}
+	if got, err := NewChatMessage("peer1", 1, "hi").GetMembers(); got != nil || err != nil {
+		t.Errorf("expected nil for non-membership message, got %v, %v", got, err)
+	}
+}
+
 func TestNewHeartbeatMessage(t *testing.T) {
 	msg := NewHeartbeatMessage("peer2", 10)
 	
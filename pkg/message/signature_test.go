@@ -0,0 +1,77 @@
+package message
+
+import (
+	"testing"
+
+	"example.com/p2p/pkg/identity"
+)
+
+func TestSignVerify(t *testing.T) {
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+	msg := NewChatMessage(id.ID(), 1, "hello")
+	msg.Sign(id)
+
+	if err := msg.Verify(); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	// Signatures must survive a round trip through the wire format.
+	data, err := msg.Marshal()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if err := decoded.Verify(); err != nil {
+		t.Fatalf("verify after round trip: %v", err)
+	}
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	msg := NewChatMessage("peer1", 1, "hello")
+	if err := msg.Verify(); err != ErrUnsigned {
+		t.Fatalf("expected ErrUnsigned, got %v", err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+	other, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(m *Message)
+	}{
+		{"payload", func(m *Message) { m.Payload = "goodbye" }},
+		{"sequence", func(m *Message) { m.SequenceNo++ }},
+		{"type", func(m *Message) { m.Type = TypeHeartbeat }},
+		{"sender", func(m *Message) { m.SenderID = other.ID() }},
+		{"recipient", func(m *Message) { m.Recipient = other.ID() }},
+		{"topic", func(m *Message) { m.Topic = "elsewhere" }},
+		{"ack requested", func(m *Message) { m.AckRequested = true }},
+		{"public key", func(m *Message) { m.PublicKey = other.PublicKey() }},
+		{"resigned by other", func(m *Message) { m.Sign(other) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := NewChatMessage(id.ID(), 1, "hello")
+			msg.Sign(id)
+			tt.tamper(msg)
+			if err := msg.Verify(); err != ErrBadSignature {
+				t.Fatalf("expected ErrBadSignature, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package peer
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/p2p/pkg/message"
+)
+
+// DeliveryTracker collects the acknowledgements of a message sent with
+// BroadcastTracked, SendToTracked or PublishTracked. It finishes when its
+// deadline passes, or earlier once every expected peer has read the message.
+type DeliveryTracker struct {
+	// SequenceNo is the sequence number of the tracked message.
+	SequenceNo int
+
+	// expected holds the peers an acknowledgement is expected from, unless
+	// open is set, in which case they are not known in advance and any
+	// peer's acknowledgement counts.
+	expected []string
+	open     bool
+	once     sync.Once
+	done     chan struct{}
+
+	mu   sync.Mutex
+	acks map[string]message.AckStatus
+}
+
+// DeliveryReport lists, by peer ID, how far a tracked message got.
+type DeliveryReport struct {
+	// Expected holds the peers known when the message was sent. It is
+	// empty for a topic message, whose subscribers are not known.
+	Expected []string
+	// Delivered holds the peers that acknowledged the message, whether
+	// or not they have read it yet; Read holds those that have read it.
+	Delivered []string
+	Read      []string
+	// Missing holds the expected peers that sent no acknowledgement.
+	Missing []string
+}
+
+// Report returns the acknowledgements received so far.
+func (t *DeliveryTracker) Report() DeliveryReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := DeliveryReport{Expected: append([]string(nil), t.expected...)}
+	for id, status := range t.acks {
+		r.Delivered = append(r.Delivered, id)
+		if status == message.AckRead {
+			r.Read = append(r.Read, id)
+		}
+	}
+	for _, id := range t.expected {
+		if _, ok := t.acks[id]; !ok {
+			r.Missing = append(r.Missing, id)
+		}
+	}
+	sort.Strings(r.Expected)
+	sort.Strings(r.Delivered)
+	sort.Strings(r.Read)
+	sort.Strings(r.Missing)
+	return r
+}
+
+// Done returns a channel that is closed when the tracker finishes.
+func (t *DeliveryTracker) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait blocks until the tracker finishes and returns the final report.
+func (t *DeliveryTracker) Wait() DeliveryReport {
+	<-t.done
+	return t.Report()
+}
+
+// record notes an acknowledgement from id and reports whether every
+// expected peer has now read the message, which an open tracker never
+// knows. Acknowledgements from peers that were not expected are ignored,
+// and a read receipt is never downgraded by a delivery acknowledgement that
+// arrives after it.
+func (t *DeliveryTracker) record(id string, status message.AckStatus) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.open && !slices.Contains(t.expected, id) {
+		return false
+	}
+	if t.acks[id] != message.AckRead {
+		t.acks[id] = status
+	}
+	if t.open {
+		return false
+	}
+	for _, id := range t.expected {
+		if t.acks[id] != message.AckRead {
+			return false
+		}
+	}
+	return true
+}
+
+// BroadcastTracked broadcasts msg like Broadcast, asking every peer that
+// delivers it to acknowledge it. The returned tracker expects an
+// acknowledgement from each peer in KnownPeers and finishes after timeout.
+// Messages are tracked by sequence number, so a tracked message replaces an
+// earlier one with the same number that is still being tracked.
+func (p *Peer) BroadcastTracked(msg *message.Message, timeout time.Duration) (*DeliveryTracker, error) {
+	out := *msg
+	out.AckRequested = true
+	t := p.track(out.SequenceNo, p.KnownPeers(), false, timeout)
+	if err := p.Broadcast(&out); err != nil {
+		p.untrack(t)
+		return nil, err
+	}
+	return t, nil
+}
+
+// SendToTracked sends msg to the peer with the given ID like SendTo, and
+// returns a tracker that expects an acknowledgement from that peer only.
+func (p *Peer) SendToTracked(id string, msg *message.Message, timeout time.Duration) (*DeliveryTracker, error) {
+	out := *msg
+	out.AckRequested = true
+	t := p.track(out.SequenceNo, []string{id}, false, timeout)
+	if err := p.SendTo(id, &out); err != nil {
+		p.untrack(t)
+		return nil, err
+	}
+	return t, nil
+}
+
+// PublishTracked publishes msg to topic like Publish, asking every
+// subscriber that delivers it to acknowledge it. Subscribers are not known
+// in advance, so the returned tracker counts the acknowledgement of any peer
+// and always runs until timeout.
+func (p *Peer) PublishTracked(topic string, msg *message.Message, timeout time.Duration) (*DeliveryTracker, error) {
+	out := *msg
+	out.AckRequested = true
+	t := p.track(out.SequenceNo, nil, true, timeout)
+	if err := p.Publish(topic, &out); err != nil {
+		p.untrack(t)
+		return nil, err
+	}
+	return t, nil
+}
+
+// Acknowledge sends an acknowledgement of msg with the given status back to
+// its sender. The peer acknowledges delivery itself; applications call it
+// with message.AckRead once the message has been shown to the user. Messages
+// that did not ask for an acknowledgement, and the peer's own, are ignored.
+func (p *Peer) Acknowledge(msg *message.Message, status message.AckStatus) error {
+	if !msg.AckRequested || msg.SenderID == p.ID {
+		return nil
+	}
+	seq := int(p.ackSeq.Add(1))
+	return p.SendTo(msg.SenderID, message.NewAckMessage(p.ID, seq, msg, status))
+}
+
+// handleAck records an acknowledgement addressed to this peer with the
+// tracker of the message it refers to, if that is still being tracked.
+func (p *Peer) handleAck(msg *message.Message) {
+	ack, err := msg.GetAck()
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	t, ok := p.trackers[ack.SequenceNo]
+	p.mu.Unlock()
+	if ok && t.record(msg.SenderID, ack.Status) {
+		p.untrack(t)
+	}
+}
+
+// track starts tracking the acknowledgements of the message with the given
+// sequence number, from the expected peers or, if open, from any peer. A
+// tracker with nobody to wait for finishes at once.
+func (p *Peer) track(seq int, expected []string, open bool, timeout time.Duration) *DeliveryTracker {
+	t := &DeliveryTracker{
+		SequenceNo: seq,
+		expected:   expected,
+		open:       open,
+		done:       make(chan struct{}),
+		acks:       make(map[string]message.AckStatus),
+	}
+	if !open && len(expected) == 0 {
+		t.finish()
+		return t
+	}
+	p.mu.Lock()
+	if old, ok := p.trackers[seq]; ok {
+		old.finish()
+	}
+	p.trackers[seq] = t
+	p.mu.Unlock()
+	time.AfterFunc(timeout, func() { p.untrack(t) })
+	return t
+}
+
+// untrack stops tracking t and finishes it.
+func (p *Peer) untrack(t *DeliveryTracker) {
+	p.mu.Lock()
+	if p.trackers[t.SequenceNo] == t {
+		delete(p.trackers, t.SequenceNo)
+	}
+	p.mu.Unlock()
+	t.finish()
+}
+
+func (t *DeliveryTracker) finish() {
+	t.once.Do(func() { close(t.done) })
+}
@@ -0,0 +1,109 @@
+package peer
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/message"
+)
+
+func TestBroadcastTrackedCollectsAcks(t *testing.T) {
+	peers := memoryChain(t, 3)
+	// Let peers[0] learn a route to the far end of the chain.
+	if err := peers[2].Broadcast(message.NewChatMessage(peers[2].ID, 1, "hi")); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	expectMessage(t, peers[1], "hi")
+	expectMessage(t, peers[0], "hi")
+
+	tracker, err := peers[0].BroadcastTracked(message.NewChatMessage(peers[0].ID, 1, "tracked"), 5*time.Second)
+	if err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	first := expectMessage(t, peers[1], "tracked")
+	last := expectMessage(t, peers[2], "tracked")
+	if !first.AckRequested || !last.AckRequested {
+		t.Fatal("expected the broadcast to request acknowledgements")
+	}
+	waitFor(t, func() bool { return len(tracker.Report().Delivered) == 2 })
+
+	for i, msg := range []*message.Message{first, last} {
+		if err := peers[i+1].Acknowledge(msg, message.AckRead); err != nil {
+			t.Fatalf("acknowledge: %v", err)
+		}
+	}
+	select {
+	case <-tracker.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the tracker to finish once everyone read the message")
+	}
+	want := []string{peers[1].ID, peers[2].ID}
+	sort.Strings(want)
+	report := tracker.Wait()
+	if !reflect.DeepEqual(report.Read, want) || len(report.Missing) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	// Acknowledgements are consumed by the peer, not delivered.
+	expectNoMessage(t, peers[0])
+}
+
+func TestPublishTrackedCountsSubscribers(t *testing.T) {
+	peers := memoryChain(t, 3)
+	peers[2].Subscribe("rust")
+	waitFor(t, func() bool { return interestedIn(peers[0], peers[1].ID, "rust") })
+
+	tracker, err := peers[0].PublishTracked("rust", message.NewChatMessage(peers[0].ID, 1, "tracked"), 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	msg := expectMessage(t, peers[2], "tracked")
+	if err := peers[2].Acknowledge(msg, message.AckRead); err != nil {
+		t.Fatalf("acknowledge: %v", err)
+	}
+	report := tracker.Wait()
+	want := []string{peers[2].ID}
+	if !reflect.DeepEqual(report.Delivered, want) || !reflect.DeepEqual(report.Read, want) {
+		t.Fatalf("expected only the subscriber to acknowledge, got %+v", report)
+	}
+	if len(report.Expected) != 0 || len(report.Missing) != 0 {
+		t.Fatalf("expected no known subscribers, got %+v", report)
+	}
+}
+
+func TestTrackerReportsMissingPeers(t *testing.T) {
+	peers := memoryChain(t, 2)
+
+	tracker, err := peers[0].SendToTracked("ghost", message.NewDirectMessage(peers[0].ID, "ghost", 1, "anyone?"), 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	report := tracker.Wait()
+	if !reflect.DeepEqual(report.Missing, []string{"ghost"}) || len(report.Delivered) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestAcknowledgeOnlyWhenRequested(t *testing.T) {
+	peers := memoryChain(t, 2)
+
+	if err := peers[0].SendTo(peers[1].ID, message.NewDirectMessage(peers[0].ID, peers[1].ID, 1, "untracked")); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	msg := expectMessage(t, peers[1], "untracked")
+	if err := peers[1].Acknowledge(msg, message.AckRead); err != nil {
+		t.Fatalf("acknowledge: %v", err)
+	}
+	expectNoMessage(t, peers[0])
+
+	tracker, err := peers[0].SendToTracked(peers[1].ID, message.NewDirectMessage(peers[0].ID, peers[1].ID, 2, "tracked"), 5*time.Second)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	expectMessage(t, peers[1], "tracked")
+	waitFor(t, func() bool { return len(tracker.Report().Delivered) == 1 })
+	if report := tracker.Report(); len(report.Read) != 0 {
+		t.Fatalf("expected delivery without a read receipt, got %+v", report)
+	}
+}
@@ -0,0 +1,135 @@
+package peer
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"example.com/p2p/pkg/config"
+)
+
+// defaultJitter is the fraction by which the exponential policy built from
+// the configuration randomises each delay.
+const defaultJitter = 0.2
+
+// BackoffPolicy decides how long to wait before retrying a failed dial.
+type BackoffPolicy interface {
+	// Next returns the delay before retry number attempt, counting from
+	// 1, given the delay before the previous retry (zero before the
+	// first).
+	Next(attempt int, prev time.Duration) time.Duration
+}
+
+// Rand is a source of random numbers in [0, 1). *rand.Rand implements it,
+// so a seeded generator makes delays reproducible; it must be safe for
+// concurrent use if the policy is shared between goroutines.
+type Rand interface {
+	Float64() float64
+}
+
+// Clock tells the time. It is injected where tests need to control it.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the real clock.
+var SystemClock Clock = systemClock{}
+
+type globalRand struct{}
+
+func (globalRand) Float64() float64 { return rand.Float64() }
+
+func randOrDefault(r Rand) Rand {
+	if r == nil {
+		return globalRand{}
+	}
+	return r
+}
+
+// ExponentialBackoff multiplies the delay by Factor on every retry, starting
+// at Base and capped at Max, then moves it up or down by a random fraction
+// of at most Jitter.
+type ExponentialBackoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Factor float64 // 2 if zero
+	Jitter float64 // between 0 and 1
+	Rand   Rand    // the shared math/rand source if nil
+}
+
+// Next implements BackoffPolicy.
+func (b ExponentialBackoff) Next(attempt int, _ time.Duration) time.Duration {
+	factor := b.Factor
+	if factor <= 0 {
+		factor = 2
+	}
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := float64(b.Base) * math.Pow(factor, float64(attempt-1))
+	if b.Jitter > 0 {
+		d *= 1 + b.Jitter*(2*randOrDefault(b.Rand).Float64()-1)
+	}
+	return clampDelay(d, b.Max)
+}
+
+// DecorrelatedJitter picks each delay at random between Base and three times
+// the previous one, capped at Max. Peers that failed together spread out
+// quickly instead of retrying in lockstep.
+type DecorrelatedJitter struct {
+	Base time.Duration
+	Max  time.Duration
+	Rand Rand // the shared math/rand source if nil
+}
+
+// Next implements BackoffPolicy.
+func (b DecorrelatedJitter) Next(_ int, prev time.Duration) time.Duration {
+	if prev < b.Base {
+		prev = b.Base
+	}
+	d := float64(b.Base) + randOrDefault(b.Rand).Float64()*float64(3*prev-b.Base)
+	return clampDelay(d, b.Max)
+}
+
+// ConstantBackoff always waits Delay.
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+// Next implements BackoffPolicy.
+func (b ConstantBackoff) Next(int, time.Duration) time.Duration {
+	return b.Delay
+}
+
+// clampDelay converts d to a duration between zero and max, or unbounded
+// above if max is zero.
+func clampDelay(d float64, max time.Duration) time.Duration {
+	if max > 0 && d > float64(max) {
+		return max
+	}
+	if d > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	if d < 0 {
+		return 0
+	}
+	return time.Duration(d)
+}
+
+// NewBackoffPolicy returns the reconnect backoff policy selected by the
+// configuration.
+func NewBackoffPolicy(cfg *config.Config) BackoffPolicy {
+	base, max := time.Duration(cfg.ReconnectBaseDelay), time.Duration(cfg.ReconnectMaxDelay)
+	switch cfg.ReconnectPolicy {
+	case config.BackoffConstant:
+		return ConstantBackoff{Delay: base}
+	case config.BackoffDecorrelated:
+		return DecorrelatedJitter{Base: base, Max: max}
+	default:
+		return ExponentialBackoff{Base: base, Max: max, Jitter: defaultJitter}
+	}
+}
@@ -0,0 +1,96 @@
+package peer
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/config"
+)
+
+func TestExponentialBackoffGrowsAndCaps(t *testing.T) {
+	b := ExponentialBackoff{Base: time.Second, Max: 10 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		if got := b.Next(i+1, 0); got != w {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, w, got)
+		}
+	}
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	b := ExponentialBackoff{Base: time.Second, Max: time.Hour, Jitter: 0.5, Rand: rand.New(rand.NewSource(1))}
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		d := b.Next(3, 0)
+		if d < 2*time.Second || d > 6*time.Second {
+			t.Fatalf("expected 4s ±50%%, got %v", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Error("expected jitter to vary the delay")
+	}
+}
+
+func TestDecorrelatedJitterBounds(t *testing.T) {
+	b := DecorrelatedJitter{Base: 100 * time.Millisecond, Max: 5 * time.Second, Rand: rand.New(rand.NewSource(1))}
+	var prev time.Duration
+	for i := 1; i <= 50; i++ {
+		d := b.Next(i, prev)
+		upper := 3 * prev
+		if upper < 3*b.Base {
+			upper = 3 * b.Base
+		}
+		if upper > b.Max {
+			upper = b.Max
+		}
+		if d < b.Base || d > upper {
+			t.Fatalf("attempt %d: %v outside [%v, %v]", i, d, b.Base, upper)
+		}
+		prev = d
+	}
+}
+
+func TestBackoffReproducibleWithSeed(t *testing.T) {
+	run := func() []time.Duration {
+		b := DecorrelatedJitter{Base: time.Second, Max: time.Minute, Rand: rand.New(rand.NewSource(42))}
+		var out []time.Duration
+		var prev time.Duration
+		for i := 1; i <= 10; i++ {
+			prev = b.Next(i, prev)
+			out = append(out, prev)
+		}
+		return out
+	}
+	a, b := run(), run()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("attempt %d: %v != %v with the same seed", i+1, a[i], b[i])
+		}
+	}
+}
+
+func TestConstantBackoff(t *testing.T) {
+	b := ConstantBackoff{Delay: 3 * time.Second}
+	for i := 1; i <= 5; i++ {
+		if got := b.Next(i, time.Hour); got != 3*time.Second {
+			t.Errorf("attempt %d: expected 3s, got %v", i, got)
+		}
+	}
+}
+
+func TestNewBackoffPolicy(t *testing.T) {
+	cfg := config.Default()
+	if _, ok := NewBackoffPolicy(cfg).(ExponentialBackoff); !ok {
+		t.Error("expected exponential backoff by default")
+	}
+	cfg.ReconnectPolicy = config.BackoffDecorrelated
+	if _, ok := NewBackoffPolicy(cfg).(DecorrelatedJitter); !ok {
+		t.Error("expected decorrelated jitter")
+	}
+	cfg.ReconnectPolicy = config.BackoffConstant
+	if b, ok := NewBackoffPolicy(cfg).(ConstantBackoff); !ok || b.Delay != time.Duration(cfg.ReconnectBaseDelay) {
+		t.Error("expected constant backoff at the base delay")
+	}
+}
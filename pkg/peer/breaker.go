@@ -0,0 +1,183 @@
+package peer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"example.com/p2p/pkg/config"
+)
+
+// ErrCircuitOpen is returned when a dial is refused because recent dials to
+// the same address kept failing.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// BreakerState is the state of the circuit for one address.
+type BreakerState int
+
+const (
+	// BreakerClosed lets dials through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen refuses dials until the cooldown has passed.
+	BreakerOpen
+	// BreakerHalfOpen lets a single trial dial through.
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops dialing addresses that keep failing. After threshold
+// consecutive failures the circuit for an address opens and dials to it are
+// refused without touching the network. Once the cooldown has passed, one
+// trial dial is let through: success closes the circuit, failure opens it
+// again for a longer cooldown, as chosen by the backoff policy.
+//
+// A nil *CircuitBreaker lets every dial through.
+type CircuitBreaker struct {
+	threshold int
+	policy    BackoffPolicy
+	clock     Clock
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    BreakerState
+	failures int // consecutive, while closed
+	opens    int // times opened since the last success
+	cooldown time.Duration
+	openedAt time.Time
+}
+
+// NewCircuitBreaker creates a circuit breaker that opens after threshold
+// consecutive failures and picks cooldowns with policy. A nil policy means
+// the default exponential backoff, and a nil clock the system clock.
+func NewCircuitBreaker(threshold int, policy BackoffPolicy, clock Clock) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	if policy == nil {
+		policy = NewBackoffPolicy(config.Default())
+	}
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		policy:    policy,
+		clock:     clock,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+// Allow reports whether a dial to addr may go ahead. When the cooldown of an
+// open circuit has passed, the first caller is let through as the trial and
+// the circuit turns half-open until the trial's outcome is reported.
+func (cb *CircuitBreaker) Allow(addr string) bool {
+	if cb == nil {
+		return true
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, ok := cb.circuits[addr]
+	if !ok {
+		return true
+	}
+	switch c.state {
+	case BreakerOpen:
+		if cb.clock.Now().Sub(c.openedAt) < c.cooldown {
+			return false
+		}
+		c.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// Ready reports whether Allow would let a dial to addr through, without
+// starting a trial.
+func (cb *CircuitBreaker) Ready(addr string) bool {
+	if cb == nil {
+		return true
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, ok := cb.circuits[addr]
+	if !ok {
+		return true
+	}
+	switch c.state {
+	case BreakerOpen:
+		return cb.clock.Now().Sub(c.openedAt) >= c.cooldown
+	case BreakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// Success records a successful dial to addr, closing its circuit.
+func (cb *CircuitBreaker) Success(addr string) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	delete(cb.circuits, addr)
+}
+
+// Failure records a failed dial to addr. It opens the circuit if the
+// threshold is reached or a trial failed.
+func (cb *CircuitBreaker) Failure(addr string) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, ok := cb.circuits[addr]
+	if !ok {
+		c = &circuit{}
+		cb.circuits[addr] = c
+	}
+	switch c.state {
+	case BreakerClosed:
+		c.failures++
+		if c.failures < cb.threshold {
+			return
+		}
+	case BreakerOpen:
+		// A dial that started before the circuit opened.
+		return
+	}
+	c.state = BreakerOpen
+	c.failures = 0
+	c.opens++
+	c.cooldown = cb.policy.Next(c.opens, c.cooldown)
+	c.openedAt = cb.clock.Now()
+}
+
+// State returns the state of the circuit for addr.
+func (cb *CircuitBreaker) State(addr string) BreakerState {
+	if cb == nil {
+		return BreakerClosed
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if c, ok := cb.circuits[addr]; ok {
+		return c.state
+	}
+	return BreakerClosed
+}
@@ -0,0 +1,126 @@
+package peer
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestCircuitBreakerOpensAtThreshold(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cb := NewCircuitBreaker(3, ConstantBackoff{Delay: time.Minute}, clock)
+
+	for i := 0; i < 2; i++ {
+		cb.Failure("a")
+		if !cb.Allow("a") {
+			t.Fatalf("expected dials allowed after %d failures", i+1)
+		}
+	}
+	cb.Failure("a")
+	if cb.State("a") != BreakerOpen {
+		t.Fatalf("expected open circuit, got %s", cb.State("a"))
+	}
+	if cb.Allow("a") || cb.Ready("a") {
+		t.Error("expected dials refused while open")
+	}
+	if !cb.Allow("b") {
+		t.Error("expected other addresses unaffected")
+	}
+}
+
+func TestCircuitBreakerHalfOpenTrial(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cb := NewCircuitBreaker(1, ExponentialBackoff{Base: time.Minute, Max: time.Hour}, clock)
+
+	cb.Failure("a")
+	clock.Advance(time.Minute)
+	if !cb.Ready("a") {
+		t.Fatal("expected circuit ready after the cooldown")
+	}
+	if !cb.Allow("a") {
+		t.Fatal("expected a trial dial after the cooldown")
+	}
+	if cb.State("a") != BreakerHalfOpen {
+		t.Fatalf("expected half-open circuit, got %s", cb.State("a"))
+	}
+	if cb.Allow("a") {
+		t.Error("expected a single trial dial")
+	}
+
+	// The failed trial reopens the circuit for twice as long.
+	cb.Failure("a")
+	clock.Advance(time.Minute)
+	if cb.Allow("a") {
+		t.Error("expected a longer cooldown after a failed trial")
+	}
+	clock.Advance(time.Minute)
+	if !cb.Allow("a") {
+		t.Fatal("expected a second trial dial")
+	}
+
+	cb.Success("a")
+	if cb.State("a") != BreakerClosed || !cb.Allow("a") {
+		t.Error("expected a successful trial to close the circuit")
+	}
+}
+
+func TestNilCircuitBreaker(t *testing.T) {
+	var cb *CircuitBreaker
+	cb.Failure("a")
+	if !cb.Allow("a") || !cb.Ready("a") || cb.State("a") != BreakerClosed {
+		t.Error("expected a nil breaker to allow every dial")
+	}
+}
+
+func TestDialRefusedWhenCircuitOpen(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	p := New("localhost:0")
+	p.SetCircuitBreaker(NewCircuitBreaker(2, ConstantBackoff{Delay: time.Hour}, nil))
+	for i := 0; i < 2; i++ {
+		if _, err := p.Connect(addr); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("dial %d: expected a network error, got %v", i+1, err)
+		}
+	}
+	if _, err := p.Connect(addr); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+}
+
+func TestCircuitBreakerDefaultPolicy(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cb := NewCircuitBreaker(1, nil, clock)
+
+	cb.Failure("a")
+	if cb.State("a") != BreakerOpen {
+		t.Fatalf("expected open circuit, got %s", cb.State("a"))
+	}
+	clock.Advance(time.Hour)
+	if !cb.Ready("a") {
+		t.Error("expected circuit ready after the default cooldown")
+	}
+}
@@ -27,13 +27,11 @@ func TestBroadcastRemovesBrokenConn(t *testing.T) {
 
 	readDone := make(chan *message.Message, 1)
 	go func() {
-		buf := make([]byte, 512)
-		n, err := goodB.Read(buf)
+		m, err := message.NewDecoder(goodB).Decode()
 		if err != nil {
 			readDone <- nil
 			return
 		}
-		m, _ := message.Unmarshal(buf[:n])
 		readDone <- m
 	}()
 
@@ -0,0 +1,215 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"example.com/p2p/pkg/dht"
+	"example.com/p2p/pkg/message"
+	"example.com/p2p/pkg/transport"
+)
+
+// LookupTimeout bounds the lookup Connect runs to find a peer by ID.
+const LookupTimeout = 10 * time.Second
+
+// findNodeTimeout bounds a single find-node request.
+const findNodeTimeout = 3 * time.Second
+
+// ErrPeerNotFound is returned when a lookup cannot find a peer ID.
+var ErrPeerNotFound = errors.New("peer not found")
+
+// Peers that advertise CapMsgFindNode keep a Kademlia routing table of the
+// peers they have been connected to. A lookup for an ID asks the closest
+// known peers for closer ones, dialing them as needed, until it converges on
+// the peers closest to the ID. Connections dialed only to ask a question are
+// closed once it is answered.
+
+// RoutingTable returns the peer's DHT routing table.
+func (p *Peer) RoutingTable() *dht.RoutingTable {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.table
+}
+
+// Lookup returns the peers closest to the target ID, closest first.
+func (p *Peer) Lookup(ctx context.Context, target string) ([]dht.Contact, error) {
+	id, err := dht.ParseID(target)
+	if err != nil {
+		return nil, err
+	}
+	return dht.Lookup(ctx, p.RoutingTable(), id, p.findNode), nil
+}
+
+// FindPeer returns the address of the peer with the given ID, looking it up
+// in the DHT if it is not in the routing table.
+func (p *Peer) FindPeer(ctx context.Context, id string) (string, error) {
+	if c, ok := p.RoutingTable().Find(id); ok {
+		return c.Addr, nil
+	}
+	contacts, err := p.Lookup(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range contacts {
+		if c.ID == id {
+			return c.Addr, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrPeerNotFound, id)
+}
+
+// Bootstrap looks up the peer's own ID, which fills the routing table with
+// its closest peers and makes it known to them.
+func (p *Peer) Bootstrap(ctx context.Context) {
+	rt := p.RoutingTable()
+	dht.Lookup(ctx, rt, rt.Self(), p.findNode)
+}
+
+// RefreshBuckets looks up a random ID in every bucket that has not been used
+// for maxAge.
+func (p *Peer) RefreshBuckets(ctx context.Context, maxAge time.Duration) {
+	rt := p.RoutingTable()
+	for _, target := range rt.StaleTargets(maxAge) {
+		if ctx.Err() != nil {
+			return
+		}
+		dht.Lookup(ctx, rt, target, p.findNode)
+	}
+}
+
+// connectID connects to the peer with the given ID, finding its address in
+// the DHT.
+func (p *Peer) connectID(id string) (string, error) {
+	if _, ok := p.Session(id); ok {
+		return id, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), LookupTimeout)
+	defer cancel()
+	addr, err := p.FindPeer(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	got, err := p.dial(addr)
+	if err != nil {
+		p.RoutingTable().Remove(id)
+		return "", err
+	}
+	if got != id {
+		p.RoutingTable().Remove(id)
+		return got, fmt.Errorf("peer at %s has ID %s, not %s", addr, got, id)
+	}
+	return id, nil
+}
+
+// addContact records a newly connected peer in the routing table if it
+// takes part in the DHT.
+func (p *Peer) addContact(sess *Session, conn net.Conn) {
+	if !sess.Has(CapMsgFindNode) || sess.Remote.ListenAddr == "" {
+		return
+	}
+	p.RoutingTable().Update(dht.Contact{
+		ID:   sess.Remote.ID,
+		Addr: transport.ResolveHost(sess.Remote.ListenAddr, conn.RemoteAddr()),
+	})
+}
+
+// findNode asks contact c for the peers it knows closest to target, dialing
+// it first if it is not a neighbour.
+func (p *Peer) findNode(ctx context.Context, c dht.Contact, target dht.ID) ([]dht.Contact, error) {
+	if _, ok := p.Session(c.ID); !ok {
+		id, conn, err := p.dialConn(c.Addr)
+		if errors.Is(err, ErrConnectionLimit) || errors.Is(err, ErrCircuitOpen) {
+			// The dial never reached the contact.
+			return nil, fmt.Errorf("%w: %w", dht.ErrNotQueried, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Only the temporary connection is closed, not one that may
+		// have replaced it in the meantime.
+		defer p.removeConn(id, conn)
+		if id != c.ID {
+			return nil, fmt.Errorf("peer at %s has ID %s, not %s", c.Addr, id, c.ID)
+		}
+	}
+	sess, ok := p.Session(c.ID)
+	if !ok || !sess.Has(CapMsgFindNode) {
+		return nil, fmt.Errorf("peer %s does not support lookups", c.ID)
+	}
+
+	ch := make(chan []message.NodeInfo, 1)
+	p.mu.Lock()
+	p.findSeq++
+	seq := p.findSeq
+	p.finds[seq] = pendingFind{from: c.ID, ch: ch}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.finds, seq)
+		p.mu.Unlock()
+	}()
+
+	msg := message.NewFindNodeMessage(p.ID, seq, target.String())
+	if err := p.sendWhere(msg, func(id string) bool { return id == c.ID }); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, findNodeTimeout)
+	defer cancel()
+	select {
+	case nodes := <-ch:
+		contacts := make([]dht.Contact, len(nodes))
+		for i, n := range nodes {
+			contacts[i] = dht.Contact{ID: n.ID, Addr: n.Addr}
+		}
+		return contacts, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// pendingFind is a find-node request waiting for its reply.
+type pendingFind struct {
+	from string
+	ch   chan []message.NodeInfo
+}
+
+// handleFindNode answers a neighbour's find-node request.
+func (p *Peer) handleFindNode(from string, msg *message.Message) {
+	target, err := dht.ParseID(msg.Payload)
+	if err != nil {
+		return
+	}
+	contacts := p.RoutingTable().Closest(target, dht.K)
+	nodes := make([]message.NodeInfo, len(contacts))
+	for i, c := range contacts {
+		nodes[i] = message.NodeInfo{ID: c.ID, Addr: c.Addr}
+	}
+	reply := message.NewNodesMessage(p.ID, msg.SequenceNo, nodes)
+	// Reply from a new goroutine so that the read loop never blocks
+	// writing to the neighbour.
+	go p.sendWhere(reply, func(id string) bool { return id == from })
+}
+
+// handleNodes passes a reply to the find-node request waiting for it.
+func (p *Peer) handleNodes(from string, msg *message.Message) {
+	nodes, err := msg.GetNodes()
+	if err != nil {
+		return
+	}
+	if len(nodes) > dht.K {
+		nodes = nodes[:dht.K]
+	}
+	p.mu.Lock()
+	f, ok := p.finds[msg.SequenceNo]
+	if ok && f.from == from {
+		delete(p.finds, msg.SequenceNo)
+	}
+	p.mu.Unlock()
+	if ok && f.from == from {
+		f.ch <- nodes
+	}
+}
@@ -0,0 +1,79 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestConnectByID(t *testing.T) {
+	peers := memoryChain(t, 5)
+	a, c, e := peers[0], peers[2], peers[4]
+
+	id, err := a.Connect(e.ID)
+	if err != nil {
+		t.Fatalf("Connect by ID failed: %v", err)
+	}
+	if id != e.ID {
+		t.Fatalf("expected to reach %s, got %s", e.ID, id)
+	}
+	if _, ok := a.Session(e.ID); !ok {
+		t.Fatal("expected a session with the peer found by ID")
+	}
+	// Peers dialed only to answer the lookup are not kept.
+	waitFor(t, func() bool {
+		_, ok := a.Session(c.ID)
+		return !ok
+	})
+
+	// Connecting again to a neighbour by ID does not dial.
+	if id, err := a.Connect(e.ID); err != nil || id != e.ID {
+		t.Fatalf("expected existing connection to be reused, got %s, %v", id, err)
+	}
+}
+
+func TestConnectByUnknownID(t *testing.T) {
+	peers := memoryChain(t, 3)
+	_, err := peers[0].Connect(New("").ID)
+	if !errors.Is(err, ErrPeerNotFound) {
+		t.Fatalf("expected ErrPeerNotFound, got %v", err)
+	}
+}
+
+func TestBootstrapFillsRoutingTable(t *testing.T) {
+	peers := memoryChain(t, 4)
+	a := peers[0]
+	if n := a.RoutingTable().Len(); n != 1 {
+		t.Fatalf("expected only the neighbour in the routing table, got %d", n)
+	}
+
+	a.Bootstrap(context.Background())
+	for _, p := range peers[1:] {
+		if _, ok := a.RoutingTable().Find(p.ID); !ok {
+			t.Errorf("expected %s in the routing table after bootstrap", p.ID)
+		}
+	}
+	if n := a.Connections(); n != 1 {
+		t.Fatalf("expected lookup connections to be closed, got %d connections", n)
+	}
+}
+
+func TestLookupSkipsPeersWithoutDHT(t *testing.T) {
+	peers := memoryChain(t, 2)
+	legacy := New("")
+	legacy.SetTransport(peers[0].transport)
+	legacy.capabilities = []string{CapMsgChat}
+	ln, err := legacy.Listen("")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	go legacy.Serve(ln)
+
+	if _, err := peers[0].Connect(legacy.Addr); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if _, ok := peers[0].RoutingTable().Find(legacy.ID); ok {
+		t.Fatal("expected a peer without lookup support to stay out of the routing table")
+	}
+}
@@ -0,0 +1,142 @@
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/message"
+	"example.com/p2p/pkg/transport"
+)
+
+// memoryChain connects n peers in a line over the in-memory transport:
+// peers[0] - peers[1] - ... - peers[n-1].
+func memoryChain(t *testing.T, n int) []*Peer {
+	t.Helper()
+	mem := transport.NewMemory()
+	peers := make([]*Peer, n)
+	for i := range peers {
+		p := New("")
+		p.SetTransport(mem)
+		ln, err := p.Listen("")
+		if err != nil {
+			t.Fatalf("listen peer %d: %v", i, err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go p.Serve(ln)
+		peers[i] = p
+	}
+	for i := 0; i < n-1; i++ {
+		if _, err := peers[i].Connect(peers[i+1].Addr); err != nil {
+			t.Fatalf("connect peer %d to %d: %v", i, i+1, err)
+		}
+	}
+	waitFor(t, func() bool { return peers[n-1].Connections() == 1 })
+	return peers
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func expectMessage(t *testing.T, p *Peer, payload string) *message.Message {
+	t.Helper()
+	select {
+	case msg := <-p.Messages:
+		if msg.Payload != payload {
+			t.Fatalf("expected %q, got %q", payload, msg.Payload)
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected message %q", payload)
+		return nil
+	}
+}
+
+func expectNoMessage(t *testing.T, p *Peer) {
+	t.Helper()
+	select {
+	case msg := <-p.Messages:
+		t.Fatalf("unexpected message %q from %s", msg.Payload, msg.SenderID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSendToNeighbour(t *testing.T) {
+	peers := memoryChain(t, 2)
+
+	msg := message.NewDirectMessage(peers[0].ID, peers[1].ID, 1, "hello neighbour")
+	if err := peers[0].SendTo(peers[1].ID, msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	got := expectMessage(t, peers[1], "hello neighbour")
+	if got.Recipient != peers[1].ID {
+		t.Fatalf("expected recipient %s, got %s", peers[1].ID, got.Recipient)
+	}
+}
+
+func TestSendToUsesLearnedRoute(t *testing.T) {
+	peers := memoryChain(t, 4)
+	first, last := peers[0], peers[3]
+
+	// A broadcast from the far end teaches every peer the reverse path.
+	if err := last.Broadcast(message.NewChatMessage(last.ID, 1, "announce")); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	for _, p := range peers[:3] {
+		expectMessage(t, p, "announce")
+	}
+	for i, p := range peers[:3] {
+		via, ok := p.Route(last.ID)
+		if !ok || via != peers[i+1].ID {
+			t.Fatalf("peer %d: expected route via %s, got %s (%v)", i, peers[i+1].ID, via, ok)
+		}
+	}
+
+	msg := message.NewDirectMessage(first.ID, last.ID, 1, "just for you")
+	if err := first.SendTo(last.ID, msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	expectMessage(t, last, "just for you")
+	for _, p := range peers[:3] {
+		expectNoMessage(t, p)
+	}
+}
+
+func TestSendToFloodsWithoutRoute(t *testing.T) {
+	peers := memoryChain(t, 3)
+
+	msg := message.NewDirectMessage(peers[0].ID, peers[2].ID, 1, "find me")
+	if err := peers[0].SendTo(peers[2].ID, msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	expectMessage(t, peers[2], "find me")
+	expectNoMessage(t, peers[1])
+
+	// The recipient learned the way back and can answer without flooding.
+	if via, ok := peers[2].Route(peers[0].ID); !ok || via != peers[1].ID {
+		t.Fatalf("expected route back via %s, got %s (%v)", peers[1].ID, via, ok)
+	}
+}
+
+func TestRoutesDroppedWithConnection(t *testing.T) {
+	peers := memoryChain(t, 3)
+	if err := peers[2].Broadcast(message.NewChatMessage(peers[2].ID, 1, "announce")); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	expectMessage(t, peers[0], "announce")
+
+	peers[0].RemoveConn(peers[1].ID)
+	if _, ok := peers[0].Route(peers[2].ID); ok {
+		t.Fatal("expected route to be forgotten with its connection")
+	}
+	if known := peers[0].KnownPeers(); len(known) != 0 {
+		t.Fatalf("expected no known peers, got %v", known)
+	}
+}
@@ -0,0 +1,126 @@
+package peer
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"example.com/p2p/pkg/message"
+	"example.com/p2p/pkg/transport"
+)
+
+func TestRegisterKeepsLowerDialedConn(t *testing.T) {
+	p := New("localhost:0")
+	tests := []struct {
+		remote string
+		// whether the outbound connection survives when it is
+		// registered after an inbound one
+		keepOutbound bool
+	}{
+		{remote: "0", keepOutbound: false},
+		{remote: "zzzz", keepOutbound: true},
+	}
+	for _, tt := range tests {
+		in1, in2 := net.Pipe()
+		out1, out2 := net.Pipe()
+		defer in2.Close()
+		defer out2.Close()
+
+		hello := &Hello{ID: tt.remote}
+		if !p.register(&Session{Remote: hello}, in1) {
+			t.Fatalf("%s: expected the first connection to be kept", tt.remote)
+		}
+		kept := p.register(&Session{Remote: hello, Outbound: true}, out1)
+		if kept != tt.keepOutbound {
+			t.Errorf("%s: outbound kept = %v, want %v", tt.remote, kept, tt.keepOutbound)
+		}
+		sess, _ := p.Session(tt.remote)
+		if sess.Outbound != tt.keepOutbound {
+			t.Errorf("%s: expected the session of the surviving connection", tt.remote)
+		}
+		if got := p.Connections(); got != 1 {
+			t.Errorf("%s: expected 1 connection, got %d", tt.remote, got)
+		}
+		p.RemoveConn(tt.remote)
+	}
+}
+
+func TestStaleConnCannotRemoveSuccessor(t *testing.T) {
+	p := New("localhost:0")
+	old, oldB := net.Pipe()
+	next, nextB := net.Pipe()
+	defer oldB.Close()
+	defer nextB.Close()
+
+	p.AddConn("peer1", old)
+	p.AddConn("peer1", next)
+	if _, err := old.Write([]byte("x")); err == nil {
+		t.Error("expected the replaced connection to be closed")
+	}
+	p.removeConn("peer1", old)
+	if got := p.Connections(); got != 1 {
+		t.Fatalf("expected the newer connection to stay, got %d connections", got)
+	}
+	p.removeConn("peer1", next)
+	if got := p.Connections(); got != 0 {
+		t.Errorf("expected no connections, got %d", got)
+	}
+}
+
+func TestSimultaneousDialKeepsOneLink(t *testing.T) {
+	mem := transport.NewMemory()
+	for i := 0; i < 20; i++ {
+		a := limitedPeer(t, mem)
+		b := limitedPeer(t, mem)
+
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		dial := func(from, to *Peer) {
+			defer wg.Done()
+			<-start
+			if _, err := from.Connect(to.Addr); err != nil {
+				t.Errorf("connect: %v", err)
+			}
+		}
+		wg.Add(2)
+		go dial(a, b)
+		go dial(b, a)
+		close(start)
+		wg.Wait()
+
+		// Both ends settle on the connection dialed by the lower ID.
+		waitFor(t, func() bool {
+			sa, okA := a.Session(b.ID)
+			sb, okB := b.Session(a.ID)
+			return okA && okB && a.Connections() == 1 && b.Connections() == 1 &&
+				sa.Outbound == (a.ID < b.ID) && sb.Outbound == (b.ID < a.ID)
+		})
+		if err := a.SendTo(b.ID, message.NewChatMessage(a.ID, 1, "hello")); err != nil {
+			t.Fatal(err)
+		}
+		expectMessage(t, b, "hello")
+	}
+}
+
+func TestAcceptReportsDiscardedDuplicate(t *testing.T) {
+	mem := transport.NewMemory()
+	lo, hi := limitedPeer(t, mem), limitedPeer(t, mem)
+	if hi.ID < lo.ID {
+		lo, hi = hi, lo
+	}
+	if _, err := lo.Connect(hi.Addr); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	// A connection from hi loses to the one lo dialed.
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go hi.Handshake(c1)
+	if _, _, err := lo.Accept(c2); !errors.Is(err, ErrDuplicateConnection) {
+		t.Fatalf("expected ErrDuplicateConnection, got %v", err)
+	}
+	if sess, ok := lo.Session(hi.ID); !ok || !sess.Outbound || lo.Connections() != 1 {
+		t.Fatal("expected the dialed link to be kept")
+	}
+}
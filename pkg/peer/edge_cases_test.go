@@ -130,9 +130,9 @@ func TestReadLoopInvalidMessage(t *testing.T) {
 	// Start readLoop
 	go p.readLoop("test-peer", inB)
 	
-	// Send invalid JSON data
+	// Send a well-formed frame containing invalid JSON
 	invalidData := []byte("{invalid json}")
-	if _, err := inA.Write(invalidData); err != nil {
+	if err := message.WriteFrame(inA, invalidData); err != nil {
 		t.Fatalf("write invalid data: %v", err)
 	}
 	
@@ -191,8 +191,7 @@ func TestReadLoopMessageChannelFull(t *testing.T) {
 	
 	// Send a valid message
 	msg := &message.Message{SenderID: "test", SequenceNo: 1, Payload: "test"}
-	data, _ := msg.Marshal()
-	if _, err := inA.Write(data); err != nil {
+	if err := message.NewEncoder(inA).Encode(msg); err != nil {
 		t.Fatalf("write message: %v", err)
 	}
 	
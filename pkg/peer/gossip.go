@@ -0,0 +1,224 @@
+package peer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"example.com/p2p/pkg/addrbook"
+	"example.com/p2p/pkg/config"
+	"example.com/p2p/pkg/message"
+	"example.com/p2p/pkg/transport"
+)
+
+// MaxPeerListSize bounds the number of addresses sent in, and accepted from,
+// a single peer-list message. It is also the number of addresses any one
+// neighbour may place in the address book.
+const MaxPeerListSize = 64
+
+// PeerExchange gossips the listen addresses of connected peers to
+// neighbours, collects the addresses they send into an address book, and
+// dials addresses from the book while the peer has fewer connections than the
+// target degree.
+type PeerExchange struct {
+	peer      *Peer
+	book      *addrbook.Book
+	interval  time.Duration
+	target    int
+	onConnect func(id, addr string)
+
+	mu      sync.Mutex
+	dialing map[string]bool
+	seq     int
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewPeerExchange creates a peer exchange for p using book. onConnect, if not
+// nil, is called for every connection the exchange dials.
+func NewPeerExchange(cfg *config.Config, p *Peer, book *addrbook.Book, onConnect func(id, addr string)) *PeerExchange {
+	px := &PeerExchange{
+		peer:      p,
+		book:      book,
+		interval:  time.Duration(cfg.PeerExchangeInterval),
+		target:    cfg.TargetDegree,
+		onConnect: onConnect,
+		dialing:   make(map[string]bool),
+		stopCh:    make(chan struct{}),
+	}
+	p.HandleFunc(message.TypePeerList, px.handlePeerList)
+	return px
+}
+
+// NewAddressBook creates an address book sized from cfg, limiting each
+// neighbour to MaxPeerListSize entries. Configured peers are not added; they
+// are dialed and redialed separately.
+func NewAddressBook(cfg *config.Config) *addrbook.Book {
+	return addrbook.New(cfg.AddressBookSize, MaxPeerListSize)
+}
+
+// Start begins periodic gossip and dialing.
+func (px *PeerExchange) Start() {
+	px.wg.Add(1)
+	go px.loop()
+}
+
+// Stop stops gossiping and waits for outstanding dials to finish.
+func (px *PeerExchange) Stop() {
+	px.mu.Lock()
+	select {
+	case <-px.stopCh:
+	default:
+		close(px.stopCh)
+	}
+	px.mu.Unlock()
+	px.wg.Wait()
+}
+
+func (px *PeerExchange) loop() {
+	defer px.wg.Done()
+
+	ticker := time.NewTicker(px.interval)
+	defer ticker.Stop()
+
+	for {
+		px.gossip()
+		px.fill()
+		select {
+		case <-px.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// gossip sends every neighbour that understands peer lists the addresses of
+// the peer itself and of its other neighbours.
+func (px *PeerExchange) gossip() {
+	neighbours := px.peer.NeighbourAddrs()
+
+	px.mu.Lock()
+	px.seq++
+	seq := px.seq
+	px.mu.Unlock()
+
+	p := px.peer
+	p.mu.Lock()
+	targets := make([]string, 0, len(p.sessions))
+	for id, sess := range p.sessions {
+		if sess.Has(CapMsgPeerList) {
+			targets = append(targets, id)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, id := range targets {
+		addrs := make([]string, 0, len(neighbours)+1)
+		if p.Addr != "" && !transport.Unspecified(p.Addr) {
+			addrs = append(addrs, p.Addr)
+		}
+		for other, addr := range neighbours {
+			if other != id && len(addrs) < MaxPeerListSize {
+				addrs = append(addrs, addr)
+			}
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+		msg := message.NewPeerListMessage(p.ID, seq, addrs)
+		_ = p.sendWhere(msg, func(c string) bool { return c == id })
+	}
+}
+
+// handlePeerList merges the addresses a neighbour sent into the address book.
+func (px *PeerExchange) handlePeerList(from string, msg *message.Message) {
+	addrs, err := msg.GetPeerList()
+	if err != nil || msg.SenderID != from {
+		return
+	}
+	if len(addrs) > MaxPeerListSize {
+		addrs = addrs[:MaxPeerListSize]
+	}
+	for _, addr := range addrs {
+		if addr != px.peer.Addr {
+			px.book.Add(addr, from)
+		}
+	}
+}
+
+// fill dials the best-scored addresses from the book until the peer has as
+// many connections, or dials in progress, as the target degree. Configured
+// addresses are left to the caller, which dials them separately.
+func (px *PeerExchange) fill() {
+	p := px.peer
+	connected := make(map[string]bool)
+	for _, addr := range p.NeighbourAddrs() {
+		connected[addr] = true
+	}
+
+	px.mu.Lock()
+	defer px.mu.Unlock()
+	need := px.target - p.Connections() - len(px.dialing)
+	if need <= 0 {
+		return
+	}
+	for _, e := range px.book.Entries() {
+		if need == 0 {
+			break
+		}
+		addr := e.Addr
+		if e.Source == "" || connected[addr] || px.dialing[addr] || addr == p.Addr {
+			continue
+		}
+		if !p.CircuitBreaker().Ready(addr) {
+			continue
+		}
+		px.dialing[addr] = true
+		need--
+		px.wg.Add(1)
+		go px.dial(addr)
+	}
+}
+
+func (px *PeerExchange) dial(addr string) {
+	defer px.wg.Done()
+	defer func() {
+		px.mu.Lock()
+		delete(px.dialing, addr)
+		px.mu.Unlock()
+	}()
+
+	start := time.Now()
+	id, err := px.peer.Connect(addr)
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrConnectionLimit) {
+		return
+	}
+	if err != nil {
+		// Addresses that keep failing are dropped; they come back if
+		// a neighbour still advertises them.
+		px.book.MarkFailure(addr)
+		return
+	}
+	px.book.MarkSuccess(addr, time.Since(start))
+	if px.onConnect != nil {
+		px.onConnect(id, addr)
+	}
+}
+
+// NeighbourAddrs returns the address each connected peer can be dialed at,
+// keyed by peer ID. This is the listen address from the peer's hello, with an
+// unspecified host such as 0.0.0.0 replaced by the host the connection came
+// from. Peers that did not advertise a listen address are left out.
+func (p *Peer) NeighbourAddrs() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	addrs := make(map[string]string, len(p.sessions))
+	for id, sess := range p.sessions {
+		c, ok := p.conns[id]
+		if !ok || sess.Remote.ListenAddr == "" {
+			continue
+		}
+		addrs[id] = transport.ResolveHost(sess.Remote.ListenAddr, c.RemoteAddr())
+	}
+	return addrs
+}
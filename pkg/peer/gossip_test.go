@@ -0,0 +1,120 @@
+package peer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/addrbook"
+	"example.com/p2p/pkg/config"
+	"example.com/p2p/pkg/message"
+)
+
+func exchangeConfig() *config.Config {
+	cfg := config.Default()
+	cfg.PeerExchangeInterval = config.JSONDuration(20 * time.Millisecond)
+	cfg.TargetDegree = 2
+	return cfg
+}
+
+func TestPeerExchangeDialsDiscoveredPeers(t *testing.T) {
+	peers := memoryChain(t, 3)
+	a, b, c := peers[0], peers[1], peers[2]
+	cfg := exchangeConfig()
+
+	var mu sync.Mutex
+	dialed := make(map[string]string)
+	book := NewAddressBook(cfg)
+	pxA := NewPeerExchange(cfg, a, book, func(id, addr string) {
+		mu.Lock()
+		dialed[id] = addr
+		mu.Unlock()
+	})
+	pxB := NewPeerExchange(cfg, b, NewAddressBook(cfg), nil)
+	pxA.Start()
+	defer pxA.Stop()
+	pxB.Start()
+	defer pxB.Stop()
+
+	waitFor(t, func() bool { return a.Connections() == 2 })
+	if !book.Contains(c.Addr) {
+		t.Fatalf("expected %s in address book, got %v", c.Addr, book.Addresses())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if dialed[c.ID] != c.Addr {
+		t.Fatalf("expected onConnect for %s at %s, got %v", c.ID, c.Addr, dialed)
+	}
+}
+
+func TestPeerListLimits(t *testing.T) {
+	peers := memoryChain(t, 2)
+	cfg := exchangeConfig()
+	book := NewAddressBook(cfg)
+	px := NewPeerExchange(cfg, peers[0], book, nil)
+
+	flood := make([]string, 1000)
+	for i := range flood {
+		flood[i] = fmt.Sprintf("10.0.%d.%d:8080", i/256, i%256)
+	}
+	px.handlePeerList(peers[1].ID, message.NewPeerListMessage(peers[1].ID, 1, flood))
+	if book.Len() != MaxPeerListSize {
+		t.Fatalf("expected %d addresses from one list, got %d", MaxPeerListSize, book.Len())
+	}
+
+	more := make([]string, 10)
+	for i := range more {
+		more[i] = fmt.Sprintf("10.1.0.%d:8080", i)
+	}
+	px.handlePeerList(peers[1].ID, message.NewPeerListMessage(peers[1].ID, 2, more))
+	if book.Len() != MaxPeerListSize {
+		t.Fatalf("expected per-neighbour quota to hold, got %d", book.Len())
+	}
+
+	px.handlePeerList(peers[1].ID, message.NewPeerListMessage("someone-else", 3, []string{"10.2.0.1:8080"}))
+	if book.Contains("10.2.0.1:8080") {
+		t.Fatal("expected peer list with a spoofed sender to be ignored")
+	}
+}
+
+func TestPeerExchangeDropsUnreachable(t *testing.T) {
+	peers := memoryChain(t, 2)
+	cfg := exchangeConfig()
+	book := NewAddressBook(cfg)
+	book.Add("nobody-home", peers[1].ID)
+	px := NewPeerExchange(cfg, peers[0], book, nil)
+
+	px.fill()
+	px.wg.Wait()
+	if e, ok := book.Get("nobody-home"); !ok || e.Failures != 1 {
+		t.Fatalf("expected failed dial to be recorded, got %+v", e)
+	}
+	for i := 1; i < addrbook.MaxFailures; i++ {
+		px.fill()
+		px.wg.Wait()
+	}
+	if book.Contains("nobody-home") {
+		t.Fatal("expected unreachable address to be removed")
+	}
+}
+
+func TestPeerExchangeRecordsSuccess(t *testing.T) {
+	peers := memoryChain(t, 3)
+	a, b, c := peers[0], peers[1], peers[2]
+	cfg := exchangeConfig()
+	book := NewAddressBook(cfg)
+	book.Add(c.Addr, b.ID)
+	book.Add("configured", "")
+	px := NewPeerExchange(cfg, a, book, nil)
+
+	px.fill()
+	px.wg.Wait()
+	e, _ := book.Get(c.Addr)
+	if e.LastSuccess.IsZero() || e.Score != 1 {
+		t.Fatalf("expected successful dial to be recorded, got %+v", e)
+	}
+	if e, _ := book.Get("configured"); e.Failures != 0 {
+		t.Fatalf("expected configured address to be left to the caller, got %+v", e)
+	}
+}
@@ -0,0 +1,313 @@
+package peer
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"example.com/p2p/pkg/identity"
+	"example.com/p2p/pkg/message"
+)
+
+// Protocol versions understood by this implementation. Version 1 was the
+// original newline-terminated ID exchange, and version 2 did not bind the
+// hellos to the authentication; neither is supported any more.
+const (
+	ProtocolVersion    = 3
+	MinProtocolVersion = 3
+)
+
+// Capabilities a node may advertise during the handshake.
+const (
+	CapCompression  = "compression"
+	CapEncryption   = "encryption"
+	CapMsgChat      = "msg/chat"
+	CapMsgHeartbeat = "msg/heartbeat"
+	CapMsgPeerList  = "msg/peer_list"
+	CapMsgDirect    = "msg/direct"
+	CapMsgTopics    = "msg/topics"
+	CapMsgFindNode  = "msg/find_node"
+)
+
+// maxIDLength bounds the peer ID accepted from a remote hello.
+const maxIDLength = 64
+
+// maxHelloSize bounds the size of a handshake frame.
+const maxHelloSize = 64 * 1024
+
+// authContext is prepended to the data signed during the handshake so that
+// the signature cannot be replayed in another protocol.
+const authContext = "p2p-handshake-v3"
+
+var (
+	// ErrIncompatibleVersion is returned when the local and remote protocol
+	// version ranges do not overlap.
+	ErrIncompatibleVersion = errors.New("incompatible protocol version")
+
+	// ErrAuthFailed is returned when the remote peer cannot prove that it
+	// owns the private key behind its ID.
+	ErrAuthFailed = errors.New("peer authentication failed")
+
+	// ErrRejected is returned when the remote peer refuses the connection,
+	// for example because it has no free slots. The reason it gave follows
+	// in the error message.
+	ErrRejected = errors.New("connection rejected")
+)
+
+// Hello is the first frame each side sends on a new connection.
+type Hello struct {
+	ProtocolVersion    int      `json:"protocol_version"`
+	MinProtocolVersion int      `json:"min_protocol_version"`
+	ID                 string   `json:"id"`
+	ListenAddr         string   `json:"listen_addr,omitempty"`
+	NodeVersion        string   `json:"node_version,omitempty"`
+	Capabilities       []string `json:"capabilities,omitempty"`
+	PublicKey          []byte   `json:"public_key,omitempty"`
+	Nonce              string   `json:"nonce,omitempty"`
+	// Rejected, if set, tells the remote side why the connection is
+	// refused. Nothing else follows it on the connection.
+	Rejected string `json:"rejected,omitempty"`
+}
+
+// authProof is the frame sent after the hellos to answer the remote
+// challenge.
+type authProof struct {
+	Signature []byte `json:"signature"`
+}
+
+// Session describes the parameters negotiated on an established connection.
+type Session struct {
+	Remote       *Hello
+	Version      int      // highest protocol version supported by both sides
+	Capabilities []string // capabilities advertised by both sides
+	Encrypted    bool     // whether the connection was upgraded to TLS
+	Outbound     bool     // whether this side dialed the connection
+
+	// sent and received hold the hello frames exactly as they went over
+	// the wire, for the authentication to cover.
+	sent, received []byte
+}
+
+// Has reports whether both sides advertised the given capability.
+func (s *Session) Has(capability string) bool {
+	for _, c := range s.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultCapabilities returns the capabilities supported by this
+// implementation.
+func DefaultCapabilities() []string {
+	return []string{CapEncryption, CapMsgChat, CapMsgHeartbeat, CapMsgPeerList, CapMsgDirect, CapMsgTopics, CapMsgFindNode}
+}
+
+// ExchangeHello sends the local hello and reads the remote one. The write runs
+// concurrently with the read so that unbuffered transports such as net.Pipe do
+// not deadlock when both sides send first. It returns the negotiated session,
+// or an error if the remote hello is malformed or its version range does not
+// overlap with ours.
+func ExchangeHello(conn net.Conn, local *Hello) (*Session, error) {
+	var remote Hello
+	sent, received, err := exchangeFrame(conn, "hello", local, &remote)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := negotiate(local, &remote)
+	if err != nil {
+		return nil, err
+	}
+	sess.sent, sess.received = sent, received
+	return sess, nil
+}
+
+// exchangeFrame sends out as a JSON frame while reading the remote frame into
+// in, and returns both frames as they went over the wire. The write runs
+// concurrently with the read so that unbuffered transports do not deadlock.
+func exchangeFrame(conn net.Conn, what string, out, in interface{}) (sent, received []byte, err error) {
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	writeErr := make(chan error, 1)
+	go func() { writeErr <- message.WriteFrame(conn, data) }()
+
+	frame, err := message.ReadFrame(conn, maxHelloSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s: %w", what, err)
+	}
+	if err := <-writeErr; err != nil {
+		return nil, nil, fmt.Errorf("write %s: %w", what, err)
+	}
+	if err := json.Unmarshal(frame, in); err != nil {
+		return nil, nil, fmt.Errorf("parse %s: %w", what, err)
+	}
+	return data, frame, nil
+}
+
+// negotiate validates the remote hello against the local one.
+func negotiate(local, remote *Hello) (*Session, error) {
+	if remote.Rejected != "" {
+		return nil, fmt.Errorf("%w: %s", ErrRejected, remote.Rejected)
+	}
+	if remote.ID == "" {
+		return nil, fmt.Errorf("empty peer id")
+	}
+	if len(remote.ID) > maxIDLength {
+		return nil, fmt.Errorf("id too long")
+	}
+
+	remoteMin := remote.MinProtocolVersion
+	if remoteMin == 0 {
+		remoteMin = remote.ProtocolVersion
+	}
+	if remote.ProtocolVersion < local.MinProtocolVersion || remoteMin > local.ProtocolVersion {
+		return nil, fmt.Errorf("%w: remote supports %d-%d, local supports %d-%d",
+			ErrIncompatibleVersion, remoteMin, remote.ProtocolVersion,
+			local.MinProtocolVersion, local.ProtocolVersion)
+	}
+
+	version := local.ProtocolVersion
+	if remote.ProtocolVersion < version {
+		version = remote.ProtocolVersion
+	}
+
+	remoteCaps := make(map[string]bool, len(remote.Capabilities))
+	for _, c := range remote.Capabilities {
+		remoteCaps[c] = true
+	}
+	var shared []string
+	for _, c := range local.Capabilities {
+		if remoteCaps[c] {
+			shared = append(shared, c)
+		}
+	}
+
+	return &Session{Remote: remote, Version: version, Capabilities: shared}, nil
+}
+
+// Handshake exchanges hellos on the given connection using the default
+// protocol version and capabilities. It returns the remote ID or an error.
+// The remote ID is not authenticated; use Peer.Handshake for that.
+func Handshake(conn net.Conn, id string) (string, error) {
+	sess, err := ExchangeHello(conn, &Hello{
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		ID:                 id,
+		Capabilities:       DefaultCapabilities(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return sess.Remote.ID, nil
+}
+
+// Handshake performs the handshake on conn using the peer's identity,
+// advertised listen address and capabilities. If both sides support
+// encryption the connection is upgraded to TLS, and the returned conn must be
+// used in place of the original. Each side then signs the other's nonce,
+// proving that it holds the private key its ID is derived from. The
+// signature also covers both hellos, so that a capability list altered in
+// transit, for example to avoid encryption, fails authentication.
+//
+// The handshake must finish within the peer's handshake timeout, if any.
+func (p *Peer) Handshake(conn net.Conn) (net.Conn, *Session, error) {
+	if p.handshakeTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(p.handshakeTimeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	local := p.hello()
+	sess, err := ExchangeHello(conn, local)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sess.Remote.ID == p.ID {
+		return nil, nil, fmt.Errorf("connected to self")
+	}
+
+	if sess.Has(CapEncryption) {
+		if conn, err = p.upgradeTLS(conn, sess.Remote.ID); err != nil {
+			return nil, nil, err
+		}
+		sess.Encrypted = true
+	} else if p.requireEncryption {
+		return nil, nil, fmt.Errorf("%w: %s", ErrEncryptionRequired, sess.Remote.ID)
+	}
+
+	if err := p.authenticate(conn, local, sess); err != nil {
+		return nil, nil, err
+	}
+	return conn, sess, nil
+}
+
+// reject tells the remote side of conn why it is refused and closes conn.
+// Only the hellos are exchanged, so no keys or signatures are spent on it.
+func (p *Peer) reject(conn net.Conn, reason string) {
+	defer conn.Close()
+	if p.handshakeTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(p.handshakeTimeout))
+	}
+	local := &Hello{
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		ID:                 p.ID,
+		Rejected:           reason,
+	}
+	var remote Hello
+	_, _, _ = exchangeFrame(conn, "hello", local, &remote)
+}
+
+// authenticate answers the remote challenge and verifies the remote answer
+// to ours.
+func (p *Peer) authenticate(conn net.Conn, local *Hello, sess *Session) error {
+	remote := sess.Remote
+	if len(remote.PublicKey) != ed25519.PublicKeySize || remote.Nonce == "" {
+		return fmt.Errorf("%w: missing public key or nonce", ErrAuthFailed)
+	}
+	if identity.IDFromPublicKey(remote.PublicKey) != remote.ID {
+		return fmt.Errorf("%w: id %s does not match public key", ErrAuthFailed, remote.ID)
+	}
+
+	proof := authProof{Signature: p.identity.Sign(authPayload(remote.Nonce, local.ID, remote.ID, sess.sent, sess.received))}
+	var remoteProof authProof
+	if _, _, err := exchangeFrame(conn, "auth proof", &proof, &remoteProof); err != nil {
+		return err
+	}
+	if !identity.Verify(remote.PublicKey, authPayload(local.Nonce, remote.ID, local.ID, sess.received, sess.sent), remoteProof.Signature) {
+		return fmt.Errorf("%w: invalid signature from %s", ErrAuthFailed, remote.ID)
+	}
+	return nil
+}
+
+// authPayload builds the data signed by signer in answer to nonce. It ends
+// with a hash of the raw hello frames of the signer and the verifier, so
+// fields this build does not know are covered too.
+func authPayload(nonce, signer, verifier string, signerHello, verifierHello []byte) []byte {
+	b := []byte(authContext + "\x00" + nonce + "\x00" + signer + "\x00" + verifier + "\x00")
+	for _, h := range [][]byte{signerHello, verifierHello} {
+		sum := sha256.Sum256(h)
+		b = append(b, sum[:]...)
+	}
+	return b
+}
+
+// hello builds the local hello for a new connection.
+func (p *Peer) hello() *Hello {
+	return &Hello{
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		ID:                 p.ID,
+		ListenAddr:         p.Addr,
+		NodeVersion:        p.NodeVersion,
+		Capabilities:       p.capabilities,
+		PublicKey:          p.identity.PublicKey(),
+		Nonce:              randomID(),
+	}
+}
@@ -1,10 +1,15 @@
 package peer
 
 import (
-	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
 	"net"
 	"strings"
 	"testing"
+
+	"example.com/p2p/pkg/identity"
+	"example.com/p2p/pkg/message"
 )
 
 // TestHandshakeLongID verifies that Handshake returns an error when the remote
@@ -20,17 +25,304 @@ func TestHandshakeLongID(t *testing.T) {
 		errCh <- err
 	}()
 
-	// Remote side: read the local ID and respond with an overly long ID.
-	r := bufio.NewReader(c2)
-	if _, err := r.ReadString('\n'); err != nil {
-		t.Fatalf("read id: %v", err)
+	// Remote side: read the local hello and respond with an overly long ID.
+	if _, err := message.ReadFrame(c2, 0); err != nil {
+		t.Fatalf("read hello: %v", err)
 	}
-	longID := strings.Repeat("x", 65)
+	data, _ := json.Marshal(&Hello{
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		ID:                 strings.Repeat("x", 65),
+	})
 	// Perform the write in a goroutine so we don't block if the Handshake
 	// stops reading after the error condition is triggered.
-	go func() { _, _ = c2.Write([]byte(longID + "\n")) }()
+	go func() { _ = message.WriteFrame(c2, data) }()
 
 	if err := <-errCh; err == nil {
 		t.Fatal("expected error from long remote id, got nil")
 	}
 }
+
+func TestHandshakeIncompatibleVersion(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	errCh := make(chan error, 2)
+	go func() {
+		_, err := ExchangeHello(c1, &Hello{ProtocolVersion: ProtocolVersion, MinProtocolVersion: MinProtocolVersion, ID: "new"})
+		errCh <- err
+	}()
+	go func() {
+		_, err := ExchangeHello(c2, &Hello{ProtocolVersion: 1, MinProtocolVersion: 1, ID: "old"})
+		errCh <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errCh; !errors.Is(err, ErrIncompatibleVersion) {
+			t.Fatalf("expected ErrIncompatibleVersion, got %v", err)
+		}
+	}
+}
+
+func TestHandshakeNegotiation(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	type result struct {
+		sess *Session
+		err  error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		sess, err := ExchangeHello(c1, &Hello{
+			ProtocolVersion:    3,
+			MinProtocolVersion: 2,
+			ID:                 "a",
+			ListenAddr:         "127.0.0.1:9000",
+			NodeVersion:        "1.1.0",
+			Capabilities:       []string{CapMsgChat, CapCompression},
+		})
+		resCh <- result{sess, err}
+	}()
+
+	sess, err := ExchangeHello(c2, &Hello{
+		ProtocolVersion:    2,
+		MinProtocolVersion: 2,
+		ID:                 "b",
+		Capabilities:       []string{CapMsgChat, CapEncryption},
+	})
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	other := <-resCh
+	if other.err != nil {
+		t.Fatalf("remote handshake: %v", other.err)
+	}
+
+	if sess.Version != 2 || other.sess.Version != 2 {
+		t.Fatalf("expected negotiated version 2, got %d and %d", sess.Version, other.sess.Version)
+	}
+	if sess.Remote.ListenAddr != "127.0.0.1:9000" || sess.Remote.NodeVersion != "1.1.0" {
+		t.Fatalf("unexpected remote hello: %+v", sess.Remote)
+	}
+	if !sess.Has(CapMsgChat) || sess.Has(CapCompression) || sess.Has(CapEncryption) {
+		t.Fatalf("unexpected shared capabilities: %v", sess.Capabilities)
+	}
+}
+
+func TestConnectRecordsSession(t *testing.T) {
+	p1 := New("127.0.0.1:9000")
+	p1.NodeVersion = "test"
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go p1.Serve(ln)
+
+	p2 := New("localhost:0")
+	remoteID, err := p2.Connect(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	sess, ok := p2.Session(remoteID)
+	if !ok {
+		t.Fatal("expected session for connected peer")
+	}
+	if sess.Remote.ListenAddr != p1.Addr || sess.Remote.NodeVersion != "test" {
+		t.Fatalf("unexpected remote hello: %+v", sess.Remote)
+	}
+	if sess.Version != ProtocolVersion {
+		t.Fatalf("expected version %d, got %d", ProtocolVersion, sess.Version)
+	}
+
+	p2.RemoveConn(remoteID)
+	if _, ok := p2.Session(remoteID); ok {
+		t.Fatal("expected session to be removed with connection")
+	}
+}
+
+func TestHandshakeAuthenticatesPeers(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	p1 := New("localhost:0")
+	p2 := New("localhost:0")
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := p1.Handshake(c1)
+		errCh <- err
+	}()
+
+	_, sess, err := p2.Handshake(c2)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("remote handshake: %v", err)
+	}
+	if sess.Remote.ID != p1.ID {
+		t.Fatalf("expected remote id %s, got %s", p1.ID, sess.Remote.ID)
+	}
+}
+
+func TestHandshakeRejectsMismatchedID(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	victim := New("localhost:0")
+	attacker := New("localhost:0")
+	attacker.ID = victim.ID // claim an ID that doesn't match our key
+
+	go func() {
+		_, _, _ = attacker.Handshake(c1)
+	}()
+
+	if _, _, err := New("localhost:0").Handshake(c2); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got %v", err)
+	}
+}
+
+func TestHandshakeRejectsStolenPublicKey(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	victim := New("localhost:0")
+	attacker := New("localhost:0")
+
+	go func() {
+		// Present the victim's ID and public key, but sign with our own key.
+		// Encryption is left out so the forged proof is what gets checked.
+		hello := attacker.hello()
+		hello.ID = victim.ID
+		hello.PublicKey = victim.Identity().PublicKey()
+		hello.Capabilities = []string{CapMsgChat}
+		sess, err := ExchangeHello(c1, hello)
+		if err != nil {
+			return
+		}
+		proof := authProof{Signature: attacker.Identity().Sign(authPayload(sess.Remote.Nonce, hello.ID, sess.Remote.ID, sess.sent, sess.received))}
+		var remoteProof authProof
+		_, _, _ = exchangeFrame(c1, "auth proof", &proof, &remoteProof)
+	}()
+
+	if _, _, err := New("localhost:0").Handshake(c2); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got %v", err)
+	}
+}
+
+// tamperHello relays src to dst, rewriting the hello with tamper, as a
+// man-in-the-middle would.
+func tamperHello(src, dst net.Conn, tamper func([]byte) []byte) {
+	defer dst.Close()
+	frame, err := message.ReadFrame(src, 0)
+	if err != nil {
+		return
+	}
+	if err := message.WriteFrame(dst, tamper(frame)); err != nil {
+		return
+	}
+	io.Copy(dst, src)
+}
+
+// stripEncryption removes CapEncryption from a hello, as a man-in-the-middle
+// downgrading the connection would.
+func stripEncryption(frame []byte) []byte {
+	var hello Hello
+	json.Unmarshal(frame, &hello)
+	var caps []string
+	for _, c := range hello.Capabilities {
+		if c != CapEncryption {
+			caps = append(caps, c)
+		}
+	}
+	hello.Capabilities = caps
+	frame, _ = json.Marshal(&hello)
+	return frame
+}
+
+// injectField adds a field this build does not know to a hello.
+func injectField(frame []byte) []byte {
+	return append([]byte(`{"injected":true,`), frame[1:]...)
+}
+
+func TestHandshakeDetectsDowngrade(t *testing.T) {
+	testHandshakeDetectsTampering(t, stripEncryption)
+}
+
+func TestHandshakeDetectsInjectedField(t *testing.T) {
+	testHandshakeDetectsTampering(t, injectField)
+}
+
+func testHandshakeDetectsTampering(t *testing.T, tamper func([]byte) []byte) {
+	a, ma := net.Pipe()
+	mb, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	go tamperHello(ma, mb, tamper)
+	go tamperHello(mb, ma, tamper)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := New("localhost:0").Handshake(a)
+		errCh <- err
+	}()
+
+	if _, _, err := New("localhost:0").Handshake(b); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got %v", err)
+	}
+	if err := <-errCh; !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed on the other side, got %v", err)
+	}
+}
+
+func TestHandshakeAcceptsUnknownHelloFields(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	future := New("localhost:0")
+	go func() {
+		// A newer node adds a field this build drops when decoding, and
+		// signs the hello exactly as it sent it.
+		hello := future.hello()
+		hello.Capabilities = []string{CapMsgChat}
+		data, _ := json.Marshal(hello)
+		data = append([]byte(`{"future_field":true,`), data[1:]...)
+		var remote Hello
+		sent, received, err := exchangeFrame(c1, "hello", json.RawMessage(data), &remote)
+		if err != nil {
+			return
+		}
+		proof := authProof{Signature: future.Identity().Sign(authPayload(remote.Nonce, hello.ID, remote.ID, sent, received))}
+		var remoteProof authProof
+		_, _, _ = exchangeFrame(c1, "auth proof", &proof, &remoteProof)
+	}()
+
+	_, sess, err := New("localhost:0").Handshake(c2)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if sess.Remote.ID != future.ID {
+		t.Fatalf("expected remote ID %s, got %s", future.ID, sess.Remote.ID)
+	}
+}
+
+func TestSetIdentity(t *testing.T) {
+	ident, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	p := New("localhost:0")
+	p.SetIdentity(ident)
+	if p.ID != ident.ID() {
+		t.Fatalf("expected ID %s, got %s", ident.ID(), p.ID)
+	}
+}
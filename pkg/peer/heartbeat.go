@@ -1,6 +1,9 @@
 package peer
 
 import (
+	"errors"
+	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -8,6 +11,9 @@ import (
 	"example.com/p2p/pkg/message"
 )
 
+// maxOutstandingPings bounds the unanswered pings remembered per peer.
+const maxOutstandingPings = 8
+
 // PeerInfo tracks information about a connected peer
 type PeerInfo struct {
 	ID           string
@@ -15,6 +21,62 @@ type PeerInfo struct {
 	LastSeen     time.Time
 	LastHeartbeat time.Time
 	Conn         interface{} // net.Conn, stored as interface{} to avoid import cycles in tests
+	
+	// Round trip time of the link, measured with ping/pong. SRTT and
+	// RTTVar are smoothed as for TCP (RFC 6298); all three are zero until
+	// the first pong arrives.
+	SRTT    time.Duration
+	RTTVar  time.Duration
+	LastRTT time.Duration
+	
+	// Phi is the failure detector's suspicion level when the snapshot was
+	// taken; the peer is declared dead once it exceeds the threshold.
+	Phi float64
+	
+	pings    map[uint64]time.Time // outstanding ping nonces and when they were sent
+	detector *phiDetector
+	
+	// probing is set while the membership layer checks whether a peer the
+	// detector gave up on is really gone. unreachable is set when the
+	// sender has no link to the peer at all.
+	probing     bool
+	unreachable bool
+}
+
+// addSample folds a round trip time sample into the smoothed estimates.
+func (pi *PeerInfo) addSample(rtt time.Duration) {
+	pi.LastRTT = rtt
+	if pi.SRTT == 0 {
+		pi.SRTT = rtt
+		pi.RTTVar = rtt / 2
+		return
+	}
+	diff := pi.SRTT - rtt
+	if diff < 0 {
+		diff = -diff
+	}
+	pi.RTTVar = (3*pi.RTTVar + diff) / 4
+	pi.SRTT = (7*pi.SRTT + rtt) / 8
+}
+
+// Attach makes the manager send heartbeats through p and handle the
+// heartbeats, pings and pongs p receives from its neighbours. The manager
+// also takes on p's clock.
+func (hm *HeartbeatManager) Attach(p *Peer) {
+	hm.SetSender(p)
+	hm.SetClock(p.clock)
+	p.HandleFunc(message.TypeHeartbeat, hm.HandleHeartbeat)
+	p.HandleFunc(message.TypePing, hm.HandlePing)
+	p.HandleFunc(message.TypePong, hm.HandlePong)
+}
+
+// ErrNotConnected is returned when sending to a peer that is not a neighbour.
+var ErrNotConnected = errors.New("peer not connected")
+
+// HeartbeatSender delivers a heartbeat to one connected peer. *Peer
+// implements it by writing to that peer's connection only.
+type HeartbeatSender interface {
+	SendHeartbeat(peerID string, msg *message.Message) error
 }
 
 // HeartbeatManager manages peer health detection via heartbeats
@@ -25,6 +87,9 @@ type HeartbeatManager struct {
 	mu       sync.RWMutex
 	stopCh   chan struct{}
 	onPeerDead func(peerID string)
+	sender   HeartbeatSender
+	membership *Membership
+	clock    Clock
 	
 	// Statistics
 	heartbeatsSent     int64
@@ -39,9 +104,31 @@ func NewHeartbeatManager(cfg *config.Config, peerID string, onPeerDead func(stri
 		peers:      make(map[string]*PeerInfo),
 		stopCh:     make(chan struct{}),
 		onPeerDead: onPeerDead,
+		clock:      SystemClock,
 	}
 }
 
+// SetSender sets how heartbeats reach monitored peers. Without a sender no
+// heartbeats are sent, and peers stay alive only while they send their own.
+func (hm *HeartbeatManager) SetSender(s HeartbeatSender) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	hm.sender = s
+}
+
+// SetClock replaces the clock that times heartbeats and round trips. It
+// must be called before the manager is started.
+func (hm *HeartbeatManager) SetClock(clock Clock) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	hm.clock = clock
+}
+
+// now returns the current time on the manager's clock.
+func (hm *HeartbeatManager) now() time.Time {
+	return hm.clock.Now()
+}
+
 // Start begins the heartbeat monitoring
 func (hm *HeartbeatManager) Start() {
 	go hm.heartbeatLoop()
@@ -65,18 +152,32 @@ func (hm *HeartbeatManager) Stop() {
 // AddPeer adds a peer to be monitored
 func (hm *HeartbeatManager) AddPeer(id, addr string, conn interface{}) {
 	hm.mu.Lock()
-	defer hm.mu.Unlock()
-	
-	now := time.Now()
+	now := hm.now()
 	hm.peers[id] = &PeerInfo{
 		ID:           id,
 		Addr:         addr,
 		LastSeen:     now,
 		LastHeartbeat: now,
 		Conn:         conn,
+		detector: newPhiDetector(now, time.Duration(hm.config.HeartbeatInterval),
+			time.Duration(hm.config.HeartbeatTimeout), hm.config.PhiWindowSize),
+	}
+	m := hm.membership
+	hm.mu.Unlock()
+	
+	if m != nil {
+		go m.joined(id, addr)
 	}
 }
 
+// arrivedLocked records a heartbeat from peer at now. hm.mu must be held.
+func (hm *HeartbeatManager) arrivedLocked(peer *PeerInfo, now time.Time) {
+	peer.LastHeartbeat = now
+	peer.LastSeen = now
+	peer.detector.heartbeat(now)
+	hm.heartbeatsReceived++
+}
+
 // RemovePeer removes a peer from monitoring
 func (hm *HeartbeatManager) RemovePeer(id string) {
 	hm.mu.Lock()
@@ -90,7 +191,7 @@ func (hm *HeartbeatManager) UpdateLastSeen(id string) {
 	defer hm.mu.Unlock()
 	
 	if peer, exists := hm.peers[id]; exists {
-		peer.LastSeen = time.Now()
+		peer.LastSeen = hm.now()
 	}
 }
 
@@ -100,10 +201,121 @@ func (hm *HeartbeatManager) ProcessHeartbeat(msg *message.Message) {
 	defer hm.mu.Unlock()
 	
 	if peer, exists := hm.peers[msg.SenderID]; exists {
-		peer.LastHeartbeat = time.Now()
-		peer.LastSeen = time.Now()
-		hm.heartbeatsReceived++
+		hm.arrivedLocked(peer, hm.now())
+	}
+}
+
+// HandleHeartbeat handles a heartbeat received directly from the neighbour
+// from. Heartbeats are answered over the same link and either direction
+// counts as proof that the link is alive. It is meant to be registered with
+// Peer.HandleFunc so that heartbeats are never relayed.
+func (hm *HeartbeatManager) HandleHeartbeat(from string, msg *message.Message) {
+	if msg.SenderID != from {
+		return
+	}
+	if !msg.IsHeartbeatReply() {
+		hm.mu.RLock()
+		sender := hm.sender
+		hm.mu.RUnlock()
+		if sender != nil {
+			// Reply from a new goroutine so that the read loop never
+			// blocks writing to the neighbour.
+			go sender.SendHeartbeat(from, message.NewHeartbeatReply(hm.peerID, msg.SequenceNo))
+		}
+	}
+	hm.ProcessHeartbeat(msg)
+}
+
+// HandlePing answers a ping from the neighbour from with a pong echoing its
+// nonce. A ping also proves that the link is alive.
+func (hm *HeartbeatManager) HandlePing(from string, msg *message.Message) {
+	nonce, err := msg.GetNonce()
+	if err != nil || msg.SenderID != from {
+		return
+	}
+	hm.mu.RLock()
+	sender := hm.sender
+	hm.mu.RUnlock()
+	if sender != nil {
+		go sender.SendHeartbeat(from, message.NewPongMessage(hm.peerID, msg.SequenceNo, nonce))
+	}
+	hm.ProcessHeartbeat(msg)
+}
+
+// HandlePong records the round trip time of the ping a pong from the
+// neighbour from answers. Pongs with an unknown nonce are ignored.
+func (hm *HeartbeatManager) HandlePong(from string, msg *message.Message) {
+	nonce, err := msg.GetNonce()
+	if err != nil || msg.SenderID != from {
+		return
+	}
+	hm.mu.Lock()
+	peer, exists := hm.peers[from]
+	if !exists {
+		hm.mu.Unlock()
+		return
+	}
+	sent, ok := peer.pings[nonce]
+	if !ok {
+		hm.mu.Unlock()
+		return
+	}
+	delete(peer.pings, nonce)
+	now := hm.now()
+	peer.addSample(now.Sub(sent))
+	hm.arrivedLocked(peer, now)
+	m := hm.membership
+	hm.mu.Unlock()
+	
+	// The ping may have been sent on behalf of another peer.
+	if m != nil {
+		m.ponged(from, nonce)
+	}
+}
+
+// trackPingTo remembers a ping about to be sent to a monitored peer. It
+// reports false if the peer is not monitored.
+func (hm *HeartbeatManager) trackPingTo(id string, nonce uint64) bool {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	peer, exists := hm.peers[id]
+	if exists {
+		peer.trackPing(nonce, hm.now())
+	}
+	return exists
+}
+
+// GetPeerInfo returns a snapshot of what is known about a monitored peer.
+func (hm *HeartbeatManager) GetPeerInfo(id string) (PeerInfo, bool) {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+	peer, exists := hm.peers[id]
+	if !exists {
+		return PeerInfo{}, false
+	}
+	return peer.snapshot(hm.now()), true
+}
+
+// GetPeerInfos returns snapshots of all monitored peers, sorted by ID.
+func (hm *HeartbeatManager) GetPeerInfos() []PeerInfo {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+	infos := make([]PeerInfo, 0, len(hm.peers))
+	now := hm.now()
+	for _, peer := range hm.peers {
+		infos = append(infos, peer.snapshot(now))
 	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// snapshot returns a copy of pi for callers, with Phi computed at now.
+func (pi *PeerInfo) snapshot(now time.Time) PeerInfo {
+	info := *pi
+	info.Phi = pi.detector.phi(now)
+	info.pings = nil
+	info.detector = nil
+	return info
 }
 
 // GetPeerCount returns the number of monitored peers
@@ -167,42 +379,143 @@ func (hm *HeartbeatManager) healthCheckLoop() {
 	}
 }
 
-// sendHeartbeats sends heartbeat messages to all peers
+// trackPing remembers an outstanding ping, forgetting the oldest one if too
+// many are unanswered.
+func (pi *PeerInfo) trackPing(nonce uint64, sent time.Time) {
+	if pi.pings == nil {
+		pi.pings = make(map[uint64]time.Time)
+	}
+	if len(pi.pings) >= maxOutstandingPings {
+		var oldest uint64
+		var oldestSent time.Time
+		for n, t := range pi.pings {
+			if oldestSent.IsZero() || t.Before(oldestSent) {
+				oldest, oldestSent = n, t
+			}
+		}
+		delete(pi.pings, oldest)
+	}
+	pi.pings[nonce] = sent
+}
+
+// peerIDs returns the IDs of the monitored peers
+func (hm *HeartbeatManager) peerIDs() []string {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+	ids := make([]string, 0, len(hm.peers))
+	for id := range hm.peers {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// sendHeartbeats pings each monitored peer over its own link
 func (hm *HeartbeatManager) sendHeartbeats(sequenceNo int) {
 	hm.mu.RLock()
-	peerCount := len(hm.peers)
+	sender := hm.sender
 	hm.mu.RUnlock()
 	
-	if peerCount > 0 {
-		// This would be called by the main peer to broadcast the heartbeat
-		// We can't directly broadcast here to avoid circular dependencies
+	if sender == nil {
+		return
+	}
+	for _, id := range hm.peerIDs() {
+		nonce := rand.Uint64()
+		msg := message.NewPingMessage(hm.peerID, sequenceNo, nonce)
+		hm.trackPingTo(id, nonce)
+		err := sender.SendHeartbeat(id, msg)
 		hm.mu.Lock()
-		hm.heartbeatsSent++
+		if peer, exists := hm.peers[id]; exists {
+			peer.unreachable = errors.Is(err, ErrNotConnected)
+		}
+		if err == nil {
+			hm.heartbeatsSent++
+		}
 		hm.mu.Unlock()
 	}
 }
 
-// checkPeerHealth checks if any peers have exceeded the heartbeat timeout
+// checkPeerHealth acts on the peers whose silence the failure detector finds
+// too unlikely, given the heartbeat history of their link. Without a
+// membership layer they are declared dead; with one, they are handed to it to
+// probe indirectly. A peer with no link left to it is evicted at once and
+// suspected, so that the rest of the mesh either hears it refute the
+// suspicion or declares it dead
 func (hm *HeartbeatManager) checkPeerHealth() {
 	hm.mu.Lock()
 	defer hm.mu.Unlock()
 	
-	timeout := time.Duration(hm.config.HeartbeatTimeout)
-	now := time.Now()
+	threshold := hm.config.PhiThreshold
+	now := hm.now()
 	deadPeers := make([]string, 0)
 	
 	for id, peer := range hm.peers {
-		if now.Sub(peer.LastHeartbeat) > timeout {
+		if peer.probing || peer.detector.phi(now) <= threshold {
+			continue
+		}
+		if hm.membership == nil || peer.unreachable {
 			deadPeers = append(deadPeers, id)
+			continue
 		}
+		peer.probing = true
+		go hm.membership.probe(id)
 	}
 	
 	// Remove dead peers and notify
 	for _, id := range deadPeers {
-		delete(hm.peers, id)
-		if hm.onPeerDead != nil {
-			// Call without holding the lock to avoid deadlocks
-			go hm.onPeerDead(id)
+		hm.evictLocked(id)
+		if hm.membership != nil {
+			go hm.membership.suspect(id)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// evictLocked stops monitoring a dead peer and reports it. hm.mu must be held.
+func (hm *HeartbeatManager) evictLocked(id string) {
+	delete(hm.peers, id)
+	if hm.onPeerDead != nil {
+		// Call without holding the lock to avoid deadlocks
+		go hm.onPeerDead(id)
+	}
+}
+
+// responsive reports whether the failure detector currently trusts the link
+// to a monitored peer.
+func (hm *HeartbeatManager) responsive(id string) bool {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+	peer, exists := hm.peers[id]
+	return exists && peer.detector.phi(hm.now()) <= hm.config.PhiThreshold
+}
+
+// clearSuspicion resumes normal monitoring of a peer that was being probed
+// and turned out to be alive. The silence counts as one long gap, so the
+// detector becomes more tolerant of the link.
+func (hm *HeartbeatManager) clearSuspicion(id string) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	if peer, exists := hm.peers[id]; exists && peer.probing {
+		peer.probing = false
+		peer.LastSeen = hm.now()
+		peer.detector.heartbeat(peer.LastSeen)
+	}
+}
+
+// evictSuspect declares dead a peer that was being probed.
+func (hm *HeartbeatManager) evictSuspect(id string) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	if peer, exists := hm.peers[id]; exists && peer.probing {
+		hm.evictLocked(id)
+	}
+}
+
+// SendHeartbeat writes msg to the connection with the given peer only.
+func (p *Peer) SendHeartbeat(id string, msg *message.Message) error {
+	p.mu.Lock()
+	_, ok := p.conns[id]
+	p.mu.Unlock()
+	if !ok {
+		return ErrNotConnected
+	}
+	return p.sendWhere(msg, func(c string) bool { return c == id })
+}
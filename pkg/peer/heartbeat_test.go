@@ -1,6 +1,7 @@
 package peer
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -241,4 +242,186 @@ func TestGetPeerListWithMultiplePeers(t *testing.T) {
 	if !found8080 || !found8081 {
 		t.Errorf("expected to find both peer addresses, got %v", peerList)
 	}
-}
\ No newline at end of file
+}
+
+// recordingSender records heartbeats instead of sending them.
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []sentHeartbeat
+	down map[string]bool
+}
+
+type sentHeartbeat struct {
+	to  string
+	msg *message.Message
+}
+
+func (s *recordingSender) SendHeartbeat(peerID string, msg *message.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down[peerID] {
+		return ErrNotConnected
+	}
+	s.sent = append(s.sent, sentHeartbeat{peerID, msg})
+	return nil
+}
+
+func (s *recordingSender) messages() []sentHeartbeat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sentHeartbeat(nil), s.sent...)
+}
+
+func TestSendHeartbeatsPerPeer(t *testing.T) {
+	cfg := config.Default()
+	hm := NewHeartbeatManager(cfg, "test-peer", nil)
+	sender := &recordingSender{down: map[string]bool{"peer3": true}}
+	hm.SetSender(sender)
+	hm.AddPeer("peer1", "localhost:8080", nil)
+	hm.AddPeer("peer2", "localhost:8081", nil)
+	hm.AddPeer("peer3", "localhost:8082", nil)
+	
+	hm.sendHeartbeats(7)
+	
+	sent := sender.messages()
+	if len(sent) != 2 {
+		t.Fatalf("expected a heartbeat to each reachable peer, got %d", len(sent))
+	}
+	for _, s := range sent {
+		if s.msg.Type != message.TypePing || s.msg.SenderID != "test-peer" || s.msg.SequenceNo != 7 {
+			t.Errorf("unexpected heartbeat %+v to %s", s.msg, s.to)
+		}
+	}
+	if sentCount, _, _ := hm.GetPeerStats(); sentCount != 2 {
+		t.Errorf("expected 2 heartbeats counted, got %d", sentCount)
+	}
+}
+
+func TestHandleHeartbeatReplies(t *testing.T) {
+	cfg := config.Default()
+	hm := NewHeartbeatManager(cfg, "test-peer", nil)
+	sender := &recordingSender{}
+	hm.SetSender(sender)
+	hm.AddPeer("peer1", "localhost:8080", nil)
+	
+	hm.HandleHeartbeat("peer1", message.NewHeartbeatMessage("peer1", 3))
+	waitFor(t, func() bool { return len(sender.messages()) == 1 })
+	reply := sender.messages()[0]
+	if reply.to != "peer1" || !reply.msg.IsHeartbeatReply() || reply.msg.SequenceNo != 3 {
+		t.Fatalf("expected reply to peer1 with sequence 3, got %+v to %s", reply.msg, reply.to)
+	}
+	
+	// Replies are not answered, and heartbeats relayed on behalf of
+	// another peer are ignored.
+	hm.HandleHeartbeat("peer1", message.NewHeartbeatReply("peer1", 3))
+	hm.HandleHeartbeat("peer2", message.NewHeartbeatMessage("peer1", 4))
+	time.Sleep(20 * time.Millisecond)
+	if n := len(sender.messages()); n != 1 {
+		t.Fatalf("expected no further replies, got %d", n)
+	}
+	if _, received, _ := hm.GetPeerStats(); received != 2 {
+		t.Fatalf("expected heartbeat and reply counted, got %d", received)
+	}
+}
+
+func TestIdlePeersStayAlive(t *testing.T) {
+	cfg := config.Default()
+	cfg.HeartbeatInterval = config.JSONDuration(20 * time.Millisecond)
+	cfg.HeartbeatTimeout = config.JSONDuration(60 * time.Millisecond)
+	
+	peers := memoryChain(t, 3)
+	dead := make(chan string, 10)
+	managers := make([]*HeartbeatManager, len(peers))
+	for i, p := range peers {
+		hm := NewHeartbeatManager(cfg, p.ID, func(id string) { dead <- id })
+		hm.Attach(p)
+		managers[i] = hm
+	}
+	managers[0].AddPeer(peers[1].ID, peers[1].Addr, nil)
+	managers[1].AddPeer(peers[0].ID, peers[0].Addr, nil)
+	managers[1].AddPeer(peers[2].ID, peers[2].Addr, nil)
+	managers[2].AddPeer(peers[1].ID, peers[1].Addr, nil)
+	for _, hm := range managers {
+		hm.Start()
+		defer hm.Stop()
+	}
+	
+	select {
+	case id := <-dead:
+		t.Fatalf("idle peer %s was declared dead", id)
+	case <-time.After(300 * time.Millisecond):
+	}
+	for i, hm := range managers {
+		if sent, received, _ := hm.GetPeerStats(); sent == 0 || received == 0 {
+			t.Errorf("peer %d: expected heartbeats on the wire, sent %d received %d", i, sent, received)
+		}
+	}
+	// Heartbeats stay on their link and are never delivered as messages.
+	expectNoMessage(t, peers[2])
+	
+	info, ok := managers[0].GetPeerInfo(peers[1].ID)
+	if !ok || info.SRTT <= 0 || info.LastRTT <= 0 {
+		t.Errorf("expected round trip time measured over the link, got %+v", info)
+	}
+}
+
+func TestPongMeasuresRTT(t *testing.T) {
+	cfg := config.Default()
+	hm := NewHeartbeatManager(cfg, "test-peer", nil)
+	sender := &recordingSender{}
+	hm.SetSender(sender)
+	hm.AddPeer("peer1", "localhost:8080", nil)
+	
+	hm.sendHeartbeats(1)
+	ping := sender.messages()[0].msg
+	nonce, _ := ping.GetNonce()
+	time.Sleep(10 * time.Millisecond)
+	
+	// A pong from another peer or with an unknown nonce is ignored.
+	hm.HandlePong("peer2", message.NewPongMessage("peer2", 1, nonce))
+	hm.HandlePong("peer1", message.NewPongMessage("peer1", 1, nonce+1))
+	if info, _ := hm.GetPeerInfo("peer1"); info.LastRTT != 0 {
+		t.Fatalf("expected no sample from foreign pongs, got %v", info.LastRTT)
+	}
+	
+	hm.HandlePong("peer1", message.NewPongMessage("peer1", 1, nonce))
+	info, _ := hm.GetPeerInfo("peer1")
+	if info.LastRTT < 10*time.Millisecond || info.SRTT != info.LastRTT || info.RTTVar != info.LastRTT/2 {
+		t.Fatalf("expected first sample to seed the estimates, got %+v", info)
+	}
+	
+	// The same pong again is not a new sample.
+	hm.HandlePong("peer1", message.NewPongMessage("peer1", 1, nonce))
+	if _, received, _ := hm.GetPeerStats(); received != 1 {
+		t.Fatalf("expected one pong counted, got %d", received)
+	}
+}
+
+func TestRTTSmoothing(t *testing.T) {
+	var info PeerInfo
+	info.addSample(100 * time.Millisecond)
+	info.addSample(20 * time.Millisecond)
+	if info.LastRTT != 20*time.Millisecond {
+		t.Errorf("expected last sample 20ms, got %v", info.LastRTT)
+	}
+	if info.SRTT != 90*time.Millisecond {
+		t.Errorf("expected SRTT 90ms, got %v", info.SRTT)
+	}
+	if info.RTTVar != 57500*time.Microsecond {
+		t.Errorf("expected RTTVar 57.5ms, got %v", info.RTTVar)
+	}
+}
+
+func TestHandlePingReplies(t *testing.T) {
+	cfg := config.Default()
+	hm := NewHeartbeatManager(cfg, "test-peer", nil)
+	sender := &recordingSender{}
+	hm.SetSender(sender)
+	
+	hm.HandlePing("peer1", message.NewPingMessage("peer1", 2, 99))
+	waitFor(t, func() bool { return len(sender.messages()) == 1 })
+	pong := sender.messages()[0]
+	if nonce, _ := pong.msg.GetNonce(); pong.to != "peer1" || pong.msg.Type != message.TypePong || nonce != 99 {
+		t.Fatalf("expected pong with nonce 99 to peer1, got %+v to %s", pong.msg, pong.to)
+	}
+}
@@ -0,0 +1,117 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/dht"
+	"example.com/p2p/pkg/transport"
+)
+
+// limitedPeer starts a peer on mem with the given options.
+func limitedPeer(t *testing.T, mem *transport.Memory, opts ...Option) *Peer {
+	t.Helper()
+	p := New("", append([]Option{WithTransport(mem)}, opts...)...)
+	ln, err := p.Listen("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go p.Serve(ln)
+	return p
+}
+
+func TestInboundLimitRejectsPolitely(t *testing.T) {
+	mem := transport.NewMemory()
+	server := limitedPeer(t, mem, WithMaxConnections(2, 1))
+	a := limitedPeer(t, mem)
+	b := limitedPeer(t, mem)
+
+	if _, err := a.Connect(server.Addr); err != nil {
+		t.Fatalf("expected the first inbound connection to be accepted: %v", err)
+	}
+	_, err := b.Connect(server.Addr)
+	if !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), "connection limit reached") {
+		t.Fatalf("expected a rejection giving the reason, got %v", err)
+	}
+	if got := server.Connections(); got != 1 {
+		t.Errorf("expected 1 connection on the server, got %d", got)
+	}
+	if got := b.Connections(); got != 0 {
+		t.Errorf("expected the rejected peer to hold no connection, got %d", got)
+	}
+}
+
+func TestOutboundLimit(t *testing.T) {
+	mem := transport.NewMemory()
+	p := limitedPeer(t, mem, WithMaxConnections(3, 1))
+	a := limitedPeer(t, mem)
+	b := limitedPeer(t, mem)
+
+	if _, err := p.Connect(a.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Connect(b.Addr); !errors.Is(err, ErrConnectionLimit) {
+		t.Fatalf("expected ErrConnectionLimit for a second outbound dial, got %v", err)
+	}
+	// The remaining slots are for inbound connections.
+	if _, err := b.Connect(p.Addr); err != nil {
+		t.Fatalf("expected an inbound connection to be accepted: %v", err)
+	}
+	waitFor(t, func() bool { return p.Connections() == 2 })
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	mem := transport.NewMemory()
+	server := limitedPeer(t, mem, WithHandshakeTimeout(50*time.Millisecond))
+
+	// A client that never says hello is dropped once the deadline passes.
+	silent, err := mem.Dial(context.Background(), server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	silent.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := silent.Read(make([]byte, 1<<16)); err != nil {
+		t.Fatalf("expected the server hello, got %v", err)
+	}
+	buf := make([]byte, 1<<16)
+	for {
+		_, err := silent.Read(buf)
+		if err == nil {
+			continue
+		}
+		var netErr interface{ Timeout() bool }
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Fatal("expected the server to close a silent connection")
+		}
+		break
+	}
+
+	// The server is free to accept others afterwards.
+	if _, err := limitedPeer(t, mem).Connect(server.Addr); err != nil {
+		t.Fatalf("expected a connection after the timeout: %v", err)
+	}
+}
+
+func TestLookupKeepsContactsAtOutboundLimit(t *testing.T) {
+	mem := transport.NewMemory()
+	p := limitedPeer(t, mem, WithMaxConnections(3, 1))
+	a := limitedPeer(t, mem)
+	b := limitedPeer(t, mem)
+
+	if _, err := p.Connect(a.Addr); err != nil {
+		t.Fatal(err)
+	}
+	p.RoutingTable().Update(dht.Contact{ID: b.ID, Addr: b.Addr})
+	if _, err := p.Lookup(context.Background(), b.ID); err != nil {
+		t.Fatal(err)
+	}
+	// b could not be dialed for want of a slot, which says nothing about b.
+	if _, ok := p.RoutingTable().Find(b.ID); !ok {
+		t.Fatal("expected a contact refused by the local limit to stay in the routing table")
+	}
+}
@@ -0,0 +1,533 @@
+package peer
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/p2p/pkg/config"
+	"example.com/p2p/pkg/dht"
+	"example.com/p2p/pkg/message"
+)
+
+// maxRelayedProbes bounds the pings a peer runs on behalf of others at once.
+const maxRelayedProbes = 64
+
+// maxMembers bounds the members learned through gossip. Updates about
+// members not yet known are ignored once it is reached.
+const maxMembers = 1024
+
+// maxIncarnationJump bounds how far a membership update may raise an
+// incarnation, the peer's own included, above the one known. Incarnations
+// grow by one per refutation, so a larger jump can only be forged, and would
+// let a neighbour push a member towards overflow.
+const maxIncarnationJump = 1 << 16
+
+// deadRetention is how many suspicion timeouts a dead member is remembered
+// for, so that stale claims that it is alive cannot bring it back.
+const deadRetention = 10
+
+// MemberState is the state of a member of the mesh.
+type MemberState int
+
+const (
+	MemberAlive MemberState = iota
+	MemberSuspect
+	MemberDead
+)
+
+// String returns the name of the state as used on the wire.
+func (s MemberState) String() string {
+	switch s {
+	case MemberAlive:
+		return "alive"
+	case MemberSuspect:
+		return "suspect"
+	case MemberDead:
+		return "dead"
+	}
+	return "unknown"
+}
+
+func parseMemberState(s string) (MemberState, bool) {
+	for _, state := range []MemberState{MemberAlive, MemberSuspect, MemberDead} {
+		if s == state.String() {
+			return state, true
+		}
+	}
+	return 0, false
+}
+
+// Member is a peer in the mesh as seen by the membership protocol.
+type Member struct {
+	ID          string
+	Addr        string
+	State       MemberState
+	Incarnation uint64
+	Changed     time.Time // when State last changed
+}
+
+// supersedes reports whether m is newer information than cur about the same
+// member. A higher incarnation always wins; at the same incarnation dead
+// beats suspect, which beats alive.
+func (m Member) supersedes(cur Member) bool {
+	return m.Incarnation > cur.Incarnation ||
+		m.Incarnation == cur.Incarnation && m.State > cur.State
+}
+
+func (m Member) info() message.MemberInfo {
+	return message.MemberInfo{ID: m.ID, Addr: m.Addr, State: m.State.String(), Incarnation: m.Incarnation}
+}
+
+// Membership keeps a view of which peers in the mesh are online, shared
+// between peers in the style of SWIM (Das et al., "SWIM: Scalable
+// Weakly-consistent Infection-style Process Group Membership Protocol").
+//
+// It sits on top of a HeartbeatManager. When the failure detector gives up
+// on a neighbour, the peer asks up to k other neighbours to ping it instead;
+// if any of them gets an answer, the link was at fault and the neighbour
+// stays. Otherwise the neighbour is suspected, and the suspicion is spread
+// through the mesh. A suspected member that is alive hears of it and refutes
+// it by raising its incarnation number; one that does not within the
+// suspicion timeout is declared dead by every peer holding the suspicion.
+//
+// Every change a peer learns is passed on to its other neighbours, and a
+// new neighbour is sent the whole view, so that all peers converge on the
+// same membership.
+type Membership struct {
+	hm               *HeartbeatManager
+	self             string
+	addr             string
+	k                int
+	probeTimeout     time.Duration
+	suspicionTimeout time.Duration
+	onChange         func(Member)
+
+	mu          sync.Mutex
+	incarnation uint64
+	members     map[string]*Member
+	probes      map[uint64]pendingProbe
+	relays      map[uint64]relayedProbe
+	seq         int
+	stopCh      chan struct{}
+}
+
+// pendingProbe is an indirect probe waiting for an acknowledgement.
+type pendingProbe struct {
+	target string
+	acked  chan struct{}
+}
+
+// relayedProbe is a ping sent on behalf of a neighbour, keyed by the nonce
+// of the ping.
+type relayedProbe struct {
+	requester string
+	seq       int
+	probe     message.Probe
+	sent      time.Time
+}
+
+// NewMembership creates the membership layer for hm. addr is the address
+// other peers can dial this one at, and onChange, if not nil, is called
+// whenever the state of another member changes. Heartbeats and membership
+// messages are sent through hm's sender.
+func NewMembership(cfg *config.Config, hm *HeartbeatManager, addr string, onChange func(Member)) *Membership {
+	m := &Membership{
+		hm:               hm,
+		self:             hm.peerID,
+		addr:             addr,
+		k:                cfg.IndirectProbes,
+		probeTimeout:     time.Duration(cfg.HeartbeatTimeout),
+		suspicionTimeout: time.Duration(cfg.SuspicionTimeout),
+		onChange:         onChange,
+		members:          make(map[string]*Member),
+		probes:           make(map[uint64]pendingProbe),
+		relays:           make(map[uint64]relayedProbe),
+		stopCh:           make(chan struct{}),
+	}
+	hm.mu.Lock()
+	hm.membership = m
+	hm.mu.Unlock()
+	return m
+}
+
+// Attach makes the membership layer handle the ping requests and membership
+// messages p receives from its neighbours.
+func (m *Membership) Attach(p *Peer) {
+	p.HandleFunc(message.TypePingReq, m.handlePingReq)
+	p.HandleFunc(message.TypePingReqAck, m.handlePingReqAck)
+	p.HandleFunc(message.TypeMembership, m.handleMembership)
+}
+
+// Stop abandons running probes and stops declaring members dead.
+func (m *Membership) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-m.stopCh:
+	default:
+		close(m.stopCh)
+	}
+}
+
+func (m *Membership) stopped() bool {
+	select {
+	case <-m.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// Incarnation returns the peer's own incarnation number.
+func (m *Membership) Incarnation() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.incarnation
+}
+
+// Member returns what is known about the member with the given ID.
+func (m *Membership) Member(id string) (Member, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id == m.self {
+		return m.selfLocked(), true
+	}
+	mem, ok := m.members[id]
+	if !ok {
+		return Member{}, false
+	}
+	return *mem, true
+}
+
+// Members returns every known member, including the peer itself and dead
+// members not yet forgotten, sorted by ID.
+func (m *Membership) Members() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	members := make([]Member, 0, len(m.members)+1)
+	members = append(members, m.selfLocked())
+	for _, mem := range m.members {
+		members = append(members, *mem)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members
+}
+
+func (m *Membership) selfLocked() Member {
+	return Member{ID: m.self, Addr: m.addr, State: MemberAlive, Incarnation: m.incarnation}
+}
+
+// send writes msg to one neighbour through the heartbeat sender.
+func (m *Membership) send(to string, msg *message.Message) {
+	m.hm.mu.RLock()
+	sender := m.hm.sender
+	m.hm.mu.RUnlock()
+	if sender != nil {
+		sender.SendHeartbeat(to, msg)
+	}
+}
+
+// gossip sends membership updates to every neighbour except the one they
+// came from.
+func (m *Membership) gossip(updates []message.MemberInfo, except string) {
+	m.mu.Lock()
+	m.seq++
+	msg := message.NewMembershipMessage(m.self, m.seq, updates)
+	m.mu.Unlock()
+	for _, id := range m.hm.peerIDs() {
+		if id != except {
+			m.send(id, msg)
+		}
+	}
+}
+
+// joined records a new neighbour as alive and sends it the whole view.
+func (m *Membership) joined(id, addr string) {
+	m.mu.Lock()
+	_, known := m.members[id]
+	if !known {
+		m.members[id] = &Member{ID: id, Addr: addr, State: MemberAlive, Changed: m.hm.now()}
+	}
+	view := []message.MemberInfo{m.selfLocked().info()}
+	for _, mem := range m.members {
+		view = append(view, mem.info())
+	}
+	m.seq++
+	msg := message.NewMembershipMessage(m.self, m.seq, view)
+	added := *m.members[id]
+	m.mu.Unlock()
+
+	m.send(id, msg)
+	if !known {
+		m.changed(added)
+		m.gossip([]message.MemberInfo{added.info()}, id)
+	}
+}
+
+// applyLocked records upd if it supersedes what is known about the member
+// and reports whether it did. m.mu must be held.
+func (m *Membership) applyLocked(upd *Member) bool {
+	cur, ok := m.members[upd.ID]
+	if ok && !upd.supersedes(*cur) {
+		if cur.Addr == "" {
+			cur.Addr = upd.Addr
+		}
+		return false
+	}
+	if ok && upd.Addr == "" {
+		upd.Addr = cur.Addr
+	}
+	upd.Changed = m.hm.now()
+	stored := *upd
+	m.members[upd.ID] = &stored
+	return true
+}
+
+// changed acts on a member having changed state. It must be called without
+// m.mu held.
+func (m *Membership) changed(mem Member) {
+	switch mem.State {
+	case MemberAlive:
+		m.hm.clearSuspicion(mem.ID)
+	case MemberSuspect:
+		time.AfterFunc(m.suspicionTimeout, func() { m.expire(mem.ID, mem.Incarnation) })
+	case MemberDead:
+		m.hm.evictSuspect(mem.ID)
+		time.AfterFunc(deadRetention*m.suspicionTimeout, func() { m.forget(mem.ID, mem.Incarnation) })
+	}
+	if m.onChange != nil {
+		m.onChange(mem)
+	}
+}
+
+// expire declares a member dead if it is still suspected at the given
+// incarnation.
+func (m *Membership) expire(id string, incarnation uint64) {
+	m.mu.Lock()
+	cur, ok := m.members[id]
+	if m.stopped() || !ok || cur.State != MemberSuspect || cur.Incarnation != incarnation {
+		m.mu.Unlock()
+		return
+	}
+	dead := Member{ID: id, Addr: cur.Addr, State: MemberDead, Incarnation: incarnation}
+	m.applyLocked(&dead)
+	m.mu.Unlock()
+
+	m.changed(dead)
+	m.gossip([]message.MemberInfo{dead.info()}, "")
+}
+
+// forget drops a member that is still dead at the given incarnation.
+func (m *Membership) forget(id string, incarnation uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur, ok := m.members[id]; ok && cur.State == MemberDead && cur.Incarnation == incarnation {
+		delete(m.members, id)
+	}
+}
+
+// probe checks whether a neighbour the failure detector gave up on is alive
+// by asking up to k other neighbours to ping it. If none of them gets an
+// answer and the direct link has not recovered meanwhile, the neighbour is
+// suspected.
+func (m *Membership) probe(target string) {
+	var helpers []string
+	for _, id := range m.hm.peerIDs() {
+		if id != target && m.hm.responsive(id) {
+			helpers = append(helpers, id)
+		}
+	}
+	rand.Shuffle(len(helpers), func(i, j int) { helpers[i], helpers[j] = helpers[j], helpers[i] })
+	if len(helpers) > m.k {
+		helpers = helpers[:m.k]
+	}
+
+	nonce := rand.Uint64()
+	acked := make(chan struct{}, 1)
+	m.mu.Lock()
+	m.probes[nonce] = pendingProbe{target: target, acked: acked}
+	m.seq++
+	req := message.NewPingReqMessage(m.self, m.seq, target, nonce)
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.probes, nonce)
+		m.mu.Unlock()
+	}()
+	for _, id := range helpers {
+		m.send(id, req)
+	}
+
+	timer := time.NewTimer(m.probeTimeout)
+	defer timer.Stop()
+	alive := false
+	select {
+	case <-acked:
+		alive = true
+	case <-timer.C:
+	case <-m.stopCh:
+		return
+	}
+	if alive || m.hm.responsive(target) {
+		m.hm.clearSuspicion(target)
+		return
+	}
+	m.suspect(target)
+}
+
+// suspect marks a member as suspected at its current incarnation.
+func (m *Membership) suspect(id string) {
+	m.mu.Lock()
+	upd := Member{ID: id, State: MemberSuspect}
+	if cur, ok := m.members[id]; ok {
+		upd.Incarnation = cur.Incarnation
+	}
+	applied := m.applyLocked(&upd)
+	var state MemberState
+	if cur, ok := m.members[id]; ok {
+		state = cur.State
+	}
+	m.mu.Unlock()
+
+	if applied {
+		m.changed(upd)
+		m.gossip([]message.MemberInfo{upd.info()}, "")
+	} else if state == MemberDead {
+		m.hm.evictSuspect(id)
+	}
+}
+
+// handlePingReq pings a neighbour on behalf of the neighbour from. The
+// request is ignored if the target is not a neighbour.
+func (m *Membership) handlePingReq(from string, msg *message.Message) {
+	probe, err := msg.GetProbe()
+	if err != nil || msg.SenderID != from || probe.Target == from {
+		return
+	}
+	if probe.Target == m.self {
+		go m.send(from, message.NewPingReqAckMessage(m.self, msg.SequenceNo, probe.Target, probe.Nonce))
+		return
+	}
+
+	now := m.hm.now()
+	m.mu.Lock()
+	for nonce, r := range m.relays {
+		if now.Sub(r.sent) > m.probeTimeout {
+			delete(m.relays, nonce)
+		}
+	}
+	full := len(m.relays) >= maxRelayedProbes
+	m.mu.Unlock()
+	nonce := rand.Uint64()
+	if full || !m.hm.trackPingTo(probe.Target, nonce) {
+		return
+	}
+	m.mu.Lock()
+	m.relays[nonce] = relayedProbe{requester: from, seq: msg.SequenceNo, probe: probe, sent: now}
+	m.mu.Unlock()
+	// Send from a new goroutine so that the read loop never blocks writing
+	// to the neighbour.
+	go m.send(probe.Target, message.NewPingMessage(m.self, msg.SequenceNo, nonce))
+}
+
+// ponged passes the answer to a ping sent on another peer's behalf back to
+// it.
+func (m *Membership) ponged(from string, nonce uint64) {
+	m.mu.Lock()
+	r, ok := m.relays[nonce]
+	if ok && r.probe.Target == from {
+		delete(m.relays, nonce)
+	}
+	m.mu.Unlock()
+	if ok && r.probe.Target == from {
+		go m.send(r.requester, message.NewPingReqAckMessage(m.self, r.seq, r.probe.Target, r.probe.Nonce))
+	}
+}
+
+// handlePingReqAck completes the indirect probe an acknowledgement answers.
+func (m *Membership) handlePingReqAck(from string, msg *message.Message) {
+	probe, err := msg.GetProbe()
+	if err != nil || msg.SenderID != from {
+		return
+	}
+	m.mu.Lock()
+	p, ok := m.probes[probe.Nonce]
+	m.mu.Unlock()
+	if !ok || p.target != probe.Target {
+		return
+	}
+	select {
+	case p.acked <- struct{}{}:
+	default:
+	}
+}
+
+// handleMembership merges membership updates from the neighbour from and
+// passes on the ones that were news. Claims that the peer itself is
+// suspected or dead are refuted by raising its incarnation. Updates with a
+// malformed ID or an implausible incarnation are ignored, as are new members
+// once maxMembers are known.
+func (m *Membership) handleMembership(from string, msg *message.Message) {
+	infos, err := msg.GetMembers()
+	if err != nil || msg.SenderID != from {
+		return
+	}
+	var news []Member
+	var updates []message.MemberInfo
+	refute := false
+	m.mu.Lock()
+	for _, info := range infos {
+		state, ok := parseMemberState(info.State)
+		if !ok || !dht.IsID(info.ID) {
+			continue
+		}
+		if info.ID == m.self {
+			if !plausibleIncarnation(info.Incarnation, m.incarnation) {
+				continue
+			}
+			if info.Incarnation > m.incarnation ||
+				state != MemberAlive && info.Incarnation == m.incarnation {
+				m.incarnation = info.Incarnation + 1
+				refute = true
+			}
+			continue
+		}
+		var known uint64
+		if cur, ok := m.members[info.ID]; ok {
+			known = cur.Incarnation
+		} else if len(m.members) >= maxMembers {
+			continue
+		}
+		if !plausibleIncarnation(info.Incarnation, known) {
+			continue
+		}
+		upd := Member{ID: info.ID, Addr: info.Addr, State: state, Incarnation: info.Incarnation}
+		if m.applyLocked(&upd) {
+			news = append(news, upd)
+			updates = append(updates, upd.info())
+		}
+	}
+	except := from
+	if refute {
+		updates = append(updates, m.selfLocked().info())
+		except = ""
+	}
+	m.mu.Unlock()
+
+	for _, mem := range news {
+		m.changed(mem)
+	}
+	if len(updates) > 0 {
+		// Gossip from a new goroutine so that the read loop never blocks
+		// writing to a neighbour.
+		go m.gossip(updates, except)
+	}
+}
+
+// plausibleIncarnation reports whether an update may carry incarnation inc
+// for a member currently known at cur.
+func plausibleIncarnation(inc, cur uint64) bool {
+	return inc <= cur || inc-cur <= maxIncarnationJump
+}
@@ -0,0 +1,361 @@
+package peer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/config"
+	"example.com/p2p/pkg/dht"
+	"example.com/p2p/pkg/message"
+)
+
+// IDs of the simulated nodes. Membership ignores members whose ID is not a
+// well-formed peer ID.
+var (
+	idA = strings.Repeat("a", 2*dht.IDLength)
+	idB = strings.Repeat("b", 2*dht.IDLength)
+	idC = strings.Repeat("c", 2*dht.IDLength)
+)
+
+// simNet connects heartbeat managers and their membership layers in memory.
+// Messages on a cut link, or to or from a crashed node, are lost.
+type simNet struct {
+	mu    sync.Mutex
+	nodes map[string]*simNode
+	links map[[2]string]bool
+	cut   map[[2]string]bool
+	down  map[string]bool
+}
+
+type simNode struct {
+	hm   *HeartbeatManager
+	m    *Membership
+	dead chan string
+}
+
+type simSender struct {
+	net  *simNet
+	from string
+}
+
+func link(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// newSimNet creates a node for each ID and links the given pairs.
+func newSimNet(t *testing.T, cfg *config.Config, ids []string, pairs ...[2]string) *simNet {
+	t.Helper()
+	n := &simNet{
+		nodes: make(map[string]*simNode),
+		links: make(map[[2]string]bool),
+		cut:   make(map[[2]string]bool),
+		down:  make(map[string]bool),
+	}
+	for _, id := range ids {
+		dead := make(chan string, 10)
+		hm := NewHeartbeatManager(cfg, id, func(peerID string) { dead <- peerID })
+		hm.SetSender(simSender{n, id})
+		n.nodes[id] = &simNode{hm: hm, m: NewMembership(cfg, hm, id+":1", nil), dead: dead}
+	}
+	for _, pair := range pairs {
+		n.links[link(pair[0], pair[1])] = true
+	}
+	for _, pair := range pairs {
+		n.nodes[pair[0]].hm.AddPeer(pair[1], pair[1]+":1", nil)
+		n.nodes[pair[1]].hm.AddPeer(pair[0], pair[0]+":1", nil)
+	}
+	t.Cleanup(func() {
+		for _, node := range n.nodes {
+			node.hm.Stop()
+			node.m.Stop()
+		}
+	})
+	return n
+}
+
+func (n *simNet) start() {
+	for _, node := range n.nodes {
+		node.hm.Start()
+	}
+}
+
+func (n *simNet) setCut(a, b string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.cut[link(a, b)] = true
+}
+
+// disconnect closes the link between a and b.
+func (n *simNet) disconnect(a, b string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.links, link(a, b))
+}
+
+func (n *simNet) crash(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.down[id] = true
+}
+
+func (s simSender) SendHeartbeat(to string, msg *message.Message) error {
+	n := s.net
+	n.mu.Lock()
+	node := n.nodes[to]
+	linked := n.links[link(s.from, to)]
+	lost := n.cut[link(s.from, to)] || n.down[s.from] || n.down[to]
+	n.mu.Unlock()
+	if !linked {
+		return ErrNotConnected
+	}
+	if !lost {
+		go node.deliver(s.from, msg)
+	}
+	return nil
+}
+
+func (node *simNode) deliver(from string, msg *message.Message) {
+	switch msg.Type {
+	case message.TypePing:
+		node.hm.HandlePing(from, msg)
+	case message.TypePong:
+		node.hm.HandlePong(from, msg)
+	case message.TypePingReq:
+		node.m.handlePingReq(from, msg)
+	case message.TypePingReqAck:
+		node.m.handlePingReqAck(from, msg)
+	case message.TypeMembership:
+		node.m.handleMembership(from, msg)
+	}
+}
+
+func membershipConfig() *config.Config {
+	cfg := config.Default()
+	cfg.HeartbeatInterval = config.JSONDuration(20 * time.Millisecond)
+	cfg.HeartbeatTimeout = config.JSONDuration(40 * time.Millisecond)
+	cfg.SuspicionTimeout = config.JSONDuration(100 * time.Millisecond)
+	cfg.IndirectProbes = 2
+	return cfg
+}
+
+func expectState(t *testing.T, m *Membership, id string, state MemberState) {
+	t.Helper()
+	waitFor(t, func() bool {
+		mem, ok := m.Member(id)
+		return ok && mem.State == state
+	})
+}
+
+func TestMemberSupersedes(t *testing.T) {
+	tests := []struct {
+		upd, cur Member
+		want     bool
+	}{
+		{Member{State: MemberAlive, Incarnation: 2}, Member{State: MemberSuspect, Incarnation: 1}, true},
+		{Member{State: MemberAlive, Incarnation: 1}, Member{State: MemberSuspect, Incarnation: 1}, false},
+		{Member{State: MemberSuspect, Incarnation: 1}, Member{State: MemberAlive, Incarnation: 1}, true},
+		{Member{State: MemberSuspect, Incarnation: 1}, Member{State: MemberSuspect, Incarnation: 1}, false},
+		{Member{State: MemberDead, Incarnation: 1}, Member{State: MemberSuspect, Incarnation: 1}, true},
+		{Member{State: MemberSuspect, Incarnation: 0}, Member{State: MemberAlive, Incarnation: 1}, false},
+		{Member{State: MemberAlive, Incarnation: 3}, Member{State: MemberDead, Incarnation: 2}, true},
+		{Member{State: MemberAlive, Incarnation: 2}, Member{State: MemberDead, Incarnation: 2}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.upd.supersedes(tt.cur); got != tt.want {
+			t.Errorf("%s/%d over %s/%d: got %v, want %v",
+				tt.upd.State, tt.upd.Incarnation, tt.cur.State, tt.cur.Incarnation, got, tt.want)
+		}
+	}
+}
+
+func TestMembershipSpreadsByGossip(t *testing.T) {
+	n := newSimNet(t, membershipConfig(), []string{idA, idB, idC}, [2]string{idA, idB}, [2]string{idB, idC})
+
+	// a and c are not neighbours but learn of each other through b.
+	expectState(t, n.nodes[idA].m, idC, MemberAlive)
+	expectState(t, n.nodes[idC].m, idA, MemberAlive)
+	if mem, _ := n.nodes[idA].m.Member(idC); mem.Addr != idC+":1" {
+		t.Errorf("expected c's address to spread, got %q", mem.Addr)
+	}
+	if got := len(n.nodes[idB].m.Members()); got != 3 {
+		t.Errorf("expected 3 members including self, got %d", got)
+	}
+}
+
+func TestIndirectProbeKeepsFlakyLink(t *testing.T) {
+	n := newSimNet(t, membershipConfig(), []string{idA, idB, idC},
+		[2]string{idA, idB}, [2]string{idA, idC}, [2]string{idB, idC})
+	n.start()
+	n.setCut(idA, idB)
+
+	select {
+	case id := <-n.nodes[idA].dead:
+		t.Fatalf("peer %s behind a flaky link was declared dead", id)
+	case <-time.After(500 * time.Millisecond):
+	}
+	if _, ok := n.nodes[idA].hm.GetPeerInfo(idB); !ok {
+		t.Error("expected b to stay monitored")
+	}
+	if mem, _ := n.nodes[idC].m.Member(idB); mem.State != MemberAlive {
+		t.Errorf("expected b alive for its other neighbours, got %s", mem.State)
+	}
+	// c answered for b, so b was never suspected and never had to refute.
+	if inc := n.nodes[idB].m.Incarnation(); inc != 0 {
+		t.Errorf("expected b never to be suspected, got incarnation %d", inc)
+	}
+}
+
+func TestCrashedPeerDeclaredDead(t *testing.T) {
+	n := newSimNet(t, membershipConfig(), []string{idA, idB, idC},
+		[2]string{idA, idB}, [2]string{idA, idC}, [2]string{idB, idC})
+	n.start()
+	expectState(t, n.nodes[idA].m, idC, MemberAlive)
+	n.crash(idB)
+
+	for _, id := range []string{idA, idC} {
+		select {
+		case dead := <-n.nodes[id].dead:
+			if dead != idB {
+				t.Fatalf("%s: expected b declared dead, got %s", id, dead)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: expected crashed peer declared dead", id)
+		}
+		expectState(t, n.nodes[id].m, idB, MemberDead)
+	}
+	if mem, _ := n.nodes[idA].m.Member(idC); mem.State != MemberAlive {
+		t.Errorf("expected c to stay alive, got %s", mem.State)
+	}
+}
+
+func TestDepartedPeerDeclaredDead(t *testing.T) {
+	n := newSimNet(t, membershipConfig(), []string{idA, idB, idC},
+		[2]string{idA, idB}, [2]string{idA, idC}, [2]string{idB, idC})
+	n.start()
+	expectState(t, n.nodes[idA].m, idC, MemberAlive)
+	// b leaves by closing its connections, so sends to it fail outright.
+	n.disconnect(idA, idB)
+	n.disconnect(idB, idC)
+
+	for _, id := range []string{idA, idC} {
+		select {
+		case dead := <-n.nodes[id].dead:
+			if dead != idB {
+				t.Fatalf("%s: expected b evicted, got %s", id, dead)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: expected departed peer evicted", id)
+		}
+		expectState(t, n.nodes[id].m, idB, MemberDead)
+	}
+}
+
+func TestClosedLinkSuspicionRefuted(t *testing.T) {
+	cfg := membershipConfig()
+	cfg.SuspicionTimeout = config.JSONDuration(time.Minute)
+	n := newSimNet(t, cfg, []string{idA, idB, idC},
+		[2]string{idA, idB}, [2]string{idA, idC}, [2]string{idB, idC})
+	n.start()
+	expectState(t, n.nodes[idA].m, idC, MemberAlive)
+	n.disconnect(idA, idB)
+
+	// a suspects b, and b, still linked to c, hears of it and refutes.
+	waitFor(t, func() bool { return n.nodes[idB].m.Incarnation() == 1 })
+	for _, id := range []string{idA, idC} {
+		waitFor(t, func() bool {
+			mem, _ := n.nodes[id].m.Member(idB)
+			return mem.State == MemberAlive && mem.Incarnation == 1
+		})
+	}
+}
+
+func TestSuspicionRefuted(t *testing.T) {
+	cfg := membershipConfig()
+	cfg.SuspicionTimeout = config.JSONDuration(time.Minute)
+	n := newSimNet(t, cfg, []string{idA, idB, idC}, [2]string{idA, idB}, [2]string{idB, idC})
+	expectState(t, n.nodes[idC].m, idA, MemberAlive)
+
+	n.nodes[idC].m.suspect(idA)
+
+	// The suspicion reaches a through b, and a's refutation reaches c.
+	waitFor(t, func() bool { return n.nodes[idA].m.Incarnation() == 1 })
+	for _, id := range []string{idB, idC} {
+		waitFor(t, func() bool {
+			mem, _ := n.nodes[id].m.Member(idA)
+			return mem.State == MemberAlive && mem.Incarnation == 1
+		})
+	}
+}
+
+func TestMembershipOverPeers(t *testing.T) {
+	cfg := membershipConfig()
+	peers := memoryChain(t, 3)
+	members := make([]*Membership, len(peers))
+	for i, p := range peers {
+		hm := NewHeartbeatManager(cfg, p.ID, nil)
+		hm.Attach(p)
+		members[i] = NewMembership(cfg, hm, p.Addr, nil)
+		members[i].Attach(p)
+		defer members[i].Stop()
+		if i > 0 {
+			hm.AddPeer(peers[i-1].ID, peers[i-1].Addr, nil)
+		}
+		if i < len(peers)-1 {
+			hm.AddPeer(peers[i+1].ID, peers[i+1].Addr, nil)
+		}
+	}
+
+	expectState(t, members[0], peers[2].ID, MemberAlive)
+	expectState(t, members[2], peers[0].ID, MemberAlive)
+	// Membership messages stay on their link.
+	expectNoMessage(t, peers[1])
+}
+
+func TestMembershipIgnoresBogusUpdates(t *testing.T) {
+	n := newSimNet(t, membershipConfig(), []string{idA, idB}, [2]string{idA, idB})
+	m := n.nodes[idA].m
+	expectState(t, m, idB, MemberAlive)
+
+	idD := strings.Repeat("d", 2*dht.IDLength)
+	m.handleMembership(idB, message.NewMembershipMessage(idB, 100, []message.MemberInfo{
+		{ID: "not-an-id", Addr: "x:1", State: "alive"},
+		{ID: idD, Addr: "d:1", State: "alive", Incarnation: maxIncarnationJump + 1},
+		{ID: idA, State: "dead", Incarnation: math.MaxUint64},
+		{ID: idB, State: "dead", Incarnation: math.MaxUint64},
+	}))
+	if _, ok := m.Member("not-an-id"); ok {
+		t.Error("expected a malformed ID to be ignored")
+	}
+	if _, ok := m.Member(idD); ok {
+		t.Error("expected a member with an implausible incarnation to be ignored")
+	}
+	if inc := m.Incarnation(); inc != 0 {
+		t.Errorf("expected own incarnation to stay 0, got %d", inc)
+	}
+	if mem, _ := m.Member(idB); mem.State != MemberAlive || mem.Incarnation != 0 {
+		t.Errorf("expected b to stay alive at 0, got %s/%d", mem.State, mem.Incarnation)
+	}
+}
+
+func TestMembershipBounded(t *testing.T) {
+	n := newSimNet(t, membershipConfig(), []string{idA, idB}, [2]string{idA, idB})
+	m := n.nodes[idA].m
+	expectState(t, m, idB, MemberAlive)
+
+	infos := make([]message.MemberInfo, maxMembers+10)
+	for i := range infos {
+		infos[i] = message.MemberInfo{ID: fmt.Sprintf("%032x", i+1), Addr: "x:1", State: "alive"}
+	}
+	m.handleMembership(idB, message.NewMembershipMessage(idB, 100, infos))
+	// The view holds at most maxMembers others, plus the peer itself.
+	if got := len(m.Members()); got != maxMembers+1 {
+		t.Errorf("expected %d members, got %d", maxMembers+1, got)
+	}
+}
@@ -0,0 +1,140 @@
+package peer
+
+import (
+	"fmt"
+	"time"
+
+	"example.com/p2p/pkg/config"
+	"example.com/p2p/pkg/dedup"
+	"example.com/p2p/pkg/logger"
+	"example.com/p2p/pkg/message"
+	"example.com/p2p/pkg/transport"
+)
+
+// Option configures a peer created by New or NewWithConfig. Options are
+// applied in order, so a later option overrides an earlier one.
+type Option func(*Peer)
+
+// WithConfig applies the settings of cfg that concern a single peer: buffer
+// and cache sizes, connection limits and timeouts, message limits, security
+// requirements, the overflow policy and the circuit breaker. A nil cfg
+// changes nothing.
+func WithConfig(cfg *config.Config) Option {
+	return func(p *Peer) {
+		if cfg == nil {
+			return
+		}
+		if cfg.DedupCacheSize > 0 {
+			WithDedupCacheSize(cfg.DedupCacheSize)(p)
+		}
+		if cfg.MessageBufferSize > 0 {
+			WithMessageBuffer(cfg.MessageBufferSize)(p)
+		}
+		if cfg.OverflowPolicy != "" {
+			WithOverflowPolicy(cfg.OverflowPolicy, cfg.SpillFile)(p)
+		}
+		WithMaxConnections(cfg.MaxConnections, cfg.OutboundLimit())(p)
+		WithDialTimeout(time.Duration(cfg.ConnectTimeout))(p)
+		WithHandshakeTimeout(time.Duration(cfg.ConnectTimeout))(p)
+		if cfg.MaxFrameSize > 0 {
+			p.maxFrameSize = cfg.MaxFrameSize
+		}
+		if cfg.MessageTTL > 0 {
+			p.ttl = cfg.MessageTTL
+		}
+		p.requireSignatures = cfg.RequireSignedMessages
+		p.requireEncryption = cfg.RequireEncryption
+		p.breaker = nil
+		p.breakerThreshold = cfg.BreakerThreshold
+		p.backoff = NewBackoffPolicy(cfg)
+	}
+}
+
+// WithDedupCacheSize sets how many recently seen messages are remembered to
+// drop duplicates. The default is 100.
+func WithDedupCacheSize(n int) Option {
+	return func(p *Peer) {
+		p.seen = dedup.New(n)
+	}
+}
+
+// WithMessageBuffer sets the capacity of the Messages channel. The default
+// is 16.
+func WithMessageBuffer(n int) Option {
+	return func(p *Peer) {
+		p.Messages = make(chan *message.Message, n)
+	}
+}
+
+// WithOverflowPolicy sets what happens to incoming messages when Messages is
+// full; see SetOverflowPolicy. It panics on an unknown policy, which
+// config.Validate rejects in configurations.
+func WithOverflowPolicy(policy, spillFile string) Option {
+	return func(p *Peer) {
+		if err := p.SetOverflowPolicy(policy, spillFile); err != nil {
+			panic(fmt.Sprintf("peer: %v", err))
+		}
+	}
+}
+
+// WithMaxConnections sets the most connections the peer holds at once, and
+// how many of them it may dial itself; the rest are left for peers that
+// connect to it. Connections beyond the limit are refused with
+// ErrConnectionLimit. A max of zero means no limit, which is the default,
+// and an outbound of zero lets both directions share every slot.
+func WithMaxConnections(max, outbound int) Option {
+	return func(p *Peer) {
+		p.maxConns = max
+		p.maxOutbound = outbound
+	}
+}
+
+// WithDialTimeout bounds how long an outbound dial may take. Zero means no
+// limit, which is the default.
+func WithDialTimeout(d time.Duration) Option {
+	return func(p *Peer) {
+		p.dialTimeout = d
+	}
+}
+
+// WithHandshakeTimeout bounds how long the handshake on a new connection
+// may take, in either direction. Zero means no limit, which is the default.
+func WithHandshakeTimeout(d time.Duration) Option {
+	return func(p *Peer) {
+		p.handshakeTimeout = d
+	}
+}
+
+// WithLogger sets the logger used to report dropped messages.
+func WithLogger(l *logger.Logger) Option {
+	return func(p *Peer) {
+		p.logger = l
+	}
+}
+
+// WithClock sets the clock the peer schedules by: its circuit breaker, the
+// starting point of its acknowledgement sequence numbers, and the heartbeat
+// and reconnect managers built for it. Connection deadlines always follow
+// the real time. The default is SystemClock.
+func WithClock(c Clock) Option {
+	return func(p *Peer) {
+		p.clock = c
+	}
+}
+
+// WithTransport sets the transport used to dial and listen; see
+// SetTransport. The default is transport.Default().
+func WithTransport(t transport.Transport) Option {
+	return func(p *Peer) {
+		p.transport = t
+	}
+}
+
+// WithCircuitBreaker makes outbound dials go through cb instead of a
+// breaker built from the configuration. A nil cb lets every dial through.
+func WithCircuitBreaker(cb *CircuitBreaker) Option {
+	return func(p *Peer) {
+		p.breaker = cb
+		p.breakerThreshold = 0
+	}
+}
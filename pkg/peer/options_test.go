@@ -0,0 +1,108 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/config"
+	"example.com/p2p/pkg/message"
+	"example.com/p2p/pkg/transport"
+)
+
+// stallTransport never completes a dial before its context ends.
+type stallTransport struct{}
+
+func (stallTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (stallTransport) Listen(addr string) (net.Listener, error) {
+	return nil, errors.New("stall transport cannot listen")
+}
+
+func TestNewWithConfigAppliesSettings(t *testing.T) {
+	cfg := config.Default()
+	cfg.MessageBufferSize = 32
+	cfg.DedupCacheSize = 2
+	cfg.MaxConnections = 7
+	cfg.ConnectTimeout = config.JSONDuration(3 * time.Second)
+	cfg.MessageTTL = 4
+	p := NewWithConfig("localhost:0", cfg)
+
+	if got := cap(p.Messages); got != 32 {
+		t.Errorf("expected a 32-slot Messages channel, got %d", got)
+	}
+	if p.maxConns != 7 || p.maxOutbound != 2 || p.dialTimeout != 3*time.Second || p.ttl != 4 {
+		t.Errorf("expected limits from config, got max %d, outbound %d, timeout %v, ttl %d", p.maxConns, p.maxOutbound, p.dialTimeout, p.ttl)
+	}
+	if p.CircuitBreaker() == nil {
+		t.Error("expected a circuit breaker from config")
+	}
+
+	// Only the two most recent messages are remembered.
+	for i := 1; i <= 3; i++ {
+		p.Seen(message.NewChatMessage("sender", i, "hi"))
+	}
+	if p.Seen(message.NewChatMessage("sender", 1, "hi")) {
+		t.Error("expected the oldest message to be forgotten with a dedup cache of 2")
+	}
+}
+
+func TestOptionsOverrideConfig(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	mem := transport.NewMemory()
+	p := NewWithConfig("localhost:0", config.Default(),
+		WithMessageBuffer(4),
+		WithClock(clock),
+		WithTransport(mem),
+	)
+	if got := cap(p.Messages); got != 4 {
+		t.Errorf("expected the option to override the buffer size, got %d", got)
+	}
+	if p.transport != mem {
+		t.Error("expected the transport option to be used")
+	}
+	if cb := p.CircuitBreaker(); cb == nil || cb.clock != clock {
+		t.Error("expected the circuit breaker to use the injected clock")
+	}
+	if got := p.ackSeq.Load(); got != 0 {
+		t.Errorf("expected acknowledgement numbers to start from the injected clock, got %d", got)
+	}
+	hm := NewHeartbeatManager(config.Default(), p.ID, nil)
+	hm.Attach(p)
+	if hm.clock != clock {
+		t.Error("expected the heartbeat manager to take on the injected clock")
+	}
+	if rm := NewReconnectManager(config.Default(), p, hm); rm.clock != clock {
+		t.Error("expected the reconnect manager to use the injected clock")
+	}
+
+	p = NewWithConfig("localhost:0", config.Default(), WithCircuitBreaker(nil))
+	if p.CircuitBreaker() != nil {
+		t.Error("expected WithCircuitBreaker(nil) to disable the breaker")
+	}
+	if New("localhost:0").CircuitBreaker() != nil {
+		t.Error("expected no circuit breaker without configuration")
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	p := New("localhost:0", WithTransport(stallTransport{}), WithDialTimeout(50*time.Millisecond))
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Connect("somewhere:1")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a deadline error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the dial to time out")
+	}
+}
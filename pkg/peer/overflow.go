@@ -0,0 +1,294 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"example.com/p2p/pkg/config"
+	"example.com/p2p/pkg/logger"
+	"example.com/p2p/pkg/message"
+)
+
+// SetOverflowPolicy chooses what happens to an incoming message when
+// Messages is full: config.OverflowBlock stalls the connection it arrived on
+// until there is room, config.OverflowDropOldest discards the oldest queued
+// message to make room, config.OverflowDropNewest discards the new message
+// and config.OverflowSpill queues it in spillFile, or in a temporary file if
+// spillFile is empty, until there is room. The default is to drop the
+// newest message.
+func (p *Peer) SetOverflowPolicy(policy, spillFile string) error {
+	switch policy {
+	case config.OverflowBlock, config.OverflowDropOldest, config.OverflowDropNewest, config.OverflowSpill:
+	default:
+		return fmt.Errorf("unknown overflow policy %q", policy)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.overflow = policy
+	if policy == config.OverflowSpill && p.spill == nil {
+		p.spill = &spillQueue{path: spillFile}
+	}
+	return nil
+}
+
+// SetLogger sets the logger used to report dropped messages.
+func (p *Peer) SetLogger(l *logger.Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.logger = l
+}
+
+// DroppedMessages returns the number of incoming messages dropped because
+// Messages was full.
+func (p *Peer) DroppedMessages() int64 {
+	return p.dropped.Load()
+}
+
+// deliver hands msg to Messages according to the overflow policy and
+// reports whether it was kept rather than dropped. Nothing is delivered once
+// the peer is closed.
+func (p *Peer) deliver(msg *message.Message) bool {
+	select {
+	case <-p.closed:
+		return false
+	default:
+	}
+	p.mu.Lock()
+	policy, spill := p.overflow, p.spill
+	p.mu.Unlock()
+
+	// Messages already spilled go first, so that order is kept.
+	if policy == config.OverflowSpill && spill.appendIfBacklogged(msg) {
+		return true
+	}
+	select {
+	case p.Messages <- msg:
+		return true
+	default:
+	}
+	switch policy {
+	case config.OverflowBlock:
+		select {
+		case p.Messages <- msg:
+		case <-p.closed:
+			return false
+		}
+	case config.OverflowDropOldest:
+		for {
+			select {
+			case old := <-p.Messages:
+				p.drop(old, policy)
+			default:
+			}
+			select {
+			case p.Messages <- msg:
+				return true
+			default:
+			}
+		}
+	case config.OverflowSpill:
+		started, err := spill.append(msg)
+		if err != nil {
+			p.drop(msg, policy)
+			return false
+		}
+		if started {
+			go p.drainSpill(spill)
+		}
+	default:
+		p.drop(msg, config.OverflowDropNewest)
+		return false
+	}
+	return true
+}
+
+// drop counts and logs a message lost to overflow.
+func (p *Peer) drop(msg *message.Message, policy string) {
+	p.dropped.Add(1)
+	if log := p.getLogger(); log != nil {
+		log.LogMessageDropped(string(msg.Type), msg.SenderID, msg.SequenceNo, policy)
+	}
+}
+
+func (p *Peer) getLogger() *logger.Logger {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.logger
+}
+
+// drainSpill moves spilled messages to Messages until the queue is empty or
+// the peer is closed.
+func (p *Peer) drainSpill(q *spillQueue) {
+	for {
+		msg, err := q.peek()
+		if errors.Is(err, errSpillClosed) {
+			return
+		}
+		if err != nil {
+			// The rest of the file cannot be read back.
+			n := q.reset()
+			p.dropped.Add(int64(n))
+			if log := p.getLogger(); log != nil {
+				log.Error("Spilled messages lost", "count", n, "error", err, "event", "message_dropped")
+			}
+			return
+		}
+		select {
+		case p.Messages <- msg:
+		case <-p.closed:
+			return
+		}
+		if !q.advance() {
+			return
+		}
+	}
+}
+
+// errSpillClosed is returned by a spill queue after the peer is closed.
+var errSpillClosed = errors.New("spill queue closed")
+
+// spillQueue is a first-in first-out queue of messages kept in a file. A
+// single drainer reads it back while readers append to it.
+type spillQueue struct {
+	path string
+
+	mu       sync.Mutex
+	closed   bool
+	file     *os.File
+	readOff  int64
+	writeOff int64
+	next     int64 // offset after the message returned by peek
+	pending  int   // messages appended and not yet delivered
+}
+
+// appendIfBacklogged appends msg if earlier messages are still queued.
+func (q *spillQueue) appendIfBacklogged(msg *message.Message) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending == 0 {
+		return false
+	}
+	return q.appendLocked(msg) == nil
+}
+
+// append adds msg to the queue. It reports whether the queue was empty, in
+// which case the caller must start draining it.
+func (q *spillQueue) append(msg *message.Message) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.appendLocked(msg); err != nil {
+		return false, err
+	}
+	return q.pending == 1, nil
+}
+
+func (q *spillQueue) appendLocked(msg *message.Message) error {
+	if q.closed {
+		return errSpillClosed
+	}
+	if q.file == nil {
+		if err := q.open(); err != nil {
+			return err
+		}
+	}
+	data, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+	w := io.NewOffsetWriter(q.file, q.writeOff)
+	if err := message.WriteFrame(w, data); err != nil {
+		return err
+	}
+	n, _ := w.Seek(0, io.SeekCurrent)
+	q.writeOff += n
+	q.pending++
+	return nil
+}
+
+// open creates the spill file. A temporary file is removed at once, so that
+// it disappears with the process.
+func (q *spillQueue) open() error {
+	var f *os.File
+	var err error
+	if q.path == "" {
+		f, err = os.CreateTemp("", "p2p-spill-*")
+		if err == nil {
+			os.Remove(f.Name())
+		}
+	} else {
+		f, err = os.OpenFile(q.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("open spill file: %w", err)
+	}
+	q.file = f
+	return nil
+}
+
+// peek reads the oldest queued message without removing it.
+func (q *spillQueue) peek() (*message.Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, errSpillClosed
+	}
+	r := io.NewSectionReader(q.file, q.readOff, q.writeOff-q.readOff)
+	data, err := message.ReadFrame(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := r.Seek(0, io.SeekCurrent)
+	q.next = q.readOff + n
+	return message.Unmarshal(data)
+}
+
+// advance removes the message returned by peek and reports whether more
+// are queued. The file is emptied once everything has been delivered.
+func (q *spillQueue) advance() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	q.readOff = q.next
+	q.pending--
+	if q.pending > 0 {
+		return true
+	}
+	q.truncateLocked()
+	return false
+}
+
+// reset empties the queue and returns the number of messages discarded.
+func (q *spillQueue) reset() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := q.pending
+	q.pending = 0
+	q.truncateLocked()
+	return n
+}
+
+// close empties the queue and closes its file. The queue cannot be used
+// afterwards.
+func (q *spillQueue) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.pending = 0
+	if q.file == nil {
+		return nil
+	}
+	return q.file.Close()
+}
+
+func (q *spillQueue) truncateLocked() {
+	q.readOff, q.writeOff, q.next = 0, 0, 0
+	q.file.Truncate(0)
+}
@@ -0,0 +1,160 @@
+package peer
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/config"
+	"example.com/p2p/pkg/message"
+)
+
+func overflowPeer(t *testing.T, policy string) *Peer {
+	t.Helper()
+	p := New("localhost:0")
+	p.Messages = make(chan *message.Message, 2)
+	if err := p.SetOverflowPolicy(policy, filepath.Join(t.TempDir(), "spill")); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func deliverN(p *Peer, n int) {
+	for i := 1; i <= n; i++ {
+		p.deliver(message.NewChatMessage("sender", i, "hi"))
+	}
+}
+
+func expectSeq(t *testing.T, p *Peer, want ...int) {
+	t.Helper()
+	for _, seq := range want {
+		select {
+		case msg := <-p.Messages:
+			if msg.SequenceNo != seq {
+				t.Fatalf("expected message %d, got %d", seq, msg.SequenceNo)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected message %d", seq)
+		}
+	}
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	p := overflowPeer(t, config.OverflowDropNewest)
+	deliverN(p, 4)
+	expectSeq(t, p, 1, 2)
+	if got := p.DroppedMessages(); got != 2 {
+		t.Errorf("expected 2 dropped messages, got %d", got)
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	p := overflowPeer(t, config.OverflowDropOldest)
+	deliverN(p, 4)
+	expectSeq(t, p, 3, 4)
+	if got := p.DroppedMessages(); got != 2 {
+		t.Errorf("expected 2 dropped messages, got %d", got)
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	p := overflowPeer(t, config.OverflowBlock)
+	done := make(chan struct{})
+	go func() {
+		deliverN(p, 3)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected delivery to block while Messages is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	expectSeq(t, p, 1, 2, 3)
+	<-done
+	if got := p.DroppedMessages(); got != 0 {
+		t.Errorf("expected no dropped messages, got %d", got)
+	}
+}
+
+func TestOverflowSpill(t *testing.T) {
+	p := overflowPeer(t, config.OverflowSpill)
+	deliverN(p, 10)
+	expectSeq(t, p, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	if got := p.DroppedMessages(); got != 0 {
+		t.Errorf("expected no dropped messages, got %d", got)
+	}
+
+	// The file is reused once drained.
+	waitFor(t, func() bool {
+		p.spill.mu.Lock()
+		defer p.spill.mu.Unlock()
+		return p.spill.pending == 0
+	})
+	p.deliver(message.NewChatMessage("sender", 11, "again"))
+	expectSeq(t, p, 11)
+}
+
+func TestUnknownOverflowPolicy(t *testing.T) {
+	if err := New("localhost:0").SetOverflowPolicy("drop-all", ""); err == nil {
+		t.Error("expected an unknown policy to be refused")
+	}
+}
+
+func TestUnknownOverflowPolicyOption(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected an unknown policy option to panic")
+		}
+	}()
+	New("localhost:0", WithOverflowPolicy("drop-all", ""))
+}
+
+func TestCloseUnblocksDelivery(t *testing.T) {
+	p := overflowPeer(t, config.OverflowBlock)
+	done := make(chan struct{})
+	go func() {
+		deliverN(p, 3)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	p.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Close to unblock delivery")
+	}
+}
+
+func TestCloseStopsSpill(t *testing.T) {
+	p := overflowPeer(t, config.OverflowSpill)
+	deliverN(p, 10)
+	if err := p.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	p.spill.mu.Lock()
+	closed, pending := p.spill.closed, p.spill.pending
+	p.spill.mu.Unlock()
+	if !closed || pending != 0 {
+		t.Fatalf("expected an empty, closed spill queue, got closed %v with %d pending", closed, pending)
+	}
+	if p.deliver(message.NewChatMessage("sender", 11, "late")) {
+		t.Error("expected no delivery after Close")
+	}
+	// The drainer gives up instead of refilling Messages.
+	for len(p.Messages) > 0 {
+		<-p.Messages
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := len(p.Messages); n > 1 {
+		t.Errorf("expected the drainer to stop, got %d more messages", n)
+	}
+}
+
+func TestMessageBufferSizeFromConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.MessageBufferSize = 64
+	p := NewWithConfig("localhost:0", cfg)
+	if got := cap(p.Messages); got != 64 {
+		t.Errorf("expected a 64-slot Messages channel, got %d", got)
+	}
+}
@@ -1,14 +1,25 @@
 package peer
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"example.com/p2p/pkg/config"
 	"example.com/p2p/pkg/dedup"
+	"example.com/p2p/pkg/dht"
+	"example.com/p2p/pkg/identity"
+	"example.com/p2p/pkg/logger"
 	"example.com/p2p/pkg/message"
+	"example.com/p2p/pkg/transport"
 	"sync"
 )
 
@@ -16,36 +27,211 @@ import (
 type Peer struct {
 	ID   string
 	Addr string
+	// NodeVersion is the software version advertised during the handshake.
+	NodeVersion string
 
-	mu    sync.Mutex
-	conns map[string]net.Conn
-	seen  *dedup.Deduper
+	identity  *identity.Identity
+	tlsCert   *tls.Certificate
+	transport transport.Transport
+	// breaker refuses dials to addresses that keep failing; nil allows
+	// every dial. New builds one with backoff and clock when
+	// breakerThreshold is positive and no breaker was given.
+	breaker          *CircuitBreaker
+	breakerThreshold int
+	backoff          BackoffPolicy
+	clock            Clock
+	// maxConns limits the connections held at once, of which at most
+	// maxOutbound are dialed by this peer and the rest accepted.
+	// dialTimeout and handshakeTimeout bound connection setup. Zero means
+	// no limit.
+	maxConns         int
+	maxOutbound      int
+	dialTimeout      time.Duration
+	handshakeTimeout time.Duration
+
+	mu       sync.Mutex
+	conns    map[string]net.Conn
+	sessions map[string]*Session
+	// pendingIn and pendingOut count slots reserved for connections
+	// still being set up.
+	pendingIn  int
+	pendingOut int
+	// routes maps a message origin to the neighbour its traffic last
+	// arrived from, which is the reverse path used to reach it.
+	routes       map[string]string
+	seen         *dedup.Deduper
+	maxFrameSize int
+	ttl          int
+	capabilities []string
+
+	// subs holds the peer's own topic subscriptions. interest and
+	// advertised hold, per neighbour, the topic distances it advertised to
+	// us and the ones we last advertised to it; interestSeq holds the
+	// sequence number of the advertisement interest came from.
+	subs        map[string]bool
+	interest    map[string]map[string]int
+	interestSeq map[string]int
+	advertised  map[string]map[string]int
+	advSeq      int
+
+	// table holds DHT contacts; finds holds find-node requests awaiting
+	// a reply, keyed by sequence number.
+	table   *dht.RoutingTable
+	finds   map[int]pendingFind
+	findSeq int
+
+	// trackers holds the delivery trackers of messages awaiting
+	// acknowledgement, keyed by sequence number; ackSeq numbers the
+	// acknowledgements this peer sends, starting from the clock so that a
+	// restarted peer's acknowledgements are not taken for duplicates.
+	trackers map[int]*DeliveryTracker
+	ackSeq   atomic.Int64
+
+	// handlers consume link-local message types; see HandleFunc.
+	handlers map[message.MessageType]func(from string, msg *message.Message)
+
+	// requireSignatures drops unsigned messages instead of accepting them.
+	requireSignatures bool
+	// requireEncryption refuses peers that cannot negotiate TLS.
+	requireEncryption bool
+	rejected          atomic.Int64
+	// overflow is the policy applied when Messages is full; see
+	// SetOverflowPolicy. spill queues messages under the spill policy.
+	overflow string
+	spill    *spillQueue
+	dropped  atomic.Int64
+	logger   *logger.Logger
+	// closed is closed by Close to stop blocked deliveries.
+	closed    chan struct{}
+	closeOnce sync.Once
 	// Messages delivers incoming messages from other peers.
 	Messages chan *message.Message
 }
 
-// New creates a new peer listening on the given address.
-func New(addr string) *Peer {
-	return &Peer{
-		ID:       randomID(),
-		Addr:     addr,
-		conns:    make(map[string]net.Conn),
-		seen:     dedup.New(100),
-		Messages: make(chan *message.Message, 16),
+// New creates a new peer listening on the given address, configured by
+// opts. The peer gets a fresh ephemeral identity; use SetIdentity to load a
+// persistent one.
+func New(addr string, opts ...Option) *Peer {
+	ident, err := identity.Generate()
+	if err != nil {
+		panic(fmt.Sprintf("peer: %v", err))
 	}
+	p := &Peer{
+		ID:           ident.ID(),
+		Addr:         addr,
+		identity:     ident,
+		transport:    transport.Default(),
+		clock:        SystemClock,
+		conns:        make(map[string]net.Conn),
+		sessions:     make(map[string]*Session),
+		routes:       make(map[string]string),
+		subs:         make(map[string]bool),
+		interest:     make(map[string]map[string]int),
+		interestSeq:  make(map[string]int),
+		advertised:   make(map[string]map[string]int),
+		seen:         dedup.New(100),
+		maxFrameSize: message.DefaultMaxFrameSize,
+		ttl:          message.DefaultTTL,
+		capabilities: DefaultCapabilities(),
+		Messages:     make(chan *message.Message, 16),
+		finds:        make(map[int]pendingFind),
+		trackers:     make(map[int]*DeliveryTracker),
+		closed:       make(chan struct{}),
+		handlers:     make(map[message.MessageType]func(string, *message.Message)),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.clock == nil {
+		p.clock = SystemClock
+	}
+	if p.breaker == nil && p.breakerThreshold > 0 {
+		p.breaker = NewCircuitBreaker(p.breakerThreshold, p.backoff, p.clock)
+	}
+	p.ackSeq.Store(p.clock.Now().UnixMilli())
+	p.table, _ = dht.NewRoutingTable(p.ID, dht.K)
+	p.HandleFunc(message.TypeSubscriptions, p.handleSubscriptions)
+	p.HandleFunc(message.TypeFindNode, p.handleFindNode)
+	p.HandleFunc(message.TypeNodes, p.handleNodes)
+	return p
+}
+
+// NewWithConfig creates a new peer with the settings of cfg, followed by
+// opts. It is shorthand for New(addr, WithConfig(cfg), opts...).
+func NewWithConfig(addr string, cfg *config.Config, opts ...Option) *Peer {
+	return New(addr, append([]Option{WithConfig(cfg)}, opts...)...)
 }
 
-// NewWithConfig creates a new peer with configuration-based settings.
-func NewWithConfig(addr string, cfg interface{}) *Peer {
-	// For now, use default settings. In a full implementation,
-	// we would extract buffer sizes and other settings from cfg.
-	return &Peer{
-		ID:       randomID(),
-		Addr:     addr,
-		conns:    make(map[string]net.Conn),
-		seen:     dedup.New(100),
-		Messages: make(chan *message.Message, 16),
+// SetIdentity replaces the peer's identity and derives its ID from the new
+// public key. It must be called before the peer connects or serves.
+func (p *Peer) SetIdentity(ident *identity.Identity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.identity = ident
+	p.ID = ident.ID()
+	p.tlsCert = nil
+	p.ackSeq.Store(p.clock.Now().UnixMilli())
+	p.table, _ = dht.NewRoutingTable(p.ID, dht.K)
+}
+
+// Identity returns the peer's keypair.
+func (p *Peer) Identity() *identity.Identity {
+	return p.identity
+}
+
+// HandleFunc registers h to consume link-local messages of type t. Such
+// messages are exchanged only between neighbours: they are passed to h along
+// with the ID of the neighbour that sent them, and are not verified,
+// deduplicated, delivered to Messages or forwarded.
+func (p *Peer) HandleFunc(t message.MessageType, h func(from string, msg *message.Message)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers[t] = h
+}
+
+// SetTransport replaces the transport used to dial and listen. Addresses
+// passed to Connect and Listen are interpreted by t, so a transport.Mux
+// accepts scheme-prefixed addresses. It must be called before the peer
+// connects or serves.
+func (p *Peer) SetTransport(t transport.Transport) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.transport = t
+}
+
+// SetCircuitBreaker makes outbound dials go through cb. A nil cb lets every
+// dial through.
+func (p *Peer) SetCircuitBreaker(cb *CircuitBreaker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.breaker = cb
+}
+
+// CircuitBreaker returns the circuit breaker outbound dials go through, or
+// nil if there is none.
+func (p *Peer) CircuitBreaker() *CircuitBreaker {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.breaker
+}
+
+// Listen opens a listener on addr using the peer's transport and sets Addr to
+// the address actually bound, so that an ephemeral port is advertised
+// correctly in the handshake. The scheme prefix of addr, if any, is kept.
+func (p *Peer) Listen(addr string) (net.Listener, error) {
+	p.mu.Lock()
+	t := p.transport
+	p.mu.Unlock()
+	l, err := t.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	p.Addr = l.Addr().String()
+	if strings.Contains(addr, "://") {
+		scheme, _ := transport.ParseAddr(addr)
+		p.Addr = transport.FormatAddr(scheme, p.Addr)
 	}
+	return l, nil
 }
 
 func randomID() string {
@@ -56,49 +242,78 @@ func randomID() string {
 	return hex.EncodeToString(b)
 }
 
-// Handshake exchanges peer IDs on the given connection. The caller's ID is
-// sent first, then the remote ID is read back. It returns the remote ID or an
-// error.
-func Handshake(conn net.Conn, id string) (string, error) {
-	if _, err := fmt.Fprintf(conn, "%s\n", id); err != nil {
-		return "", err
+// AddConn adds a connection to another peer. A different connection already
+// registered for id is closed.
+func (p *Peer) AddConn(id string, conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.conns[id]; ok && old != conn {
+		discard(old)
 	}
-	var buf []byte
-	tmp := make([]byte, 1)
-	for {
-		n, err := conn.Read(tmp)
-		if err != nil {
-			return "", err
-		}
-		if n == 0 {
-			continue
-		}
-		if tmp[0] == '\n' {
-			break
-		}
-		buf = append(buf, tmp[0])
-		if len(buf) > 64 {
-			return "", fmt.Errorf("id too long")
-		}
+	p.conns[id] = conn
+}
+
+// Close closes every connection, stops delivering spilled messages and
+// closes the spill file. Messages still queued in it are lost.
+func (p *Peer) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	p.mu.Lock()
+	for id := range p.conns {
+		p.removeConnLocked(id)
 	}
-	return strings.TrimSpace(string(buf)), nil
+	spill := p.spill
+	p.mu.Unlock()
+	if spill != nil {
+		return spill.close()
+	}
+	return nil
 }
 
-// AddConn adds a connection to another peer.
-func (p *Peer) AddConn(id string, conn net.Conn) {
+// RemoveConn removes the connection to the peer with the given ID.
+func (p *Peer) RemoveConn(id string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.conns[id] = conn
+	p.removeConnLocked(id)
 }
 
-// RemoveConn removes a connection.
-func (p *Peer) RemoveConn(id string) {
+// removeConn removes the connection to id only if it is still conn, so that
+// a connection that has been replaced cannot take its successor down.
+func (p *Peer) removeConn(id string, conn net.Conn) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if c, ok := p.conns[id]; ok {
+	if c, ok := p.conns[id]; ok && c != conn {
+		discard(conn)
+		return
+	}
+	p.removeConnLocked(id)
+}
+
+func (p *Peer) removeConnLocked(id string) {
+	c, ok := p.conns[id]
+	if ok {
 		c.Close()
 		delete(p.conns, id)
 	}
+	delete(p.sessions, id)
+	for origin, via := range p.routes {
+		if via == id {
+			delete(p.routes, origin)
+		}
+	}
+	p.forgetLinkLocked(id)
+	if ok {
+		// Interest reachable through this link is gone. Advertise from a
+		// new goroutine since RemoveConn runs with p.mu held.
+		go p.advertise()
+	}
+}
+
+// Session returns the negotiated session for a connected peer.
+func (p *Peer) Session(id string) (*Session, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.sessions[id]
+	return s, ok
 }
 
 // Connections returns the number of active connections.
@@ -108,20 +323,82 @@ func (p *Peer) Connections() int {
 	return len(p.conns)
 }
 
+// ErrConnectionLimit is returned when a connection is refused because all
+// slots for its direction are taken.
+var ErrConnectionLimit = errors.New("connection limit reached")
+
 // Connect dials the given address, performs a handshake, and registers the
-// connection. It returns the remote peer ID.
+// connection. It returns the remote peer ID. addr may also be a peer ID, in
+// which case the peer's address is looked up in the DHT first.
 func (p *Peer) Connect(addr string) (string, error) {
-	conn, err := net.Dial("tcp", addr)
+	if dht.IsID(addr) {
+		return p.connectID(addr)
+	}
+	return p.dial(addr)
+}
+
+// ErrUnexpectedPeer is returned when the peer at a dialed address
+// authenticates with another ID than the one expected there.
+var ErrUnexpectedPeer = errors.New("unexpected peer")
+
+// ConnectTo dials addr like Connect, expecting the peer with the given ID
+// there. If another peer answers, its connection is closed again and
+// ErrUnexpectedPeer is returned.
+func (p *Peer) ConnectTo(id, addr string) error {
+	got, conn, err := p.dialConn(addr)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if got != id {
+		p.removeConn(got, conn)
+		return fmt.Errorf("%w: peer at %s has ID %s, not %s", ErrUnexpectedPeer, addr, got, id)
+	}
+	return nil
+}
+
+// dial connects to the peer at addr, unless all outbound slots are taken or
+// the circuit breaker holds it back. Failed handshakes count as failed
+// dials.
+func (p *Peer) dial(addr string) (string, error) {
+	id, _, err := p.dialConn(addr)
+	return id, err
+}
+
+// dialConn is dial, also returning the new connection so that the caller
+// can later remove it without touching one that replaced it.
+func (p *Peer) dialConn(addr string) (string, net.Conn, error) {
+	p.mu.Lock()
+	t := p.transport
+	cb := p.breaker
+	p.mu.Unlock()
+	if !p.reserveSlot(true) {
+		return "", nil, fmt.Errorf("%w: no outbound slot for %s", ErrConnectionLimit, addr)
+	}
+	defer p.releaseSlot(true)
+	if !cb.Allow(addr) {
+		return "", nil, fmt.Errorf("%w: %s", ErrCircuitOpen, addr)
+	}
+	ctx := context.Background()
+	if p.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.dialTimeout)
+		defer cancel()
+	}
+	conn, err := t.Dial(ctx, addr)
+	if err != nil {
+		cb.Failure(addr)
+		return "", nil, err
 	}
-	remoteID, err := Handshake(conn, p.ID)
+	secured, sess, err := p.Handshake(conn)
 	if err != nil {
 		conn.Close()
-		return "", err
+		cb.Failure(addr)
+		return "", nil, err
 	}
-	p.HandleConn(remoteID, conn)
-	return remoteID, nil
+	cb.Success(addr)
+	sess.Outbound = true
+	p.HandleSession(sess, secured)
+	return sess.Remote.ID, secured, nil
 }
 
 // Serve accepts incoming connections from the listener and handles them. It
@@ -132,49 +409,310 @@ func (p *Peer) Serve(l net.Listener) error {
 		if err != nil {
 			return err
 		}
-		remoteID, err := Handshake(conn, p.ID)
-		if err != nil {
-			conn.Close()
-			continue
+		_, _, _ = p.Accept(conn)
+	}
+}
+
+// ErrDuplicateConnection is returned by Accept when the remote peer is
+// already connected and the existing link is kept instead of the new one.
+var ErrDuplicateConnection = errors.New("duplicate connection")
+
+// Accept performs the handshake on an incoming connection and registers it,
+// returning the connection to use and the negotiated session. If all
+// inbound slots are taken, the remote side is told so and the connection is
+// closed with ErrConnectionLimit. If the connection loses to an existing
+// link to the same peer, it is closed with ErrDuplicateConnection. conn is
+// closed on any error.
+func (p *Peer) Accept(conn net.Conn) (net.Conn, *Session, error) {
+	if !p.reserveSlot(false) {
+		p.reject(conn, "connection limit reached")
+		return nil, nil, fmt.Errorf("%w: no inbound slot for %s", ErrConnectionLimit, conn.RemoteAddr())
+	}
+	defer p.releaseSlot(false)
+	secured, sess, err := p.Handshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if !p.handleSession(sess, secured) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrDuplicateConnection, sess.Remote.ID)
+	}
+	return secured, sess, nil
+}
+
+// reserveSlot claims a slot for a connection being set up, reporting false
+// if the limit for its direction has been reached. Release it with
+// releaseSlot once the connection is registered or has failed.
+func (p *Peer) reserveSlot(outbound bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.maxConns > 0 {
+		total := len(p.conns) + p.pendingIn + p.pendingOut
+		if total >= p.maxConns {
+			return false
 		}
-		p.HandleConn(remoteID, conn)
+		if p.maxOutbound > 0 {
+			out := p.pendingOut
+			for _, sess := range p.sessions {
+				if sess.Outbound {
+					out++
+				}
+			}
+			if outbound && out >= p.maxOutbound {
+				return false
+			}
+			if !outbound && total-out >= p.maxConns-p.maxOutbound {
+				return false
+			}
+		}
+	}
+	if outbound {
+		p.pendingOut++
+	} else {
+		p.pendingIn++
 	}
+	return true
 }
 
-// Broadcast sends the given message to all connected peers.
+func (p *Peer) releaseSlot(outbound bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if outbound {
+		p.pendingOut--
+	} else {
+		p.pendingIn--
+	}
+}
+
+// Broadcast sends the given message to all connected peers. Each message is
+// written as a single length-prefixed frame. Unsigned messages originating
+// from this peer are signed with its identity before sending, and messages
+// without a TTL get the peer's default.
 func (p *Peer) Broadcast(msg *message.Message) error {
+	msg = p.outgoing(msg)
+	if msg.SenderID == p.ID && !msg.IsSigned() {
+		msg.Sign(p.identity)
+	}
+
+	// mark our own message as seen to prevent rebroadcast loops
+	p.Seen(msg)
+	return p.relay(msg, "")
+}
+
+// SendTo sends msg to the peer with the given ID only. The message is
+// written straight to the recipient if it is a neighbour, otherwise along
+// the learned route towards it, and as a last resort flooded through the
+// mesh, where only the recipient delivers it to Messages.
+func (p *Peer) SendTo(id string, msg *message.Message) error {
+	addressed := p.outgoing(msg)
+	addressed.Recipient = id
+	if addressed.SenderID == p.ID && !addressed.IsSigned() {
+		addressed.Sign(p.identity)
+	}
+	p.Seen(addressed)
+	return p.forward(addressed, "")
+}
+
+// Route returns the neighbour that traffic for the given peer is sent
+// through, if one is known. A direct neighbour routes to itself.
+func (p *Peer) Route(id string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.conns[id]; ok {
+		return id, true
+	}
+	via, ok := p.routes[id]
+	return via, ok
+}
+
+// KnownPeers returns the IDs of all neighbours and of every peer a route
+// has been learned to.
+func (p *Peer) KnownPeers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ids := make([]string, 0, len(p.conns)+len(p.routes))
+	for id := range p.conns {
+		ids = append(ids, id)
+	}
+	for id := range p.routes {
+		if _, ok := p.conns[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// forward sends a directed message one hop closer to its recipient. When no
+// route is known it falls back to relaying to every neighbour except from;
+// deduplication bounds the flood to one copy per peer.
+func (p *Peer) forward(msg *message.Message, from string) error {
+	next, ok := p.Route(msg.Recipient)
+	if !ok || next == from {
+		return p.relay(msg, from)
+	}
+
 	data, err := msg.Marshal()
 	if err != nil {
 		return err
 	}
+	if len(data) > p.maxFrameSize {
+		return fmt.Errorf("%w: %d bytes (max %d)", message.ErrFrameTooLarge, len(data), p.maxFrameSize)
+	}
+	p.mu.Lock()
+	c, ok := p.conns[next]
+	p.mu.Unlock()
+	if !ok {
+		return p.relay(msg, from)
+	}
+	if err := message.WriteFrame(c, data); err != nil {
+		p.removeConn(next, c)
+		return fmt.Errorf("write to %s: %w", next, err)
+	}
+	return nil
+}
 
-	// mark our own message as seen to prevent rebroadcast loops
-	p.seen.Seen(fmt.Sprintf("%s/%d", msg.SenderID, msg.SequenceNo))
+// learnRoute records that traffic from origin arrived via the given
+// neighbour.
+func (p *Peer) learnRoute(origin, via string) {
+	if origin == p.ID || origin == via {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.conns[via]; ok {
+		p.routes[origin] = via
+	}
+}
+
+// relay writes msg to every connection except the one identified by from.
+// Unlike Broadcast it never signs, so forwarded messages reach other peers
+// exactly as they were received.
+func (p *Peer) relay(msg *message.Message, from string) error {
+	return p.sendWhere(msg, func(id string) bool { return id != from })
+}
+
+// sendWhere writes msg to every connection for which include returns true.
+// include is called with p.mu held. Connections that fail to write are
+// removed.
+func (p *Peer) sendWhere(msg *message.Message, include func(id string) bool) error {
+	data, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+	if len(data) > p.maxFrameSize {
+		return fmt.Errorf("%w: %d bytes (max %d)", message.ErrFrameTooLarge, len(data), p.maxFrameSize)
+	}
 
 	p.mu.Lock()
 	conns := make(map[string]net.Conn, len(p.conns))
 	for id, c := range p.conns {
-		conns[id] = c
+		if include(id) {
+			conns[id] = c
+		}
 	}
 	p.mu.Unlock()
 
 	var firstErr error
 	for id, c := range conns {
-		if _, err := c.Write(data); err != nil {
+		if err := message.WriteFrame(c, data); err != nil {
 			if firstErr == nil {
 				firstErr = fmt.Errorf("write to %s: %w", id, err)
 			}
-			p.RemoveConn(id)
+			p.removeConn(id, c)
 			continue
 		}
 	}
 	return firstErr
 }
 
+// outgoing returns a copy of msg with the default TTL applied if it has
+// none, leaving the caller's message untouched.
+func (p *Peer) outgoing(msg *message.Message) *message.Message {
+	out := *msg
+	if out.TTL <= 0 {
+		out.TTL = p.ttl
+	}
+	return &out
+}
+
+// hop returns the copy of an incoming message to pass on to the next hop,
+// with its TTL decremented, or nil if the message has run out of hops. A
+// missing TTL, or one above the local limit, is treated as the local limit.
+func (p *Peer) hop(msg *message.Message) *message.Message {
+	ttl := msg.TTL
+	if ttl <= 0 || ttl > p.ttl {
+		ttl = p.ttl
+	}
+	if ttl <= 1 {
+		return nil
+	}
+	next := *msg
+	next.TTL = ttl - 1
+	return &next
+}
+
 // Seen reports whether the message has been encountered before and records it
-// if it has not.
+// if it has not. Messages are identified by sender, type and sequence number,
+// so that acknowledgements, which a peer numbers on its own, cannot be
+// mistaken for its other messages.
 func (p *Peer) Seen(msg *message.Message) bool {
-	return p.seen.Seen(fmt.Sprintf("%s/%d", msg.SenderID, msg.SequenceNo))
+	return p.seen.Seen(fmt.Sprintf("%s/%s/%d", msg.SenderID, msg.Type, msg.SequenceNo))
+}
+
+// HandleSession records the negotiated session and starts processing incoming
+// messages on conn. If the remote peer is already connected, one of the two
+// connections is closed; see register.
+func (p *Peer) HandleSession(sess *Session, conn net.Conn) {
+	p.handleSession(sess, conn)
+}
+
+// handleSession is HandleSession, reporting whether conn was kept.
+func (p *Peer) handleSession(sess *Session, conn net.Conn) bool {
+	if !p.register(sess, conn) {
+		discard(conn)
+		return false
+	}
+	go p.readLoop(sess.Remote.ID, conn)
+	p.addContact(sess, conn)
+	p.advertise()
+	return true
+}
+
+// register records sess and conn as the link to the remote peer and reports
+// whether they were kept. When two peers dial each other at the same time,
+// each ends up with two connections to the other. Both ends then keep the
+// connection dialed by the peer with the lower ID, so exactly one link
+// survives. Of two connections dialed in the same direction, the newer one
+// is kept, since the older one is most likely dead.
+func (p *Peer) register(sess *Session, conn net.Conn) bool {
+	id := sess.Remote.ID
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.conns[id]; ok {
+		if cur, ok := p.sessions[id]; ok && cur.Outbound != sess.Outbound {
+			lowerDialed := (p.ID < id) == sess.Outbound
+			if !lowerDialed {
+				return false
+			}
+		}
+		discard(old)
+	}
+	p.conns[id] = conn
+	p.sessions[id] = sess
+	return true
+}
+
+// discard closes a duplicate connection at once. Closing a TLS connection
+// normally waits to send a close alert, which the remote side may not read
+// while it is busy with the connection that was kept, so the connection
+// underneath is closed instead.
+func discard(conn net.Conn) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		tc.NetConn().Close()
+		return
+	}
+	conn.Close()
 }
 
 // HandleConn registers the connection and starts processing incoming messages.
@@ -184,24 +722,77 @@ func (p *Peer) HandleConn(id string, conn net.Conn) {
 }
 
 func (p *Peer) readLoop(id string, conn net.Conn) {
-	defer p.RemoveConn(id)
-	buf := make([]byte, 4096)
+	defer p.removeConn(id, conn)
+	dec := message.NewDecoder(conn)
+	dec.SetMaxFrameSize(p.maxFrameSize)
 	for {
-		n, err := conn.Read(buf)
+		msg, err := dec.Decode()
+		if errors.Is(err, message.ErrInvalidMessage) {
+			continue
+		}
 		if err != nil {
 			return
 		}
-		msg, err := message.Unmarshal(buf[:n])
-		if err != nil {
+		// Link-local messages come from the authenticated neighbour
+		// itself and go straight to their handler.
+		p.mu.Lock()
+		h, ok := p.handlers[msg.Type]
+		p.mu.Unlock()
+		if ok {
+			h(id, msg)
+			continue
+		}
+		// Verify before dedup so that a forged copy cannot mark the
+		// genuine message as seen.
+		if !p.accept(msg) {
+			p.rejected.Add(1)
 			continue
 		}
 		if p.Seen(msg) {
 			continue
 		}
-		select {
-		case p.Messages <- msg:
+		p.learnRoute(msg.SenderID, id)
+		next := p.hop(msg)
+		if msg.IsDirect() && msg.Recipient != p.ID {
+			if next != nil {
+				_ = p.forward(next, id)
+			}
+			continue
+		}
+		if msg.Type == message.TypeAck {
+			p.handleAck(msg)
+			continue
+		}
+		if msg.Topic == "" || p.Subscribed(msg.Topic) {
+			if p.deliver(msg) && msg.AckRequested {
+				go p.Acknowledge(msg, message.AckDelivered)
+			}
+		}
+		// Messages that have used up their hops are delivered locally
+		// but not passed on.
+		switch {
+		case next == nil || msg.IsDirect():
+		case msg.Topic != "":
+			_ = p.publish(next, id)
 		default:
+			_ = p.relay(next, id)
 		}
-		_ = p.Broadcast(msg)
 	}
 }
+
+// accept reports whether an incoming message passes signature checks.
+// Messages with an invalid signature are always refused; unsigned messages
+// are refused only when signatures are required.
+func (p *Peer) accept(msg *message.Message) bool {
+	err := msg.Verify()
+	if errors.Is(err, message.ErrUnsigned) {
+		return !p.requireSignatures
+	}
+	return err == nil
+}
+
+// RejectedMessages returns the number of incoming messages dropped because
+// they failed signature verification.
+func (p *Peer) RejectedMessages() int64 {
+	return p.rejected.Load()
+}
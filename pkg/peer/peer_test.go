@@ -1,11 +1,14 @@
 package peer
 
 import (
+	"errors"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
 	"example.com/p2p/pkg/message"
+	"example.com/p2p/pkg/transport"
 )
 
 func TestNewPeer(t *testing.T) {
@@ -47,15 +50,11 @@ func TestBroadcast(t *testing.T) {
 
 	done := make(chan *message.Message, 2)
 	go func() {
-		buf := make([]byte, 512)
-		n, _ := c1b.Read(buf)
-		m, _ := message.Unmarshal(buf[:n])
+		m, _ := message.NewDecoder(c1b).Decode()
 		done <- m
 	}()
 	go func() {
-		buf := make([]byte, 512)
-		n, _ := c2b.Read(buf)
-		m, _ := message.Unmarshal(buf[:n])
+		m, _ := message.NewDecoder(c2b).Decode()
 		done <- m
 	}()
 
@@ -173,21 +172,15 @@ func TestHandleConn(t *testing.T) {
 	p.HandleConn("peer2", inB)
 
 	msg := &message.Message{SenderID: "peer2", SequenceNo: 1, Payload: "hello"}
-	data, _ := msg.Marshal()
-	if _, err := inA.Write(data); err != nil {
+	if err := message.NewEncoder(inA).Encode(msg); err != nil {
 		t.Fatalf("write: %v", err)
 	}
 
 	// verify broadcast to existing conn
-	buf := make([]byte, 512)
-	n, err := b1b.Read(buf)
+	got, err := message.NewDecoder(b1b).Decode()
 	if err != nil {
 		t.Fatalf("read broadcast: %v", err)
 	}
-	got, err := message.Unmarshal(buf[:n])
-	if err != nil {
-		t.Fatalf("unmarshal: %v", err)
-	}
 	if got.Payload != msg.Payload {
 		t.Fatalf("expected %s, got %s", msg.Payload, got.Payload)
 	}
@@ -202,3 +195,62 @@ func TestHandleConn(t *testing.T) {
 		t.Fatal("expected message on channel")
 	}
 }
+
+func TestLargeAndBurstMessages(t *testing.T) {
+	p1 := New("localhost:0")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go p1.Serve(ln)
+
+	p2 := New("localhost:0")
+	if _, err := p2.Connect(ln.Addr().String()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	large := strings.Repeat("x", 32*1024)
+	if err := p2.Broadcast(&message.Message{SenderID: p2.ID, SequenceNo: 1, Payload: large}); err != nil {
+		t.Fatalf("broadcast large: %v", err)
+	}
+	for i := 2; i <= 6; i++ {
+		if err := p2.Broadcast(&message.Message{SenderID: p2.ID, SequenceNo: i, Payload: "burst"}); err != nil {
+			t.Fatalf("broadcast burst %d: %v", i, err)
+		}
+	}
+
+	for i := 1; i <= 6; i++ {
+		select {
+		case m := <-p1.Messages:
+			if m.SequenceNo != i {
+				t.Fatalf("expected sequence %d, got %d", i, m.SequenceNo)
+			}
+			if i == 1 && m.Payload != large {
+				t.Fatalf("expected %d byte payload, got %d", len(large), len(m.Payload))
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for message %d", i)
+		}
+	}
+}
+
+func TestConnectToChecksID(t *testing.T) {
+	mem := transport.NewMemory()
+	p := limitedPeer(t, mem)
+	a := limitedPeer(t, mem)
+
+	err := p.ConnectTo(New("").ID, a.Addr)
+	if !errors.Is(err, ErrUnexpectedPeer) {
+		t.Fatalf("expected ErrUnexpectedPeer, got %v", err)
+	}
+	waitFor(t, func() bool { return p.Connections() == 0 })
+
+	if err := p.ConnectTo(a.ID, a.Addr); err != nil {
+		t.Fatalf("ConnectTo failed: %v", err)
+	}
+	if _, ok := p.Session(a.ID); !ok {
+		t.Fatal("expected a session with the expected peer")
+	}
+}
@@ -0,0 +1,96 @@
+package peer
+
+import (
+	"math"
+	"time"
+)
+
+// phiDetector is a phi-accrual failure detector for one peer (Hayashibara et
+// al., "The φ Accrual Failure Detector"). It keeps a sliding window of
+// heartbeat inter-arrival times and, rather than a yes/no answer, reports how
+// unlikely the current silence is given the link's own history: phi = 1 means
+// a 10% chance that the peer is still alive and merely late, phi = 2 a 1%
+// chance, and so on. A peer is suspected once phi exceeds a threshold, so
+// links with more jitter are given more slack.
+type phiDetector struct {
+	intervals []time.Duration // ring buffer of inter-arrival times
+	next      int
+	sum       float64 // of intervals, in milliseconds
+	sumSq     float64
+	last      time.Time
+
+	// pause is added to the mean interval to tolerate occasional longer
+	// gaps such as GC pauses. minStdDev keeps a very regular link from
+	// being suspected after a slight delay.
+	pause     time.Duration
+	minStdDev time.Duration
+}
+
+// newPhiDetector creates a detector for a peer first seen at now. The window
+// is seeded with samples around the expected interval, so that a peer that
+// never sends a heartbeat is still suspected eventually.
+func newPhiDetector(now time.Time, expected, pause time.Duration, window int) *phiDetector {
+	if window < 2 {
+		window = 2
+	}
+	d := &phiDetector{
+		intervals: make([]time.Duration, 0, window),
+		last:      now,
+		pause:     pause,
+		minStdDev: expected / 10,
+	}
+	d.add(expected - expected/4)
+	d.add(expected + expected/4)
+	return d
+}
+
+// heartbeat records a heartbeat arriving at now.
+func (d *phiDetector) heartbeat(now time.Time) {
+	if interval := now.Sub(d.last); interval > 0 {
+		d.add(interval)
+	}
+	d.last = now
+}
+
+func (d *phiDetector) add(interval time.Duration) {
+	ms := float64(interval) / float64(time.Millisecond)
+	if len(d.intervals) < cap(d.intervals) {
+		d.intervals = append(d.intervals, interval)
+	} else {
+		old := float64(d.intervals[d.next]) / float64(time.Millisecond)
+		d.sum -= old
+		d.sumSq -= old * old
+		d.intervals[d.next] = interval
+		d.next = (d.next + 1) % len(d.intervals)
+	}
+	d.sum += ms
+	d.sumSq += ms * ms
+}
+
+// phi returns the suspicion level at now.
+func (d *phiDetector) phi(now time.Time) float64 {
+	n := float64(len(d.intervals))
+	mean := d.sum / n
+	variance := d.sumSq/n - mean*mean
+	stdDev := math.Sqrt(math.Max(variance, 0))
+	minStdDev := float64(d.minStdDev) / float64(time.Millisecond)
+	if stdDev < minStdDev {
+		stdDev = minStdDev
+	}
+	mean += float64(d.pause) / float64(time.Millisecond)
+	elapsed := float64(now.Sub(d.last)) / float64(time.Millisecond)
+	return phi(elapsed, mean, stdDev)
+}
+
+// phi returns -log10 of the probability that a normally distributed interval
+// with the given mean and standard deviation is longer than elapsed. It uses
+// a logistic approximation of the normal CDF that stays accurate far into the
+// tail.
+func phi(elapsed, mean, stdDev float64) float64 {
+	y := (elapsed - mean) / stdDev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1 + e))
+	}
+	return -math.Log10(1 - 1/(1+e))
+}
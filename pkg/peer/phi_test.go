@@ -0,0 +1,110 @@
+package peer
+
+import (
+	"testing"
+	"time"
+)
+
+// feed sends heartbeats to d at the given intervals, starting at start, and
+// returns the time of the last one.
+func feed(d *phiDetector, start time.Time, intervals ...time.Duration) time.Time {
+	now := start
+	for _, iv := range intervals {
+		now = now.Add(iv)
+		d.heartbeat(now)
+	}
+	return now
+}
+
+func repeat(iv time.Duration, n int) []time.Duration {
+	out := make([]time.Duration, n)
+	for i := range out {
+		out[i] = iv
+	}
+	return out
+}
+
+func TestPhiGrowsWithSilence(t *testing.T) {
+	start := time.Now()
+	d := newPhiDetector(start, time.Second, 0, 100)
+	last := feed(d, start, repeat(time.Second, 50)...)
+
+	prev := d.phi(last)
+	if prev > 0.1 {
+		t.Fatalf("expected phi near 0 right after a heartbeat, got %.2f", prev)
+	}
+	for _, gap := range []time.Duration{time.Second, 1200 * time.Millisecond, 1500 * time.Millisecond, 2 * time.Second} {
+		got := d.phi(last.Add(gap))
+		if got <= prev {
+			t.Fatalf("expected phi to grow with silence, got %.2f after %v (was %.2f)", got, gap, prev)
+		}
+		prev = got
+	}
+	if prev < 8 {
+		t.Errorf("expected a double-length gap on a regular link to exceed phi 8, got %.2f", prev)
+	}
+}
+
+func TestPhiToleratesJitter(t *testing.T) {
+	start := time.Now()
+	regular := newPhiDetector(start, time.Second, 0, 100)
+	jittery := newPhiDetector(start, time.Second, 0, 100)
+
+	steady := feed(regular, start, repeat(time.Second, 60)...)
+	var intervals []time.Duration
+	for i := 0; i < 30; i++ {
+		intervals = append(intervals, 500*time.Millisecond, 1500*time.Millisecond)
+	}
+	bumpy := feed(jittery, start, intervals...)
+
+	gap := 1800 * time.Millisecond
+	r, j := regular.phi(steady.Add(gap)), jittery.phi(bumpy.Add(gap))
+	if r <= 8 {
+		t.Errorf("expected a regular link to be suspected after %v, got phi %.2f", gap, r)
+	}
+	if j >= 8 {
+		t.Errorf("expected a jittery link to tolerate %v, got phi %.2f", gap, j)
+	}
+}
+
+func TestPhiPause(t *testing.T) {
+	start := time.Now()
+	d := newPhiDetector(start, time.Second, 3*time.Second, 100)
+	last := feed(d, start, repeat(time.Second, 50)...)
+	if got := d.phi(last.Add(3 * time.Second)); got >= 1 {
+		t.Errorf("expected a pause within the tolerance to keep phi low, got %.2f", got)
+	}
+	if got := d.phi(last.Add(6 * time.Second)); got <= 8 {
+		t.Errorf("expected a pause well past the tolerance to exceed phi 8, got %.2f", got)
+	}
+}
+
+func TestPhiWindowSlides(t *testing.T) {
+	start := time.Now()
+	d := newPhiDetector(start, time.Second, 0, 10)
+	last := feed(d, start, repeat(100*time.Millisecond, 10)...)
+	if len(d.intervals) != 10 {
+		t.Fatalf("expected the window to hold 10 intervals, got %d", len(d.intervals))
+	}
+	for _, iv := range d.intervals {
+		if iv != 100*time.Millisecond {
+			t.Fatalf("expected the seed intervals to be pushed out, found %v", iv)
+		}
+	}
+	// The link now heartbeats every 100ms, so a one second gap is
+	// suspicious even though that was the configured interval.
+	if got := d.phi(last.Add(time.Second)); got <= 8 {
+		t.Errorf("expected phi to follow the recent intervals, got %.2f", got)
+	}
+}
+
+func TestSilentPeerSuspected(t *testing.T) {
+	start := time.Now()
+	d := newPhiDetector(start, time.Second, time.Second, 100)
+	if got := d.phi(start.Add(time.Second)); got >= 1 {
+		t.Errorf("expected a new peer to be given time, got phi %.2f", got)
+	}
+	if got := d.phi(start.Add(5 * time.Second)); got <= 8 {
+		t.Errorf("expected a peer that never sends a heartbeat to be suspected, got phi %.2f", got)
+	}
+}
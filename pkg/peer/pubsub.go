@@ -0,0 +1,206 @@
+package peer
+
+import (
+	"maps"
+	"sort"
+
+	"example.com/p2p/pkg/message"
+)
+
+// Topic routing works like a distance-vector protocol. Each peer tells every
+// neighbour how far away the nearest subscriber of each topic is when reached
+// through it, leaving out what it learned from that neighbour. Topic messages
+// are then forwarded only along links that advertised the topic. Distances
+// are capped at the TTL so that interest echoed around a cycle after the last
+// subscriber leaves dies out instead of circulating forever. Advertisements
+// carry increasing sequence numbers so that a receiver can ignore one that
+// was overtaken by a newer one.
+
+// Subscribe adds topic to the peer's subscriptions and advertises the change
+// to its neighbours.
+func (p *Peer) Subscribe(topic string) {
+	p.mu.Lock()
+	p.subs[topic] = true
+	p.mu.Unlock()
+	p.advertise()
+}
+
+// Unsubscribe removes topic from the peer's subscriptions and advertises the
+// change to its neighbours.
+func (p *Peer) Unsubscribe(topic string) {
+	p.mu.Lock()
+	delete(p.subs, topic)
+	p.mu.Unlock()
+	p.advertise()
+}
+
+// Subscriptions returns the topics the peer is subscribed to.
+func (p *Peer) Subscriptions() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	topics := make([]string, 0, len(p.subs))
+	for t := range p.subs {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Subscribed reports whether the peer is subscribed to topic.
+func (p *Peer) Subscribed(topic string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.subs[topic]
+}
+
+// Publish sends msg to every peer subscribed to topic. The message is
+// written only to neighbours that lead to a subscriber.
+func (p *Peer) Publish(topic string, msg *message.Message) error {
+	out := p.outgoing(msg)
+	out.Topic = topic
+	if out.SenderID == p.ID && !out.IsSigned() {
+		out.Sign(p.identity)
+	}
+	p.Seen(out)
+	return p.publish(out, "")
+}
+
+// publish writes a topic message to every interested neighbour except from.
+func (p *Peer) publish(msg *message.Message, from string) error {
+	return p.sendWhere(msg, func(id string) bool {
+		return id != from && p.interestedLocked(id, msg.Topic)
+	})
+}
+
+// interestedLocked reports whether the neighbour leads to a subscriber of
+// topic. Neighbours that cannot advertise subscriptions receive every topic.
+// p.mu must be held.
+func (p *Peer) interestedLocked(id, topic string) bool {
+	if !p.speaksTopicsLocked(id) {
+		return true
+	}
+	_, ok := p.interest[id][topic]
+	return ok
+}
+
+func (p *Peer) speaksTopicsLocked(id string) bool {
+	sess, ok := p.sessions[id]
+	return ok && sess.Has(CapMsgTopics)
+}
+
+// Limits on the subscriptions accepted from a neighbour, so that one cannot
+// make this peer hold, and pass on, an unbounded set of topics.
+const (
+	maxTopics      = 1024
+	maxTopicLength = 256
+)
+
+// handleSubscriptions records the topic distances a neighbour advertised and
+// propagates any resulting change to the other neighbours.
+func (p *Peer) handleSubscriptions(from string, msg *message.Message) {
+	topics, err := msg.GetSubscriptions()
+	if err != nil || msg.SenderID != from {
+		return
+	}
+	topics = boundTopics(topics)
+	p.mu.Lock()
+	if _, ok := p.conns[from]; !ok || msg.SequenceNo <= p.interestSeq[from] {
+		p.mu.Unlock()
+		return
+	}
+	p.interest[from] = topics
+	p.interestSeq[from] = msg.SequenceNo
+	p.mu.Unlock()
+	// Advertise from a new goroutine so that the read loop never blocks
+	// writing to other neighbours.
+	go p.advertise()
+}
+
+// boundTopics drops advertised topics with an empty or overlong name or a
+// negative distance, and keeps at most maxTopics of the rest, nearest first.
+func boundTopics(topics map[string]int) map[string]int {
+	for topic, dist := range topics {
+		if topic == "" || len(topic) > maxTopicLength || dist < 0 {
+			delete(topics, topic)
+		}
+	}
+	if len(topics) <= maxTopics {
+		return topics
+	}
+	names := make([]string, 0, len(topics))
+	for topic := range topics {
+		names = append(names, topic)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if topics[names[i]] != topics[names[j]] {
+			return topics[names[i]] < topics[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	kept := make(map[string]int, maxTopics)
+	for _, topic := range names[:maxTopics] {
+		kept[topic] = topics[topic]
+	}
+	return kept
+}
+
+// advertise sends each neighbour that supports topics the subscriptions it
+// can reach through this peer, if they changed since the last advertisement.
+func (p *Peer) advertise() {
+	p.mu.Lock()
+	pending := make(map[string]*message.Message)
+	for id := range p.conns {
+		if !p.speaksTopicsLocked(id) {
+			continue
+		}
+		adv := p.advertisementLocked(id)
+		prev, sent := p.advertised[id]
+		if sent && maps.Equal(prev, adv) {
+			continue
+		}
+		if !sent && len(adv) == 0 {
+			continue
+		}
+		p.advertised[id] = adv
+		p.advSeq++
+		pending[id] = message.NewSubscriptionsMessage(p.ID, p.advSeq, adv)
+	}
+	p.mu.Unlock()
+
+	for id, msg := range pending {
+		_ = p.sendWhere(msg, func(c string) bool { return c == id })
+	}
+}
+
+// advertisementLocked computes the topic distances to advertise to the given
+// neighbour: the peer's own subscriptions at distance 0 and everything
+// learned from other neighbours one hop further away. p.mu must be held.
+func (p *Peer) advertisementLocked(to string) map[string]int {
+	adv := make(map[string]int, len(p.subs))
+	for t := range p.subs {
+		adv[t] = 0
+	}
+	for id, topics := range p.interest {
+		if id == to {
+			continue
+		}
+		for t, d := range topics {
+			d++
+			if d >= p.ttl {
+				continue
+			}
+			if cur, ok := adv[t]; !ok || d < cur {
+				adv[t] = d
+			}
+		}
+	}
+	return adv
+}
+
+// forgetLinkLocked drops topic state for a closed connection. p.mu must be
+// held; the caller re-advertises afterwards.
+func (p *Peer) forgetLinkLocked(id string) {
+	delete(p.interest, id)
+	delete(p.interestSeq, id)
+	delete(p.advertised, id)
+}
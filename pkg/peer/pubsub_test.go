@@ -0,0 +1,151 @@
+package peer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/p2p/pkg/message"
+	"example.com/p2p/pkg/transport"
+)
+
+// interestedIn reports whether p would forward topic to neighbour id.
+func interestedIn(p *Peer, id, topic string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.interestedLocked(id, topic)
+}
+
+func TestPublishReachesOnlySubscribers(t *testing.T) {
+	peers := memoryChain(t, 4)
+	first, last := peers[0], peers[3]
+
+	last.Subscribe("rust")
+	waitFor(t, func() bool { return interestedIn(first, peers[1].ID, "rust") })
+	if interestedIn(first, peers[1].ID, "go") {
+		t.Fatal("expected no interest in an unsubscribed topic")
+	}
+
+	if err := first.Publish("rust", message.NewChatMessage(first.ID, 1, "ownership")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	got := expectMessage(t, last, "ownership")
+	if got.Topic != "rust" {
+		t.Fatalf("expected topic rust, got %q", got.Topic)
+	}
+	for _, p := range peers[1:3] {
+		expectNoMessage(t, p)
+	}
+
+	if err := first.Publish("go", message.NewChatMessage(first.ID, 2, "goroutines")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	for _, p := range peers[1:] {
+		expectNoMessage(t, p)
+	}
+}
+
+func TestUnsubscribeWithdrawsInterest(t *testing.T) {
+	peers := memoryChain(t, 3)
+
+	peers[2].Subscribe("rust")
+	waitFor(t, func() bool { return interestedIn(peers[0], peers[1].ID, "rust") })
+
+	peers[2].Unsubscribe("rust")
+	waitFor(t, func() bool { return !interestedIn(peers[0], peers[1].ID, "rust") })
+	if subs := peers[2].Subscriptions(); len(subs) != 0 {
+		t.Fatalf("expected no subscriptions, got %v", subs)
+	}
+}
+
+func TestInterestDiesOutOnCycles(t *testing.T) {
+	peers := memoryChain(t, 4)
+	if _, err := peers[3].Connect(peers[0].Addr); err != nil {
+		t.Fatalf("close ring: %v", err)
+	}
+
+	peers[0].Subscribe("rust")
+	waitFor(t, func() bool { return interestedIn(peers[2], peers[1].ID, "rust") })
+
+	peers[0].Unsubscribe("rust")
+	for i, p := range peers {
+		prev, next := peers[(i+3)%4], peers[(i+1)%4]
+		waitFor(t, func() bool {
+			return !interestedIn(p, prev.ID, "rust") && !interestedIn(p, next.ID, "rust")
+		})
+	}
+}
+
+func TestLateNeighbourLearnsSubscriptions(t *testing.T) {
+	peers := memoryChain(t, 2)
+	peers[1].Subscribe("rust")
+	waitFor(t, func() bool { return interestedIn(peers[0], peers[1].ID, "rust") })
+
+	late := New("")
+	if _, err := late.Connect(peers[0].Addr); err == nil {
+		t.Fatal("expected error dialing without the memory transport")
+	}
+	late.SetTransport(peers[0].transport)
+	if _, err := late.Connect(peers[0].Addr); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	waitFor(t, func() bool { return interestedIn(late, peers[0].ID, "rust") })
+}
+
+func TestPublishFloodsToLegacyNeighbours(t *testing.T) {
+	mem := transport.NewMemory()
+	legacy := New("")
+	legacy.capabilities = []string{CapMsgChat}
+	legacy.SetTransport(mem)
+	ln, err := legacy.Listen("")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go legacy.Serve(ln)
+
+	p := New("")
+	p.SetTransport(mem)
+	if _, err := p.Connect(legacy.Addr); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if !interestedIn(p, legacy.ID, "anything") {
+		t.Fatal("expected neighbours without topic support to receive every topic")
+	}
+
+	legacy.Subscribe("rust")
+	if err := p.Publish("rust", message.NewChatMessage(p.ID, 1, "hello legacy")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	expectMessage(t, legacy, "hello legacy")
+}
+
+func TestBoundTopics(t *testing.T) {
+	got := boundTopics(map[string]int{
+		"rust":                   1,
+		"":                       1,
+		"go":                     -1,
+		strings.Repeat("x", 257): 1,
+	})
+	if !reflect.DeepEqual(got, map[string]int{"rust": 1}) {
+		t.Fatalf("expected only the valid topic to be kept, got %v", got)
+	}
+
+	topics := make(map[string]int)
+	for i := 0; i < maxTopics; i++ {
+		topics[fmt.Sprintf("near-%d", i)] = 1
+	}
+	for i := 0; i < 10; i++ {
+		topics[fmt.Sprintf("far-%d", i)] = 5
+	}
+	got = boundTopics(topics)
+	if len(got) != maxTopics {
+		t.Fatalf("expected %d topics, got %d", maxTopics, len(got))
+	}
+	for topic := range got {
+		if strings.HasPrefix(topic, "far-") {
+			t.Fatalf("expected the farthest topics to be dropped, kept %s", topic)
+		}
+	}
+}
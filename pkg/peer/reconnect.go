@@ -2,11 +2,13 @@ package peer
 
 import (
 	"context"
-	"math"
+	"errors"
 	"sync"
 	"time"
 
+	"example.com/p2p/pkg/addrbook"
 	"example.com/p2p/pkg/config"
+	"example.com/p2p/pkg/logger"
 )
 
 // ReconnectManager handles automatic reconnection to peers with exponential backoff
@@ -14,7 +16,10 @@ type ReconnectManager struct {
 	config     *config.Config
 	peer       *Peer
 	heartbeat  *HeartbeatManager
-	logger     interface{} // Logger interface to avoid circular dependency
+	book       *addrbook.Book
+	logger     *logger.Logger
+	policy     BackoffPolicy
+	clock      Clock
 	
 	mu         sync.RWMutex
 	reconnects map[string]*reconnectState
@@ -37,16 +42,52 @@ type reconnectState struct {
 func NewReconnectManager(cfg *config.Config, peer *Peer, heartbeat *HeartbeatManager) *ReconnectManager {
 	ctx, cancel := context.WithCancel(context.Background())
 	
+	clock := SystemClock
+	if peer != nil {
+		clock = peer.clock
+	}
 	return &ReconnectManager{
 		config:     cfg,
 		peer:       peer,
 		heartbeat:  heartbeat,
+		policy:     NewBackoffPolicy(cfg),
+		clock:      clock,
 		reconnects: make(map[string]*reconnectState),
 		ctx:        ctx,
 		cancel:     cancel,
 	}
 }
 
+// SetAddressBook makes the manager record the outcome of each attempt in
+// book and try the best-scored peers first.
+func (rm *ReconnectManager) SetAddressBook(book *addrbook.Book) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.book = book
+}
+
+// SetLogger makes the manager log reconnection attempts to l.
+func (rm *ReconnectManager) SetLogger(l *logger.Logger) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.logger = l
+}
+
+// SetBackoffPolicy replaces the policy that spaces out attempts to each
+// peer, which by default is the one selected by the configuration.
+func (rm *ReconnectManager) SetBackoffPolicy(policy BackoffPolicy) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.policy = policy
+}
+
+// SetClock replaces the clock used to schedule attempts.
+func (rm *ReconnectManager) SetClock(clock Clock) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.clock = clock
+}
+
 // Start begins the reconnection monitoring
 func (rm *ReconnectManager) Start() {
 	rm.wg.Add(1)
@@ -68,8 +109,8 @@ func (rm *ReconnectManager) AddPeer(addr string) {
 		rm.reconnects[addr] = &reconnectState{
 			addr:       addr,
 			attempts:   0,
-			backoff:    1 * time.Second, // Start with 1 second
-			maxBackoff: 5 * time.Minute, // Max 5 minutes
+			backoff:    time.Duration(rm.config.ReconnectBaseDelay),
+			maxBackoff: time.Duration(rm.config.ReconnectMaxDelay),
 			active:     false,
 		}
 	}
@@ -82,14 +123,24 @@ func (rm *ReconnectManager) RemovePeer(addr string) {
 	delete(rm.reconnects, addr)
 }
 
-// TriggerReconnect marks a peer for immediate reconnection
+// TriggerReconnect starts an immediate reconnection attempt to a tracked
+// peer, unless one is already running
 func (rm *ReconnectManager) TriggerReconnect(addr string) {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 	
-	if state, exists := rm.reconnects[addr]; exists {
+	if state, exists := rm.reconnects[addr]; exists && !state.active {
 		state.active = true
 		state.lastAttempt = time.Time{} // Reset to trigger immediate attempt
+		go rm.attemptReconnection(addr)
+	}
+}
+
+// CheckNow looks for disconnected peers right away instead of waiting for
+// the next check, e.g. after a peer was declared dead. Backoff still applies.
+func (rm *ReconnectManager) CheckNow() {
+	if rm.ctx.Err() == nil {
+		rm.checkReconnections()
 	}
 }
 
@@ -97,7 +148,7 @@ func (rm *ReconnectManager) TriggerReconnect(addr string) {
 func (rm *ReconnectManager) reconnectionLoop() {
 	defer rm.wg.Done()
 	
-	ticker := time.NewTicker(5 * time.Second) // Check every 5 seconds
+	ticker := time.NewTicker(time.Duration(rm.config.ReconnectInterval))
 	defer ticker.Stop()
 	
 	for {
@@ -114,24 +165,35 @@ func (rm *ReconnectManager) reconnectionLoop() {
 func (rm *ReconnectManager) checkReconnections() {
 	rm.mu.Lock()
 	peerAddrs := rm.config.Peers
+	if rm.book != nil {
+		peerAddrs = rm.book.Rank(peerAddrs)
+	}
 	reconnectStates := make(map[string]*reconnectState)
 	for addr, state := range rm.reconnects {
 		reconnectStates[addr] = state
 	}
 	rm.mu.Unlock()
 	
-	// Check if any configured peers are disconnected
+	// Check if any configured peers are disconnected, dialing in rank order
+	// no more of them than it takes to reach the target degree
+	links := rm.peer.Connections()
 	for _, addr := range peerAddrs {
-		if rm.shouldReconnect(addr) {
+		if target := rm.config.TargetDegree; target > 0 && links >= target {
+			return
+		}
+		if rm.claim(addr) {
+			links++
 			go rm.attemptReconnection(addr)
 		}
 	}
 }
 
-// shouldReconnect determines if we should attempt to reconnect to a peer
-func (rm *ReconnectManager) shouldReconnect(addr string) bool {
-	rm.mu.RLock()
-	defer rm.mu.RUnlock()
+// claim reports whether we should attempt to reconnect to a peer now, and if
+// so marks the attempt active before returning, so that overlapping checks
+// never start two attempts for the same address
+func (rm *ReconnectManager) claim(addr string) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
 	
 	// Check if peer is currently connected
 	if rm.isConnected(addr) {
@@ -141,9 +203,13 @@ func (rm *ReconnectManager) shouldReconnect(addr string) bool {
 	state, exists := rm.reconnects[addr]
 	if !exists {
 		// New peer, add it and attempt connection
-		rm.mu.RUnlock()
-		rm.AddPeer(addr)
-		rm.mu.RLock()
+		state = &reconnectState{
+			addr:       addr,
+			backoff:    time.Duration(rm.config.ReconnectBaseDelay),
+			maxBackoff: time.Duration(rm.config.ReconnectMaxDelay),
+			active:     true,
+		}
+		rm.reconnects[addr] = state
 		return true
 	}
 	
@@ -153,11 +219,16 @@ func (rm *ReconnectManager) shouldReconnect(addr string) bool {
 	}
 	
 	// Check if enough time has passed since last attempt
-	now := time.Now()
+	now := rm.clock.Now()
 	if now.Sub(state.lastAttempt) < state.backoff {
 		return false
 	}
 	
+	// Leave addresses alone while their circuit is open
+	if !rm.peer.CircuitBreaker().Ready(addr) {
+		return false
+	}
+	state.active = true
 	return true
 }
 
@@ -184,40 +255,71 @@ func (rm *ReconnectManager) attemptReconnection(addr string) {
 	
 	// Mark as active to prevent concurrent attempts
 	state.active = true
-	state.lastAttempt = time.Now()
+	state.lastAttempt = rm.clock.Now()
 	state.attempts++
+	attempt := state.attempts
+	log := rm.logger
 	rm.mu.Unlock()
 	
+	if log != nil {
+		log.Debug("Attempting reconnection", "address", addr, "attempt", attempt)
+	}
+	
 	// Attempt connection
+	start := time.Now()
 	remoteID, err := rm.peer.Connect(addr)
 	
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 	
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrConnectionLimit) {
+		// The attempt never reached the network.
+		state.attempts--
+		state.active = false
+		if log != nil {
+			log.Debug("Reconnection held back", "address", addr, "reason", err)
+		}
+		return
+	}
+	
+	if rm.book != nil {
+		if err != nil {
+			rm.book.MarkFailure(addr)
+		} else {
+			rm.book.MarkSuccess(addr, time.Since(start))
+		}
+	}
+	
 	if err != nil {
-		// Connection failed, increase backoff
-		state.backoff = time.Duration(float64(state.backoff) * 1.5)
+		// Connection failed, back off according to the policy
+		state.backoff = rm.policy.Next(state.attempts, state.backoff)
 		if state.backoff > state.maxBackoff {
 			state.backoff = state.maxBackoff
 		}
 		state.active = false
 		
-		// Log the failure (if logger is available)
-		if rm.logger != nil {
-			// In a real implementation, we'd call the logger here
+		if log != nil {
+			log.Warn("Reconnection failed",
+				"address", addr,
+				"attempt", attempt,
+				"retry_in", state.backoff,
+				"error", err)
 		}
 	} else {
 		// Connection successful, reset backoff and mark as inactive
-		state.backoff = 1 * time.Second
+		state.backoff = time.Duration(rm.config.ReconnectBaseDelay)
 		state.attempts = 0
 		state.active = false
 		
 		// Add to heartbeat monitoring
 		rm.heartbeat.AddPeer(remoteID, addr, nil)
 		
-		// Log the success (if logger is available)
-		if rm.logger != nil {
-			// In a real implementation, we'd call the logger here
+		if log != nil {
+			log.Info("Reconnected to peer",
+				"peer_id", remoteID,
+				"address", addr,
+				"attempts", attempt,
+				"event", "peer_reconnected")
 		}
 	}
 }
@@ -252,24 +354,14 @@ type ReconnectStats struct {
 	Active      bool
 }
 
-// CalculateBackoff calculates exponential backoff with jitter
+// CalculateBackoff calculates exponential backoff with jitter: base * 2^attempt,
+// moved up or down by up to 25% and capped at maxDelay. Use an
+// ExponentialBackoff with its own Rand for reproducible delays.
 func CalculateBackoff(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
 	if attempt <= 0 {
 		return baseDelay
 	}
 	
-	// Exponential backoff: base * 2^attempt
-	backoff := float64(baseDelay) * math.Pow(2, float64(attempt))
-	
-	// Add jitter (±25%)
-	jitterFactor := (float64(time.Now().UnixNano()%100) - 50) / 200 // ±25%
-	jitter := backoff * jitterFactor
-	backoff += jitter
-	
-	// Cap at maximum
-	if time.Duration(backoff) > maxDelay {
-		backoff = float64(maxDelay)
-	}
-	
-	return time.Duration(backoff)
+	policy := ExponentialBackoff{Base: baseDelay, Max: maxDelay, Jitter: 0.25}
+	return policy.Next(attempt+1, 0)
 }
\ No newline at end of file
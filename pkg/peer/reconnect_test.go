@@ -1,9 +1,13 @@
 package peer
 
 import (
+	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"example.com/p2p/pkg/addrbook"
 	"example.com/p2p/pkg/config"
 )
 
@@ -165,4 +169,163 @@ func TestReconnectStartStop(t *testing.T) {
 	
 	// Multiple stops should not panic
 	rm.Stop()
-}
\ No newline at end of file
+}
+
+func TestReconnectRecordsOutcome(t *testing.T) {
+	cfg := config.Default()
+	peer := New("localhost:0")
+	heartbeat := NewHeartbeatManager(cfg, peer.ID, nil)
+	rm := NewReconnectManager(cfg, peer, heartbeat)
+	defer rm.Stop()
+	
+	book := addrbook.New(10, 10)
+	book.Add("127.0.0.1:1", "")
+	rm.SetAddressBook(book)
+	
+	rm.AddPeer("127.0.0.1:1")
+	rm.attemptReconnection("127.0.0.1:1")
+	
+	if e, _ := book.Get("127.0.0.1:1"); e.Failures != 1 || e.LastFailure.IsZero() {
+		t.Errorf("expected failed attempt to be recorded, got %+v", e)
+	}
+}
+
+func TestReconnectUsesConfiguredBackoff(t *testing.T) {
+	cfg := config.Default()
+	cfg.ReconnectBaseDelay = config.JSONDuration(2 * time.Second)
+	cfg.ReconnectMaxDelay = config.JSONDuration(3 * time.Second)
+	peer := New("localhost:0")
+	heartbeat := NewHeartbeatManager(cfg, peer.ID, nil)
+	rm := NewReconnectManager(cfg, peer, heartbeat)
+	defer rm.Stop()
+	
+	rm.AddPeer("127.0.0.1:1")
+	if got := rm.GetReconnectionStats()["127.0.0.1:1"].Backoff; got != 2*time.Second {
+		t.Fatalf("expected initial backoff of 2s, got %v", got)
+	}
+	rm.attemptReconnection("127.0.0.1:1")
+	rm.attemptReconnection("127.0.0.1:1")
+	stats := rm.GetReconnectionStats()["127.0.0.1:1"]
+	if stats.Backoff != 3*time.Second || stats.Attempts != 2 {
+		t.Errorf("expected backoff capped at 3s after 2 attempts, got %v after %d", stats.Backoff, stats.Attempts)
+	}
+}
+
+func TestTriggerReconnectAttempts(t *testing.T) {
+	cfg := config.Default()
+	peer := New("localhost:0")
+	heartbeat := NewHeartbeatManager(cfg, peer.ID, nil)
+	rm := NewReconnectManager(cfg, peer, heartbeat)
+	defer rm.Stop()
+	
+	rm.AddPeer("127.0.0.1:1")
+	rm.TriggerReconnect("127.0.0.1:1")
+	waitFor(t, func() bool {
+		stats := rm.GetReconnectionStats()["127.0.0.1:1"]
+		return stats.Attempts == 1 && !stats.Active
+	})
+}
+
+func TestReconnectRestoresConfiguredPeer(t *testing.T) {
+	peers := memoryChain(t, 2)
+	a, b := peers[0], peers[1]
+	cfg := config.Default()
+	cfg.Peers = []string{b.Addr}
+	cfg.ReconnectBaseDelay = config.JSONDuration(10 * time.Millisecond)
+	cfg.ReconnectInterval = config.JSONDuration(time.Hour)
+	heartbeat := NewHeartbeatManager(cfg, a.ID, nil)
+	heartbeat.AddPeer(b.ID, b.Addr, nil)
+	rm := NewReconnectManager(cfg, a, heartbeat)
+	rm.Start()
+	defer rm.Stop()
+	
+	// The link is lost, as when the heartbeat declares the peer dead.
+	heartbeat.RemovePeer(b.ID)
+	a.RemoveConn(b.ID)
+	
+	rm.CheckNow()
+	waitFor(t, func() bool {
+		_, ok := a.Session(b.ID)
+		return ok && heartbeat.GetPeerCount() == 1
+	})
+	if stats := rm.GetReconnectionStats()[b.Addr]; stats.Attempts != 0 || stats.Backoff != 10*time.Millisecond {
+		t.Errorf("expected backoff reset after reconnecting, got %+v", stats)
+	}
+}
+
+func TestReconnectRespectsTargetDegree(t *testing.T) {
+	peers := memoryChain(t, 2)
+	a := peers[0]
+	cfg := config.Default()
+	cfg.Peers = []string{"127.0.0.1:1"}
+	cfg.TargetDegree = 1
+	heartbeat := NewHeartbeatManager(cfg, a.ID, nil)
+	rm := NewReconnectManager(cfg, a, heartbeat)
+	defer rm.Stop()
+	
+	// a already has its one link, to peers[1].
+	rm.CheckNow()
+	if _, ok := rm.GetReconnectionStats()["127.0.0.1:1"]; ok {
+		t.Fatal("expected no attempt once the target degree is reached")
+	}
+	
+	cfg.TargetDegree = 2
+	rm.CheckNow()
+	if _, ok := rm.GetReconnectionStats()["127.0.0.1:1"]; !ok {
+		t.Fatal("expected an attempt below the target degree")
+	}
+}
+
+func TestCheckNowDuringTickStartsOneAttempt(t *testing.T) {
+	// The listener accepts and never answers, so an attempt stays in its
+	// handshake until the connection is closed.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	var accepted atomic.Int32
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			conns = append(conns, conn)
+		}
+	}()
+	
+	cfg := config.Default()
+	cfg.Peers = []string{ln.Addr().String()}
+	cfg.ReconnectBaseDelay = 0
+	cfg.ReconnectInterval = config.JSONDuration(time.Millisecond)
+	p := New("localhost:0")
+	heartbeat := NewHeartbeatManager(cfg, p.ID, nil)
+	rm := NewReconnectManager(cfg, p, heartbeat)
+	rm.Start()
+	defer rm.Stop()
+	
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				rm.CheckNow()
+			}
+		}()
+	}
+	wg.Wait()
+	time.Sleep(50 * time.Millisecond)
+	
+	if n := accepted.Load(); n != 1 {
+		t.Fatalf("expected a single attempt in flight, got %d", n)
+	}
+}
@@ -0,0 +1,110 @@
+package peer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/message"
+)
+
+func TestBroadcastSignsOwnMessages(t *testing.T) {
+	p := New("localhost:0")
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	p.AddConn("peer1", a)
+
+	got := make(chan *message.Message, 1)
+	go func() {
+		m, _ := message.NewDecoder(b).Decode()
+		got <- m
+	}()
+
+	if err := p.Broadcast(message.NewChatMessage(p.ID, 1, "hello")); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	m := <-got
+	if m == nil {
+		t.Fatal("failed to read broadcast")
+	}
+	if err := m.Verify(); err != nil {
+		t.Fatalf("expected signed message, verify: %v", err)
+	}
+}
+
+func TestReadLoopDropsTamperedMessages(t *testing.T) {
+	sender := New("localhost:0")
+	p := New("localhost:0")
+
+	// relay target that must only see the genuine message
+	outA, outB := net.Pipe()
+	defer outA.Close()
+	defer outB.Close()
+	p.AddConn("peer1", outA)
+
+	inA, inB := net.Pipe()
+	defer inA.Close()
+	defer inB.Close()
+	p.HandleConn("relay", inB)
+
+	forged := message.NewChatMessage(sender.ID, 1, "hello")
+	forged.Sign(sender.Identity())
+	forged.Payload = "tampered"
+
+	genuine := message.NewChatMessage(sender.ID, 1, "hello")
+	genuine.Sign(sender.Identity())
+
+	relayed := make(chan *message.Message, 1)
+	go func() {
+		m, _ := message.NewDecoder(outB).Decode()
+		relayed <- m
+	}()
+
+	enc := message.NewEncoder(inA)
+	if err := enc.Encode(forged); err != nil {
+		t.Fatalf("write forged: %v", err)
+	}
+	if err := enc.Encode(genuine); err != nil {
+		t.Fatalf("write genuine: %v", err)
+	}
+
+	select {
+	case m := <-p.Messages:
+		if m.Payload != "hello" {
+			t.Fatalf("expected genuine payload, got %s", m.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for genuine message")
+	}
+	if m := <-relayed; m == nil || m.Payload != "hello" {
+		t.Fatalf("expected genuine message to be relayed, got %+v", m)
+	}
+	if got := p.RejectedMessages(); got != 1 {
+		t.Fatalf("expected 1 rejected message, got %d", got)
+	}
+}
+
+func TestReadLoopRequireSignatures(t *testing.T) {
+	p := New("localhost:0")
+	p.requireSignatures = true
+
+	inA, inB := net.Pipe()
+	defer inA.Close()
+	defer inB.Close()
+	p.HandleConn("peer1", inB)
+
+	if err := message.NewEncoder(inA).Encode(message.NewChatMessage("someone", 1, "unsigned")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	select {
+	case m := <-p.Messages:
+		t.Fatalf("unexpected delivery of unsigned message: %+v", m)
+	default:
+	}
+	if got := p.RejectedMessages(); got != 1 {
+		t.Fatalf("expected 1 rejected message, got %d", got)
+	}
+}
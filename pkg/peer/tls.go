@@ -0,0 +1,82 @@
+package peer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+
+	"example.com/p2p/pkg/identity"
+)
+
+// ErrEncryptionRequired is returned when encryption is required locally but
+// the remote peer does not support it.
+var ErrEncryptionRequired = errors.New("encryption required but not supported by peer")
+
+// upgradeTLS wraps conn in a TLS 1.3 session. Both sides present self-signed
+// certificates for their identity keys, and each side pins the remote
+// certificate to the ID announced in the hello. The peer with the lower ID
+// acts as the TLS client so that both ends agree on their roles without
+// knowing who dialed.
+func (p *Peer) upgradeTLS(conn net.Conn, remoteID string) (net.Conn, error) {
+	cert, err := p.certificate()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS13,
+		// Certificates are self-signed; the chain is replaced by pinning
+		// the key to the expected peer ID in VerifyPeerCertificate.
+		InsecureSkipVerify:    true,
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: pinPeerID(remoteID),
+	}
+
+	var tlsConn *tls.Conn
+	if p.ID < remoteID {
+		tlsConn = tls.Client(conn, cfg)
+	} else {
+		tlsConn = tls.Server(conn, cfg)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("tls handshake: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// pinPeerID returns a certificate check that accepts only a certificate whose
+// key derives the expected peer ID.
+func pinPeerID(expected string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("%w: no certificate presented", ErrAuthFailed)
+		}
+		id, err := identity.IDFromCertificate(rawCerts[0])
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrAuthFailed, err)
+		}
+		if id != expected {
+			return fmt.Errorf("%w: certificate for %s, expected %s", ErrAuthFailed, id, expected)
+		}
+		return nil
+	}
+}
+
+// certificate returns the cached TLS certificate for the peer's identity,
+// generating it on first use.
+func (p *Peer) certificate() (tls.Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tlsCert != nil {
+		return *p.tlsCert, nil
+	}
+	cert, err := p.identity.TLSCertificate()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	p.tlsCert = &cert
+	return cert, nil
+}
@@ -0,0 +1,141 @@
+package peer
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/identity"
+	"example.com/p2p/pkg/message"
+)
+
+// recordingConn captures every byte written to the underlying connection.
+type recordingConn struct {
+	net.Conn
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	c.buf.Write(b)
+	c.mu.Unlock()
+	return c.Conn.Write(b)
+}
+
+func (c *recordingConn) written() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.buf.Bytes()...)
+}
+
+func TestHandshakeEncryptsTraffic(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	rec := &recordingConn{Conn: c2}
+
+	p1 := New("localhost:0")
+	p2 := New("localhost:0")
+
+	go func() {
+		secured, sess, err := p1.Handshake(c1)
+		if err != nil {
+			return
+		}
+		p1.HandleSession(sess, secured)
+	}()
+
+	secured, sess, err := p2.Handshake(rec)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if !sess.Encrypted {
+		t.Fatal("expected session to be encrypted")
+	}
+	p2.HandleSession(sess, secured)
+
+	const secret = "top secret payload"
+	if err := p2.Broadcast(message.NewChatMessage(p2.ID, 1, secret)); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	select {
+	case m := <-p1.Messages:
+		if m.Payload != secret {
+			t.Fatalf("expected %q, got %q", secret, m.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+
+	if bytes.Contains(rec.written(), []byte(secret)) {
+		t.Fatal("payload crossed the wire in plaintext")
+	}
+}
+
+func TestRequireEncryptionRefusesPlaintextPeer(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	plaintext := New("localhost:0")
+	plaintext.capabilities = []string{CapMsgChat}
+	go func() {
+		_, _, _ = plaintext.Handshake(c1)
+	}()
+
+	strict := New("localhost:0")
+	strict.requireEncryption = true
+	if _, _, err := strict.Handshake(c2); !errors.Is(err, ErrEncryptionRequired) {
+		t.Fatalf("expected ErrEncryptionRequired, got %v", err)
+	}
+}
+
+func TestPlaintextFallbackWithoutRequirement(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	plaintext := New("localhost:0")
+	plaintext.capabilities = []string{CapMsgChat}
+	go func() {
+		_, _, _ = plaintext.Handshake(c1)
+	}()
+
+	_, sess, err := New("localhost:0").Handshake(c2)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if sess.Encrypted {
+		t.Fatal("expected plaintext session")
+	}
+}
+
+func TestTLSCertificatePinnedToHelloID(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	// The attacker announces its own ID but presents a certificate for a
+	// different key during the TLS handshake.
+	attacker := New("localhost:0")
+	other, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	cert, err := other.TLSCertificate()
+	if err != nil {
+		t.Fatalf("certificate: %v", err)
+	}
+	attacker.tlsCert = &cert
+	go func() {
+		_, _, _ = attacker.Handshake(c1)
+	}()
+
+	if _, _, err := New("localhost:0").Handshake(c2); err == nil {
+		t.Fatal("expected handshake to fail with mismatched certificate")
+	}
+}
@@ -0,0 +1,116 @@
+package peer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/p2p/pkg/message"
+	"example.com/p2p/pkg/transport"
+)
+
+// TestMemoryTransportNetwork runs a ring of peers over the in-memory
+// transport and checks that a broadcast reaches every node.
+func TestMemoryTransportNetwork(t *testing.T) {
+	const numPeers = 20
+	mem := transport.NewMemory()
+	peers := make([]*Peer, numPeers)
+
+	for i := range peers {
+		p := New("")
+		p.SetTransport(mem)
+		ln, err := p.Listen("")
+		if err != nil {
+			t.Fatalf("listen peer %d: %v", i, err)
+		}
+		defer ln.Close()
+		go p.Serve(ln)
+		peers[i] = p
+	}
+
+	for i, p := range peers {
+		next := peers[(i+1)%numPeers]
+		if _, err := p.Connect(next.Addr); err != nil {
+			t.Fatalf("connect peer %d to %d: %v", i, (i+1)%numPeers, err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for _, p := range peers {
+		for p.Connections() < 2 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if p.Connections() != 2 {
+			t.Fatalf("expected 2 connections, got %d", p.Connections())
+		}
+	}
+
+	msg := message.NewChatMessage(peers[0].ID, 1, "over the pipe")
+	if err := peers[0].Broadcast(msg); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+
+	for i, p := range peers[1:] {
+		select {
+		case got := <-p.Messages:
+			if got.Payload != msg.Payload {
+				t.Errorf("peer %d: expected %q, got %q", i+1, msg.Payload, got.Payload)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("peer %d did not receive the broadcast", i+1)
+		}
+	}
+}
+
+func TestListenAdvertisesBoundAddress(t *testing.T) {
+	p := New("localhost:0")
+	ln, err := p.Listen("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	if want := "tcp://" + ln.Addr().String(); p.Addr != want {
+		t.Fatalf("expected advertised address %s, got %s", want, p.Addr)
+	}
+
+	q := New("")
+	go p.Serve(ln)
+	if _, err := q.Connect(p.Addr); err != nil {
+		t.Fatalf("connect via scheme-prefixed address: %v", err)
+	}
+}
+
+func TestWebSocketPeers(t *testing.T) {
+	p1 := New("")
+	ln, err := p1.Listen("ws://127.0.0.1:0/p2p")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	if !strings.HasPrefix(p1.Addr, "ws://127.0.0.1:") || !strings.HasSuffix(p1.Addr, "/p2p") {
+		t.Fatalf("unexpected advertised address %s", p1.Addr)
+	}
+	go p1.Serve(ln)
+
+	p2 := New("")
+	remoteID, err := p2.Connect(p1.Addr)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if remoteID != p1.ID {
+		t.Fatalf("expected remote ID %s, got %s", p1.ID, remoteID)
+	}
+
+	msg := message.NewChatMessage(p2.ID, 1, "over websocket")
+	if err := p2.Broadcast(msg); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	select {
+	case got := <-p1.Messages:
+		if got.Payload != msg.Payload {
+			t.Fatalf("expected %q, got %q", msg.Payload, got.Payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received over websocket")
+	}
+}
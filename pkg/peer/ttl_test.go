@@ -0,0 +1,85 @@
+package peer
+
+import (
+	"testing"
+
+	"example.com/p2p/pkg/message"
+)
+
+func TestTTLBoundsPropagation(t *testing.T) {
+	peers := memoryChain(t, 5)
+
+	msg := message.NewChatMessage(peers[0].ID, 1, "two hops")
+	msg.TTL = 2
+	if err := peers[0].Broadcast(msg); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+
+	if got := expectMessage(t, peers[1], "two hops"); got.TTL != 2 {
+		t.Errorf("expected first hop to see TTL 2, got %d", got.TTL)
+	}
+	if got := expectMessage(t, peers[2], "two hops"); got.TTL != 1 {
+		t.Errorf("expected second hop to see TTL 1, got %d", got.TTL)
+	}
+	expectNoMessage(t, peers[3])
+	expectNoMessage(t, peers[4])
+}
+
+func TestBroadcastAppliesDefaultTTL(t *testing.T) {
+	peers := memoryChain(t, 2)
+	peers[0].ttl = 3
+
+	msg := message.NewChatMessage(peers[0].ID, 1, "default ttl")
+	if err := peers[0].Broadcast(msg); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	if got := expectMessage(t, peers[1], "default ttl"); got.TTL != 3 {
+		t.Errorf("expected TTL 3, got %d", got.TTL)
+	}
+	if msg.TTL != 0 {
+		t.Errorf("expected caller's message to be left untouched, got TTL %d", msg.TTL)
+	}
+}
+
+func TestHopClampsExcessiveTTL(t *testing.T) {
+	p := New("")
+	p.ttl = 4
+
+	tests := []struct {
+		in, want int
+	}{
+		{0, 3},   // unset: local default applies
+		{100, 3}, // above the local limit
+		{4, 3},
+		{2, 1},
+		{1, -1}, // last hop: delivered, not forwarded
+	}
+	for _, tt := range tests {
+		next := p.hop(&message.Message{TTL: tt.in})
+		switch {
+		case tt.want < 0 && next != nil:
+			t.Errorf("TTL %d: expected no forwarding, got TTL %d", tt.in, next.TTL)
+		case tt.want >= 0 && (next == nil || next.TTL != tt.want):
+			t.Errorf("TTL %d: expected forwarded TTL %d, got %v", tt.in, tt.want, next)
+		}
+	}
+}
+
+func TestTTLNotCoveredBySignature(t *testing.T) {
+	peers := memoryChain(t, 3)
+	peers[1].requireSignatures = true
+	peers[2].requireSignatures = true
+
+	msg := message.NewChatMessage(peers[0].ID, 1, "signed")
+	if err := peers[0].Broadcast(msg); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	expectMessage(t, peers[1], "signed")
+	got := expectMessage(t, peers[2], "signed")
+	if err := got.Verify(); err != nil {
+		t.Fatalf("expected relayed message to verify, got %v", err)
+	}
+	if peers[2].RejectedMessages() != 0 {
+		t.Fatalf("expected no rejected messages, got %d", peers[2].RejectedMessages())
+	}
+}
@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"net"
+	"strings"
+)
+
+// splitHostPort splits the native form of a TCP or WebSocket address into
+// host, port and, for WebSocket, path.
+func splitHostPort(native string) (host, port, path string, err error) {
+	hostport := native
+	if i := strings.Index(native, "/"); i >= 0 {
+		hostport, path = native[:i], native[i:]
+	}
+	host, port, err = net.SplitHostPort(hostport)
+	return host, port, path, err
+}
+
+func hasHost(scheme string) bool {
+	return scheme == "tcp" || scheme == WebSocketScheme
+}
+
+// Unspecified reports whether addr is a TCP or WebSocket address whose host
+// is empty or an unspecified IP such as 0.0.0.0. Such an address is fine to
+// listen on but cannot be dialed by other machines.
+func Unspecified(addr string) bool {
+	scheme, native := ParseAddr(addr)
+	if !hasHost(scheme) {
+		return false
+	}
+	host, _, _, err := splitHostPort(native)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return host == "" || (ip != nil && ip.IsUnspecified())
+}
+
+// ResolveHost replaces an unspecified host in addr with the host of remote,
+// typically the address a connection or announcement for addr came from.
+// Other addresses are returned unchanged, as is the scheme prefix, if any.
+func ResolveHost(addr string, remote net.Addr) string {
+	if !Unspecified(addr) || remote == nil {
+		return addr
+	}
+	scheme, native := ParseAddr(addr)
+	_, port, path, _ := splitHostPort(native)
+	remoteHost, _, err := net.SplitHostPort(remote.String())
+	if err != nil {
+		return addr
+	}
+	resolved := net.JoinHostPort(remoteHost, port) + path
+	if strings.Contains(addr, "://") {
+		return FormatAddr(scheme, resolved)
+	}
+	return resolved
+}
@@ -0,0 +1,121 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// MemoryScheme is the scheme conventionally registered for Memory.
+const MemoryScheme = "mem"
+
+// ErrConnectionRefused is returned when dialing a memory address nobody is
+// listening on.
+var ErrConnectionRefused = errors.New("connection refused")
+
+// Memory is an in-process transport. Listeners are registered by name and
+// connections are synchronous net.Pipe pairs, so whole networks can be
+// simulated without opening ports. Each Memory is an isolated namespace.
+type Memory struct {
+	mu        sync.Mutex
+	listeners map[string]*memListener
+	next      int
+}
+
+// NewMemory returns an empty in-process network.
+func NewMemory() *Memory {
+	return &Memory{listeners: make(map[string]*memListener)}
+}
+
+// Listen registers a listener under addr. An empty addr picks a unique name.
+func (m *Memory) Listen(addr string) (net.Listener, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if addr == "" {
+		m.next++
+		addr = "node-" + strconv.Itoa(m.next)
+	}
+	if _, ok := m.listeners[addr]; ok {
+		return nil, fmt.Errorf("listen %s://%s: address already in use", MemoryScheme, addr)
+	}
+	l := &memListener{
+		mem:   m,
+		addr:  memAddr(addr),
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	m.listeners[addr] = l
+	return l, nil
+}
+
+// Dial connects to the listener registered under addr.
+func (m *Memory) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	m.mu.Lock()
+	l, ok := m.listeners[addr]
+	m.next++
+	local := memAddr("client-" + strconv.Itoa(m.next))
+	m.mu.Unlock()
+	if !ok {
+		return nil, &net.OpError{Op: "dial", Net: MemoryScheme, Addr: memAddr(addr), Err: ErrConnectionRefused}
+	}
+
+	client, server := net.Pipe()
+	select {
+	case l.conns <- &memConn{Conn: server, local: l.addr, remote: local}:
+		return &memConn{Conn: client, local: local, remote: l.addr}, nil
+	case <-l.done:
+		client.Close()
+		server.Close()
+		return nil, &net.OpError{Op: "dial", Net: MemoryScheme, Addr: l.addr, Err: ErrConnectionRefused}
+	case <-ctx.Done():
+		client.Close()
+		server.Close()
+		return nil, ctx.Err()
+	}
+}
+
+type memListener struct {
+	mem       *Memory
+	addr      memAddr
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.mem.mu.Lock()
+		delete(l.mem.listeners, string(l.addr))
+		l.mem.mu.Unlock()
+	})
+	return nil
+}
+
+func (l *memListener) Addr() net.Addr { return l.addr }
+
+// memConn overrides the pipe's placeholder addresses.
+type memConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *memConn) LocalAddr() net.Addr  { return c.local }
+func (c *memConn) RemoteAddr() net.Addr { return c.remote }
+
+type memAddr string
+
+func (a memAddr) Network() string { return MemoryScheme }
+func (a memAddr) String() string  { return string(a) }
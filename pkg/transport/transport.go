@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// DefaultScheme is assumed for addresses without a scheme prefix so that
+// plain host:port addresses keep working.
+const DefaultScheme = "tcp"
+
+// Transport establishes connections between peers. Addresses passed to a
+// Transport are in its native form, without a scheme prefix.
+type Transport interface {
+	Dial(ctx context.Context, addr string) (net.Conn, error)
+	Listen(addr string) (net.Listener, error)
+}
+
+// ParseAddr splits a scheme-prefixed address such as "unix:///tmp/p2p.sock"
+// into its scheme and native address. Addresses without a prefix use
+// DefaultScheme.
+func ParseAddr(addr string) (scheme, native string) {
+	if i := strings.Index(addr, "://"); i >= 0 {
+		return strings.ToLower(addr[:i]), addr[i+3:]
+	}
+	return DefaultScheme, addr
+}
+
+// FormatAddr joins a scheme and native address into a scheme-prefixed
+// address.
+func FormatAddr(scheme, native string) string {
+	return scheme + "://" + native
+}
+
+// Mux dispatches scheme-prefixed addresses to the transport registered for
+// the scheme.
+type Mux struct {
+	mu         sync.RWMutex
+	transports map[string]Transport
+}
+
+// NewMux returns an empty Mux.
+func NewMux() *Mux {
+	return &Mux{transports: make(map[string]Transport)}
+}
+
+// Default returns a Mux with the TCP, Unix socket and WebSocket transports
+// registered.
+func Default() *Mux {
+	m := NewMux()
+	m.Register("tcp", TCP{})
+	m.Register("unix", Unix{})
+	m.Register(WebSocketScheme, WebSocket{})
+	return m
+}
+
+// Register makes t handle addresses with the given scheme, replacing any
+// transport previously registered for it.
+func (m *Mux) Register(scheme string, t Transport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transports[strings.ToLower(scheme)] = t
+}
+
+// Schemes returns the registered schemes.
+func (m *Mux) Schemes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	schemes := make([]string, 0, len(m.transports))
+	for s := range m.transports {
+		schemes = append(schemes, s)
+	}
+	return schemes
+}
+
+func (m *Mux) lookup(addr string) (Transport, string, error) {
+	scheme, native := ParseAddr(addr)
+	m.mu.RLock()
+	t, ok := m.transports[scheme]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported transport scheme %q in %s", scheme, addr)
+	}
+	return t, native, nil
+}
+
+// Dial connects to a scheme-prefixed address.
+func (m *Mux) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	t, native, err := m.lookup(addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.Dial(ctx, native)
+}
+
+// Listen listens on a scheme-prefixed address.
+func (m *Mux) Listen(addr string) (net.Listener, error) {
+	t, native, err := m.lookup(addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.Listen(native)
+}
+
+// TCP is the transport for "tcp://host:port" addresses.
+type TCP struct{}
+
+// Dial connects to a TCP address.
+func (TCP) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// Listen listens on a TCP address.
+func (TCP) Listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// Unix is the transport for "unix:///path/to/socket" addresses.
+type Unix struct{}
+
+// Dial connects to a Unix domain socket.
+func (Unix) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", addr)
+}
+
+// Listen listens on a Unix domain socket. The socket file is removed when the
+// listener is closed.
+func (Unix) Listen(addr string) (net.Listener, error) {
+	return net.Listen("unix", addr)
+}
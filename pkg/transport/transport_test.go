@@ -0,0 +1,179 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		addr, scheme, native string
+	}{
+		{"localhost:8080", "tcp", "localhost:8080"},
+		{"tcp://127.0.0.1:9000", "tcp", "127.0.0.1:9000"},
+		{"unix:///tmp/p2p.sock", "unix", "/tmp/p2p.sock"},
+		{"MEM://node-1", "mem", "node-1"},
+	}
+	for _, tt := range tests {
+		scheme, native := ParseAddr(tt.addr)
+		if scheme != tt.scheme || native != tt.native {
+			t.Errorf("ParseAddr(%q) = %q, %q; want %q, %q", tt.addr, scheme, native, tt.scheme, tt.native)
+		}
+	}
+}
+
+// roundTrip listens on addr, dials it and checks that bytes flow both ways.
+func roundTrip(t *testing.T, tr Transport, addr string) {
+	t.Helper()
+	ln, err := tr.Listen(addr)
+	if err != nil {
+		t.Fatalf("listen %s: %v", addr, err)
+	}
+	defer ln.Close()
+
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(c, c)
+	}()
+
+	dialAddr := ln.Addr().String()
+	if _, ok := tr.(*Mux); ok {
+		scheme, _ := ParseAddr(addr)
+		dialAddr = FormatAddr(scheme, dialAddr)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c, err := tr.Dial(ctx, dialAddr)
+	if err != nil {
+		t.Fatalf("dial %s: %v", dialAddr, err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(time.Second))
+
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("expected echo, got %q", buf)
+	}
+}
+
+func TestTCP(t *testing.T) {
+	roundTrip(t, TCP{}, "127.0.0.1:0")
+}
+
+func TestUnix(t *testing.T) {
+	roundTrip(t, Unix{}, filepath.Join(t.TempDir(), "p2p.sock"))
+}
+
+func TestMemory(t *testing.T) {
+	roundTrip(t, NewMemory(), "node-a")
+}
+
+func TestMuxDispatchesOnScheme(t *testing.T) {
+	m := Default()
+	m.Register(MemoryScheme, NewMemory())
+
+	roundTrip(t, m, "127.0.0.1:0")
+	roundTrip(t, m, "tcp://127.0.0.1:0")
+	roundTrip(t, m, "unix://"+filepath.Join(t.TempDir(), "p2p.sock"))
+	roundTrip(t, m, "mem://node-a")
+
+	if _, err := m.Listen("carrier-pigeon://coop"); err == nil {
+		t.Fatal("expected error for unregistered scheme")
+	}
+	if _, err := m.Dial(context.Background(), "carrier-pigeon://coop"); err == nil {
+		t.Fatal("expected error for unregistered scheme")
+	}
+}
+
+func TestMemoryDialRefused(t *testing.T) {
+	m := NewMemory()
+	if _, err := m.Dial(context.Background(), "nobody"); !errors.Is(err, ErrConnectionRefused) {
+		t.Fatalf("expected ErrConnectionRefused, got %v", err)
+	}
+
+	ln, err := m.Listen("node-a")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if _, err := m.Listen("node-a"); err == nil {
+		t.Fatal("expected error listening twice on the same address")
+	}
+	ln.Close()
+	if _, err := ln.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected net.ErrClosed after close, got %v", err)
+	}
+	if _, err := m.Dial(context.Background(), "node-a"); !errors.Is(err, ErrConnectionRefused) {
+		t.Fatalf("expected ErrConnectionRefused after close, got %v", err)
+	}
+}
+
+func TestMemoryAddresses(t *testing.T) {
+	m := NewMemory()
+	ln, err := m.Listen("")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	if ln.Addr().String() == "" || ln.Addr().Network() != MemoryScheme {
+		t.Fatalf("unexpected listener address %v/%v", ln.Addr().Network(), ln.Addr())
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := ln.Accept()
+		accepted <- c
+	}()
+	c, err := m.Dial(context.Background(), ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	s := <-accepted
+	defer s.Close()
+
+	if c.RemoteAddr().String() != ln.Addr().String() {
+		t.Errorf("expected client remote addr %v, got %v", ln.Addr(), c.RemoteAddr())
+	}
+	if s.RemoteAddr().String() != c.LocalAddr().String() {
+		t.Errorf("expected server remote addr %v, got %v", c.LocalAddr(), s.RemoteAddr())
+	}
+}
+
+func TestResolveHost(t *testing.T) {
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.7"), Port: 51234}
+	tests := []struct {
+		addr, want string
+	}{
+		{"0.0.0.0:8080", "192.0.2.7:8080"},
+		{":8080", "192.0.2.7:8080"},
+		{"tcp://[::]:8080", "tcp://192.0.2.7:8080"},
+		{"ws://0.0.0.0:8080/p2p", "ws://192.0.2.7:8080/p2p"},
+		{"peer1:8080", "peer1:8080"},
+		{"10.0.0.1:8080", "10.0.0.1:8080"},
+		{"unix:///tmp/p2p.sock", "unix:///tmp/p2p.sock"},
+		{"mem://node-1", "mem://node-1"},
+	}
+	for _, tt := range tests {
+		if got := ResolveHost(tt.addr, remote); got != tt.want {
+			t.Errorf("ResolveHost(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+	if !Unspecified("0.0.0.0:8080") || Unspecified("peer1:8080") || Unspecified("unix:///tmp/p2p.sock") {
+		t.Error("unexpected Unspecified result")
+	}
+}
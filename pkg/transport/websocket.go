@@ -0,0 +1,539 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocketScheme is the scheme registered for WebSocket.
+const WebSocketScheme = "ws"
+
+// websocketGUID is the fixed key suffix from RFC 6455 section 1.3.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxControlPayload is the largest payload allowed in a control frame.
+const maxControlPayload = 125
+
+// WebSocket opcodes from RFC 6455 section 5.2.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// defaultHeaderTimeout bounds how long a client may take to send the
+// upgrade request headers when WebSocket.HeaderTimeout is not set.
+const defaultHeaderTimeout = 10 * time.Second
+
+// noDeadline clears a deadline set for the opening handshake.
+var noDeadline time.Time
+
+// ErrBadHandshake is returned when the WebSocket opening handshake fails.
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// WebSocket is the transport for "ws://host:port/path" addresses. The byte
+// stream is carried in binary frames, so the framed message protocol runs
+// over it unchanged, and connections can pass through HTTP proxies.
+type WebSocket struct {
+	// Proxy selects an HTTP proxy for outgoing connections. If nil,
+	// http.ProxyFromEnvironment is used. Proxies are reached over plain
+	// TCP for http URLs and over TLS for https URLs; other schemes are
+	// refused.
+	Proxy func(*http.Request) (*url.URL, error)
+	// ProxyTLSConfig configures the TLS connection to an https proxy. If
+	// nil, the default configuration is used.
+	ProxyTLSConfig *tls.Config
+	// HeaderTimeout bounds how long a listener waits for the headers of
+	// an upgrade request before closing the connection. If zero, 10
+	// seconds.
+	HeaderTimeout time.Duration
+}
+
+// Dial opens a WebSocket connection to "host:port/path".
+func (ws WebSocket) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	u, err := url.Parse("ws://" + addr)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: parse %s: %w", addr, err)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	key, err := newChallengeKey()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	proxy := ws.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	// ProxyFromEnvironment only looks at http and https URLs.
+	proxyURL, err := proxy(&http.Request{URL: &url.URL{Scheme: "http", Host: u.Host}})
+	if err != nil {
+		return nil, err
+	}
+
+	dialAddr := host
+	if proxyURL != nil {
+		if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+			return nil, fmt.Errorf("websocket: unsupported proxy scheme %q", proxyURL.Scheme)
+		}
+		dialAddr = proxyHost(proxyURL)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", dialAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if proxyURL != nil && proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, ws.proxyTLSConfig(proxyURL))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("websocket: proxy TLS handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+	if proxyURL != nil {
+		if err := proxyConnect(conn, proxyURL, host); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	br := bufio.NewReader(conn)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!headerContains(resp.Header, "Upgrade", "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s", ErrBadHandshake, resp.Status)
+	}
+	conn.SetDeadline(noDeadline)
+
+	return newWSConn(conn, br, true), nil
+}
+
+// Listen serves WebSocket upgrades on "host:port/path". Requests for other
+// paths are answered with 404.
+func (ws WebSocket) Listen(addr string) (net.Listener, error) {
+	hostport, path := addr, "/"
+	if i := strings.Index(addr, "/"); i >= 0 {
+		hostport, path = addr[:i], addr[i:]
+	}
+	ln, err := net.Listen("tcp", hostport)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &wsListener{
+		inner: ln,
+		path:  path,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	headerTimeout := ws.HeaderTimeout
+	if headerTimeout <= 0 {
+		headerTimeout = defaultHeaderTimeout
+	}
+	l.server = &http.Server{Handler: l, ReadHeaderTimeout: headerTimeout}
+	go l.server.Serve(ln)
+	return l, nil
+}
+
+// wsListener adapts an http.Server to net.Listener by handing upgraded
+// connections to Accept.
+type wsListener struct {
+	inner     net.Listener
+	path      string
+	server    *http.Server
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *wsListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != l.path {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	conn.SetDeadline(noDeadline)
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return
+	}
+
+	select {
+	case l.conns <- newWSConn(conn, rw.Reader, false):
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *wsListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *wsListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = l.server.Close()
+	})
+	return err
+}
+
+func (l *wsListener) Addr() net.Addr {
+	if l.path == "/" {
+		return l.inner.Addr()
+	}
+	return wsAddr(l.inner.Addr().String() + l.path)
+}
+
+type wsAddr string
+
+func (a wsAddr) Network() string { return WebSocketScheme }
+func (a wsAddr) String() string  { return string(a) }
+
+// wsConn presents a WebSocket as a byte stream. Each Write is sent as one
+// binary frame; Read returns frame payloads back to back, answering pings
+// and treating a close frame as end of stream.
+type wsConn struct {
+	net.Conn
+	br     *bufio.Reader
+	client bool
+
+	readMu    sync.Mutex
+	remaining int64
+	masked    bool
+	mask      [4]byte
+	maskPos   int
+	eof       bool
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+func newWSConn(conn net.Conn, br *bufio.Reader, client bool) *wsConn {
+	return &wsConn{Conn: conn, br: br, client: client}
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for c.remaining == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.br.Read(b)
+	if c.masked {
+		for i := 0; i < n; i++ {
+			b[i] ^= c.mask[c.maskPos&3]
+			c.maskPos++
+		}
+	}
+	c.remaining -= int64(n)
+	return n, err
+}
+
+// nextFrame reads frame headers until a data frame with a payload is found,
+// handling control frames along the way.
+func (c *wsConn) nextFrame() error {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return err
+	}
+	opcode := hdr[0] & 0x0F
+	masked := hdr[1]&0x80 != 0
+	length := int64(hdr[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]) & (1<<63 - 1))
+	}
+
+	// Clients must mask their frames and servers must not.
+	if masked == c.client {
+		return fmt.Errorf("websocket: unexpected frame masking")
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return err
+		}
+	}
+
+	switch opcode {
+	case opContinuation, opText, opBinary:
+		c.remaining = length
+		c.masked = masked
+		c.mask = mask
+		c.maskPos = 0
+		return nil
+	case opClose, opPing, opPong:
+		if length > maxControlPayload {
+			return fmt.Errorf("websocket: control frame too large")
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return err
+		}
+		if masked {
+			for i := range payload {
+				payload[i] ^= mask[i&3]
+			}
+		}
+		switch opcode {
+		case opClose:
+			c.eof = true
+			c.writeFrame(opClose, nil)
+		case opPing:
+			c.writeFrame(opPong, payload)
+		}
+		return nil
+	default:
+		return fmt.Errorf("websocket: unknown opcode %#x", opcode)
+	}
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(opBinary, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// writeFrame sends a single final frame, masking it when acting as a client.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	buf := make([]byte, 0, 14+len(payload))
+	buf = append(buf, 0x80|opcode)
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		for i := range payload {
+			buf[start+i] ^= mask[i&3]
+		}
+	} else {
+		buf = append(buf, payload...)
+	}
+
+	_, err := c.Conn.Write(buf)
+	if opcode == opClose {
+		c.closed = true
+	}
+	return err
+}
+
+// Close sends a close frame, best effort, and closes the connection.
+func (c *wsConn) Close() error {
+	c.writeFrame(opClose, nil)
+	return c.Conn.Close()
+}
+
+func newChallengeKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerContains reports whether a comma-separated header contains token,
+// ignoring case.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// proxyTLSConfig returns the TLS configuration for the https proxy at u.
+func (ws WebSocket) proxyTLSConfig(u *url.URL) *tls.Config {
+	cfg := ws.ProxyTLSConfig.Clone()
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = u.Hostname()
+	}
+	return cfg
+}
+
+func proxyHost(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// proxyConnect asks an HTTP proxy to open a tunnel to target.
+func proxyConnect(conn net.Conn, proxyURL *url.URL, target string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		pass, _ := u.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	// Read the response byte by byte so no tunnelled data is consumed.
+	resp, err := http.ReadResponse(bufio.NewReaderSize(oneByteReader{conn}, 16), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy CONNECT %s: %s", target, resp.Status)
+	}
+	return nil
+}
+
+type oneByteReader struct{ r io.Reader }
+
+func (o oneByteReader) Read(b []byte) (int, error) {
+	if len(b) > 1 {
+		b = b[:1]
+	}
+	return o.r.Read(b)
+}
@@ -0,0 +1,255 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebSocket(t *testing.T) {
+	roundTrip(t, WebSocket{Proxy: noProxy}, "127.0.0.1:0")
+	roundTrip(t, WebSocket{Proxy: noProxy}, "127.0.0.1:0/p2p")
+}
+
+func TestMuxWebSocket(t *testing.T) {
+	m := NewMux()
+	m.Register(WebSocketScheme, WebSocket{Proxy: noProxy})
+	roundTrip(t, m, "ws://127.0.0.1:0/p2p")
+}
+
+func noProxy(*http.Request) (*url.URL, error) { return nil, nil }
+
+// wsPair returns a connected client and server WebSocket.
+func wsPair(t *testing.T, ws WebSocket) (client, server net.Conn) {
+	t.Helper()
+	ln, err := WebSocket{}.Listen("127.0.0.1:0/p2p")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := ln.Accept()
+		accepted <- c
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client, err = ws.Dial(ctx, ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	server = <-accepted
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestWebSocketLargeWrites(t *testing.T) {
+	client, server := wsPair(t, WebSocket{Proxy: noProxy})
+
+	for _, size := range []int{0, 125, 126, 65535, 65536, 1 << 20} {
+		payload := bytes.Repeat([]byte{byte(size)}, size)
+		go client.Write(payload)
+		got := make([]byte, size)
+		server.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err := io.ReadFull(server, got); err != nil {
+			t.Fatalf("size %d: read: %v", size, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("size %d: payload mismatch", size)
+		}
+	}
+}
+
+func TestWebSocketPingAndClose(t *testing.T) {
+	client, server := wsPair(t, WebSocket{Proxy: noProxy})
+
+	// A ping from the server is answered transparently by the client's
+	// reader and surfaces as a pong that the server's reader skips.
+	if err := server.(*wsConn).writeFrame(opPing, []byte("hi")); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	go client.Write([]byte("data"))
+
+	buf := make([]byte, 4)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	readDone := make(chan error, 1)
+	go func() {
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		_, err := client.Read(make([]byte, 1))
+		readDone <- err
+	}()
+	if _, err := io.ReadFull(server, buf); err != nil || string(buf) != "data" {
+		t.Fatalf("expected data after ping, got %q, %v", buf, err)
+	}
+
+	server.Close()
+	if err := <-readDone; err != io.EOF {
+		t.Fatalf("expected EOF after close frame, got %v", err)
+	}
+}
+
+func TestWebSocketRejectsPlainHTTP(t *testing.T) {
+	ln, err := WebSocket{}.Listen("127.0.0.1:0/p2p")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	resp, err := http.Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("expected 426, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get("http://" + strings.TrimSuffix(ln.Addr().String(), "/p2p") + "/other")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for wrong path, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebSocketHeaderTimeout(t *testing.T) {
+	ln, err := WebSocket{HeaderTimeout: 50 * time.Millisecond}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	// A client that starts a request and never finishes its headers.
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("expected the server to close the connection, got %v", err)
+	}
+}
+
+func TestWebSocketThroughProxy(t *testing.T) {
+	// A minimal CONNECT proxy that records the tunnels it opens.
+	proxyLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen proxy: %v", err)
+	}
+	defer proxyLn.Close()
+	tunnels := make(chan string, 1)
+	go func() {
+		c, err := proxyLn.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		req, err := http.ReadRequest(bufio.NewReader(c))
+		if err != nil || req.Method != http.MethodConnect {
+			return
+		}
+		tunnels <- req.Host
+		upstream, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			return
+		}
+		defer upstream.Close()
+		io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go io.Copy(upstream, c)
+		io.Copy(c, upstream)
+	}()
+
+	proxyURL, _ := url.Parse("http://" + proxyLn.Addr().String())
+	client, server := wsPair(t, WebSocket{Proxy: http.ProxyURL(proxyURL)})
+
+	select {
+	case host := <-tunnels:
+		if !strings.HasPrefix(host, "127.0.0.1:") {
+			t.Fatalf("unexpected tunnel target %s", host)
+		}
+	default:
+		t.Fatal("expected dial to go through the proxy")
+	}
+
+	go client.Write([]byte("via proxy"))
+	buf := make([]byte, len("via proxy"))
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(server, buf); err != nil || string(buf) != "via proxy" {
+		t.Fatalf("expected tunnelled data, got %q, %v", buf, err)
+	}
+}
+
+func TestWebSocketThroughTLSProxy(t *testing.T) {
+	// A CONNECT proxy that only speaks TLS.
+	tunnels := make(chan string, 1)
+	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		c, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		tunnels <- r.Host
+		io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go io.Copy(upstream, c)
+		io.Copy(c, upstream)
+	}))
+	defer proxy.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(proxy.Certificate())
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	client, server := wsPair(t, WebSocket{
+		Proxy:          http.ProxyURL(proxyURL),
+		ProxyTLSConfig: &tls.Config{RootCAs: roots},
+	})
+	select {
+	case <-tunnels:
+	default:
+		t.Fatal("expected dial to go through the proxy")
+	}
+
+	go client.Write([]byte("via tls proxy"))
+	buf := make([]byte, len("via tls proxy"))
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(server, buf); err != nil || string(buf) != "via tls proxy" {
+		t.Fatalf("expected tunnelled data, got %q, %v", buf, err)
+	}
+}
+
+func TestWebSocketRejectsUnsupportedProxy(t *testing.T) {
+	proxyURL, _ := url.Parse("socks5://127.0.0.1:1080")
+	ws := WebSocket{Proxy: http.ProxyURL(proxyURL)}
+	if _, err := ws.Dial(context.Background(), "127.0.0.1:1/p2p"); err == nil || !strings.Contains(err.Error(), "unsupported proxy scheme") {
+		t.Fatalf("expected an unsupported proxy error, got %v", err)
+	}
+}